@@ -0,0 +1,146 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// Bitmap is a fixed-order sequence of bits laid out like Column.NullMask:
+// bit i is stored in byte i/8, least significant bit first. For example the
+// nulls of the column (1, 2, 3, 4, 5, null, 7, 8, 9, null) in column.proto
+// are the bits 5 and 9, encoded as the bytes 0b00100000 0b00000010.
+//
+// The zero value is an empty bitmap ready to use.
+type Bitmap struct {
+	bits []byte
+	n    int
+}
+
+// NewBitmap returns a bitmap of n unset bits.
+func NewBitmap(n int) *Bitmap {
+	return &Bitmap{bits: make([]byte, (n+7)/8), n: n}
+}
+
+// BitmapFromBools returns a bitmap with bit i set if bs[i] is true.
+func BitmapFromBools(bs []bool) *Bitmap {
+	b := NewBitmap(len(bs))
+	for i, set := range bs {
+		if set {
+			b.Set(i)
+		}
+	}
+	return b
+}
+
+// BitmapFromBytes returns a bitmap of n bits read from a copy of data, so
+// that changing the bitmap leaves data as is. data may be shorter than
+// ceil(n/8) bytes, the missing trailing bytes being unset bits, like an
+// empty null mask means no nulls. It fails if n is negative, or if data is
+// longer than ceil(n/8) bytes or sets a bit past n.
+func BitmapFromBytes(data []byte, n int) (*Bitmap, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("bitmap of negative length %d", n)
+	}
+	size := (n + 7) / 8
+	if len(data) > size {
+		return nil, fmt.Errorf("bitmap of %d bits has %d bytes, expect at most %d", n, len(data), size)
+	}
+	if len(data) == size && n%8 != 0 && data[size-1]>>(n%8) != 0 {
+		return nil, fmt.Errorf("bitmap of %d bits has bits set past its length", n)
+	}
+	return &Bitmap{bits: append([]byte(nil), data...), n: n}, nil
+}
+
+// Len returns the number of bits.
+func (b *Bitmap) Len() int {
+	return b.n
+}
+
+// Test reports whether bit i is set. Bits past Len are unset.
+func (b *Bitmap) Test(i int) bool {
+	return i >= 0 && i/8 < len(b.bits) && i < b.n && b.bits[i/8]&(1<<(i%8)) != 0
+}
+
+// Set sets bit i, growing the bitmap to i+1 bits if needed.
+func (b *Bitmap) Set(i int) {
+	b.grow(i + 1)
+	b.bits[i/8] |= 1 << (i % 8)
+}
+
+// Clear unsets bit i, growing the bitmap to i+1 bits if needed.
+func (b *Bitmap) Clear(i int) {
+	b.grow(i + 1)
+	b.bits[i/8] &^= 1 << (i % 8)
+}
+
+// Append adds a bit at the end of the bitmap.
+func (b *Bitmap) Append(set bool) {
+	i := b.n
+	b.grow(i + 1)
+	if set {
+		b.bits[i/8] |= 1 << (i % 8)
+	}
+}
+
+func (b *Bitmap) grow(n int) {
+	for len(b.bits) < (n+7)/8 {
+		b.bits = append(b.bits, 0)
+	}
+	if n > b.n {
+		b.n = n
+	}
+}
+
+// Count returns the number of set bits.
+func (b *Bitmap) Count() int {
+	count := 0
+	for _, v := range b.bits {
+		count += bits.OnesCount8(v)
+	}
+	return count
+}
+
+// Range calls f for every set bit in increasing order, until f returns
+// false.
+func (b *Bitmap) Range(f func(i int) bool) {
+	for k, v := range b.bits {
+		for v != 0 {
+			i := k*8 + bits.TrailingZeros8(v)
+			if !f(i) {
+				return
+			}
+			v &= v - 1
+		}
+	}
+}
+
+// Bools returns the bitmap as one bool per bit.
+func (b *Bitmap) Bools() []bool {
+	bs := make([]bool, b.n)
+	b.Range(func(i int) bool {
+		bs[i] = true
+		return true
+	})
+	return bs
+}
+
+// Bytes returns the ceil(Len/8) bytes of the bitmap, unused trailing bits
+// being unset. The slice aliases the bitmap's storage.
+func (b *Bitmap) Bytes() []byte {
+	b.grow(b.n)
+	return b.bits[:(b.n+7)/8]
+}
@@ -0,0 +1,174 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// TestBitmapNullMaskExample checks the null mask example of column.proto:
+// the nulls of (1, 2, 3, 4, 5, null, 7, 8, 9, null) are 00100000 00000010.
+func TestBitmapNullMaskExample(t *testing.T) {
+	mask := []byte{0x20, 0x02}
+	b, err := BitmapFromBytes(mask, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nulls []int
+	b.Range(func(i int) bool {
+		nulls = append(nulls, i)
+		return true
+	})
+	if !reflect.DeepEqual(nulls, []int{5, 9}) {
+		t.Errorf("null rows = %v, want [5 9]", nulls)
+	}
+
+	values := []any{1, 2, 3, 4, 5, nil, 7, 8, 9, nil}
+	encoded := &Bitmap{}
+	for _, v := range values {
+		encoded.Append(v == nil)
+	}
+	if !bytes.Equal(encoded.Bytes(), mask) {
+		t.Errorf("Bytes() = %08b, want %08b", encoded.Bytes(), mask)
+	}
+}
+
+// randomBools returns n random bools, about one in three set.
+func randomBools(r *rand.Rand, n int) []bool {
+	bs := make([]bool, n)
+	for i := range bs {
+		bs[i] = r.Intn(3) == 0
+	}
+	return bs
+}
+
+func TestBitmapRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for n := 0; n <= 70; n++ {
+		for k := 0; k < 10; k++ {
+			bs := randomBools(r, n)
+			b := BitmapFromBools(bs)
+			if b.Len() != n {
+				t.Fatalf("Len() = %d, want %d", b.Len(), n)
+			}
+			if got := b.Bools(); !reflect.DeepEqual(got, bs) {
+				t.Fatalf("Bools() = %v, want %v", got, bs)
+			}
+
+			data := b.Bytes()
+			if len(data) != (n+7)/8 {
+				t.Fatalf("%d bits: Bytes() has %d bytes", n, len(data))
+			}
+			decoded, err := BitmapFromBytes(data, n)
+			if err != nil {
+				t.Fatalf("BitmapFromBytes(%08b, %d): %v", data, n, err)
+			}
+			if got := decoded.Bools(); !reflect.DeepEqual(got, bs) {
+				t.Fatalf("BitmapFromBytes(%08b, %d) = %v, want %v", data, n, got, bs)
+			}
+
+			appended := &Bitmap{}
+			for _, set := range bs {
+				appended.Append(set)
+			}
+			if !bytes.Equal(appended.Bytes(), data) {
+				t.Fatalf("Append: %08b, want %08b", appended.Bytes(), data)
+			}
+		}
+	}
+}
+
+func TestBitmapCountRange(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	for n := 0; n <= 70; n++ {
+		b := BitmapFromBools(randomBools(r, n))
+		var want []int
+		for i := -1; i <= n; i++ {
+			if b.Test(i) {
+				want = append(want, i)
+			}
+		}
+		var got []int
+		b.Range(func(i int) bool {
+			got = append(got, i)
+			return true
+		})
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Range = %v, want %v", got, want)
+		}
+		if b.Count() != len(want) {
+			t.Errorf("Count() = %d, want %d", b.Count(), len(want))
+		}
+		if len(want) > 1 {
+			var first []int
+			b.Range(func(i int) bool {
+				first = append(first, i)
+				return false
+			})
+			if !reflect.DeepEqual(first, want[:1]) {
+				t.Errorf("Range stopping after the first bit = %v, want %v", first, want[:1])
+			}
+		}
+	}
+}
+
+func TestBitmapFromBytes(t *testing.T) {
+	tests := []struct {
+		data []byte
+		n    int
+		ok   bool
+	}{
+		{nil, 0, true},
+		{nil, 10, true},
+		{[]byte{0xff}, 10, true},
+		{[]byte{0xff, 0x03}, 10, true},
+		{[]byte{0xff}, 8, true},
+		{[]byte{0x04}, 2, false},
+		{[]byte{0x00, 0x04}, 10, false},
+		{[]byte{0x80}, 7, false},
+		{[]byte{0x00}, 0, false},
+		{[]byte{0x00, 0x00}, 8, false},
+		{[]byte{0x00, 0x00, 0x00}, 10, false},
+		{nil, -1, false},
+		{[]byte{0x01}, -1, false},
+		{[]byte{0x01}, -7, false},
+	}
+	for _, tt := range tests {
+		_, err := BitmapFromBytes(tt.data, tt.n)
+		if (err == nil) != tt.ok {
+			t.Errorf("BitmapFromBytes(%08b, %d) error = %v, want ok %v", tt.data, tt.n, err, tt.ok)
+		}
+	}
+}
+
+func TestBitmapFromBytesCopies(t *testing.T) {
+	data := []byte{0x01, 0x00}
+	b, err := BitmapFromBytes(data[:1], 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Set(9)
+	b.Clear(0)
+	b.Append(true)
+	if !bytes.Equal(data, []byte{0x01, 0x00}) {
+		t.Errorf("changing the bitmap changed its bytes to %08b", data)
+	}
+	if want := []byte{0x00, 0x12}; !bytes.Equal(b.Bytes(), want) {
+		t.Errorf("Bytes() = %08b, want %08b", b.Bytes(), want)
+	}
+}
@@ -0,0 +1,304 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	greptimev1 "github.com/GreptimeTeam/greptime-proto/go/greptime/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrClosed is returned for writes to a closed BatchWriter or Session.
+var ErrClosed = errors.New("writer is closed")
+
+// BatchOptions configures a BatchWriter. Zero fields take their default.
+type BatchOptions struct {
+	// Header is sent with every request.
+	Header *greptimev1.RequestHeader
+	// MaxRows flushes the batch once it holds that many rows, 5000 by
+	// default.
+	MaxRows int
+	// MaxBytes flushes the batch once its InsertRequests encode to that many
+	// bytes, 4 MiB by default.
+	MaxBytes int
+	// FlushInterval flushes the batch that long after its first write, one
+	// second by default.
+	FlushInterval time.Duration
+	// MaxInFlight bounds the number of batches being sent concurrently, 1 by
+	// default which keeps batches in write order. Batches start being sent
+	// in the order they are flushed, and writes block while the bound is
+	// reached.
+	MaxInFlight int
+	// Timeout bounds the time to send a batch, no bound by default.
+	Timeout time.Duration
+	// Stream sends every table of a batch as its own message on a
+	// HandleRequests stream instead of a single Handle call.
+	Stream bool
+}
+
+func (o *BatchOptions) withDefaults() BatchOptions {
+	opts := *o
+	if opts.MaxRows <= 0 {
+		opts.MaxRows = 5000
+	}
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = 4 << 20
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = time.Second
+	}
+	if opts.MaxInFlight <= 0 {
+		opts.MaxInFlight = 1
+	}
+	return opts
+}
+
+// Future is the result of the batch a write was flushed with.
+type Future struct {
+	done     chan struct{}
+	affected uint32
+	err      error
+}
+
+func newFuture() *Future {
+	return &Future{done: make(chan struct{})}
+}
+
+func (f *Future) resolve(affected uint32, err error) {
+	f.affected, f.err = affected, err
+	close(f.done)
+}
+
+// Done is closed once the batch has been sent.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait waits for the batch to be sent and returns the rows the server
+// reported as affected by the whole batch.
+func (f *Future) Wait(ctx context.Context) (uint32, error) {
+	select {
+	case <-f.done:
+		return f.affected, f.err
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+type tableRegion struct {
+	table  string
+	region uint32
+}
+
+type batch struct {
+	tables map[tableRegion][]*greptimev1.InsertRequest
+	order  []tableRegion
+	rows   int
+	bytes  int
+	future *Future
+	// timer flushes the batch after FlushInterval.
+	timer *time.Timer
+}
+
+// BatchWriter coalesces InsertRequests per table and region into batches,
+// sent as a single InsertRequests once a row, byte or time threshold is
+// reached. It is safe for concurrent use.
+type BatchWriter struct {
+	client  greptimev1.GreptimeDatabaseClient
+	opts    BatchOptions
+	evolver *schemaEvolver
+
+	mu      sync.Mutex
+	current *batch
+	closed  bool
+	// pending holds the futures of the detached batches not resolved yet.
+	pending  map[*Future]struct{}
+	inFlight chan struct{}
+}
+
+// NewBatchWriter returns a writer sending batches with client.
+func NewBatchWriter(client greptimev1.GreptimeDatabaseClient, opts BatchOptions) *BatchWriter {
+	opts = opts.withDefaults()
+	return &BatchWriter{
+		client:   client,
+		opts:     opts,
+		pending:  make(map[*Future]struct{}),
+		inFlight: make(chan struct{}, opts.MaxInFlight),
+	}
+}
+
+// Write adds the requests to the current batch and returns the future
+// result of that batch. The requests must not be modified afterwards.
+func (w *BatchWriter) Write(reqs ...*greptimev1.InsertRequest) *Future {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		f := newFuture()
+		f.resolve(0, ErrClosed)
+		return f
+	}
+	b := w.current
+	if b == nil {
+		b = &batch{
+			tables: make(map[tableRegion][]*greptimev1.InsertRequest),
+			future: newFuture(),
+		}
+		w.current = b
+		b.timer = time.AfterFunc(w.opts.FlushInterval, func() { w.flushIfCurrent(b) })
+	}
+	for _, req := range reqs {
+		key := tableRegion{req.GetTableName(), req.GetRegionNumber()}
+		if _, ok := b.tables[key]; !ok {
+			b.order = append(b.order, key)
+		}
+		b.tables[key] = append(b.tables[key], req)
+		b.rows += int(req.GetRowCount())
+		b.bytes += proto.Size(req)
+	}
+	if b.rows >= w.opts.MaxRows || b.bytes >= w.opts.MaxBytes {
+		w.flush()
+	}
+	w.mu.Unlock()
+	return b.future
+}
+
+func (w *BatchWriter) flushIfCurrent(b *batch) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.current == b {
+		w.flush()
+	}
+}
+
+// flush removes the current batch, if any, from the writer and sends it.
+// The caller must hold w.mu, so that batches take the in-flight slots in
+// the order they are flushed.
+func (w *BatchWriter) flush() {
+	b := w.current
+	if b == nil {
+		return
+	}
+	w.current = nil
+	b.timer.Stop()
+	w.pending[b.future] = struct{}{}
+	w.send(b)
+}
+
+// Flush sends the current batch and waits until every batch sent so far is
+// done.
+func (w *BatchWriter) Flush(ctx context.Context) error {
+	w.mu.Lock()
+	w.flush()
+	pending := make([]*Future, 0, len(w.pending))
+	for f := range w.pending {
+		pending = append(pending, f)
+	}
+	w.mu.Unlock()
+
+	for _, f := range pending {
+		select {
+		case <-f.Done():
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Close flushes the writer, later writes fail with ErrClosed.
+func (w *BatchWriter) Close(ctx context.Context) error {
+	w.mu.Lock()
+	w.closed = true
+	w.mu.Unlock()
+	return w.Flush(ctx)
+}
+
+// send waits for an in-flight slot and sends b in the background. The
+// caller must hold w.mu, which the background send only takes once it has
+// released its slot.
+func (w *BatchWriter) send(b *batch) {
+	w.inFlight <- struct{}{}
+	go func() {
+		ctx := context.Background()
+		if w.opts.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, w.opts.Timeout)
+			defer cancel()
+		}
+		affected, err := w.sendBatch(ctx, b)
+		<-w.inFlight
+
+		w.mu.Lock()
+		delete(w.pending, b.future)
+		w.mu.Unlock()
+		b.future.resolve(affected, err)
+	}()
+}
+
+func (w *BatchWriter) sendBatch(ctx context.Context, b *batch) (uint32, error) {
+	inserts := make([]*greptimev1.InsertRequest, 0, len(b.order))
+	for _, key := range b.order {
+		reqs := b.tables[key]
+		if len(reqs) == 1 {
+			inserts = append(inserts, reqs[0])
+			continue
+		}
+		merged, err := greptimev1.MergeInsertRequests(reqs...)
+		if err != nil {
+			return 0, err
+		}
+		inserts = append(inserts, merged)
+	}
+	if w.evolver != nil {
+		if err := w.evolver.evolve(ctx, w.opts.Header, inserts); err != nil {
+			return 0, err
+		}
+	}
+
+	if !w.opts.Stream {
+		resp, err := w.client.Handle(ctx, &greptimev1.GreptimeRequest{
+			Header:  w.opts.Header,
+			Request: &greptimev1.GreptimeRequest_Inserts{Inserts: &greptimev1.InsertRequests{Inserts: inserts}},
+		})
+		if err != nil {
+			return 0, err
+		}
+		return resp.GetAffectedRows().GetValue(), nil
+	}
+
+	stream, err := w.client.HandleRequests(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for _, insert := range inserts {
+		err := stream.Send(&greptimev1.GreptimeRequest{
+			Header:  w.opts.Header,
+			Request: &greptimev1.GreptimeRequest_Inserts{Inserts: &greptimev1.InsertRequests{Inserts: []*greptimev1.InsertRequest{insert}}},
+		})
+		if err != nil {
+			// The status of a broken stream is reported by CloseAndRecv.
+			break
+		}
+	}
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		return 0, err
+	}
+	return resp.GetAffectedRows().GetValue(), nil
+}
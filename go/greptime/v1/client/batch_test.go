@@ -0,0 +1,218 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	greptimev1 "github.com/GreptimeTeam/greptime-proto/go/greptime/v1"
+	"google.golang.org/grpc"
+)
+
+// recordingClient records the inserts of the Handle calls, answering the
+// rows of each call as affected.
+type recordingClient struct {
+	mu    sync.Mutex
+	calls [][]*greptimev1.InsertRequest
+	// block, if set, is received from before answering.
+	block chan struct{}
+}
+
+func (c *recordingClient) Handle(ctx context.Context, req *greptimev1.GreptimeRequest, _ ...grpc.CallOption) (*greptimev1.GreptimeResponse, error) {
+	inserts := req.GetInserts().GetInserts()
+	c.mu.Lock()
+	c.calls = append(c.calls, inserts)
+	c.mu.Unlock()
+	if c.block != nil {
+		select {
+		case <-c.block:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	var rows uint32
+	for _, insert := range inserts {
+		rows += insert.GetRowCount()
+	}
+	return &greptimev1.GreptimeResponse{
+		Response: &greptimev1.GreptimeResponse_AffectedRows{AffectedRows: &greptimev1.AffectedRows{Value: rows}},
+	}, nil
+}
+
+func (c *recordingClient) HandleRequests(context.Context, ...grpc.CallOption) (greptimev1.GreptimeDatabase_HandleRequestsClient, error) {
+	return nil, errors.New("not implemented")
+}
+
+// tables returns the tables of the inserts of every call.
+func (c *recordingClient) tables() [][]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	tables := make([][]string, len(c.calls))
+	for i, call := range c.calls {
+		for _, insert := range call {
+			tables[i] = append(tables[i], insert.GetTableName())
+		}
+	}
+	return tables
+}
+
+// rowsInsert returns an insert of n rows into table.
+func rowsInsert(table string, n int) *greptimev1.InsertRequest {
+	values := make([]int64, n)
+	for i := range values {
+		values[i] = int64(i)
+	}
+	return &greptimev1.InsertRequest{
+		TableName: table,
+		RowCount:  uint32(n),
+		Columns: []*greptimev1.Column{{
+			ColumnName:   "ts",
+			SemanticType: greptimev1.Column_TIMESTAMP,
+			Datatype:     greptimev1.ColumnDataType_TIMESTAMP_MILLISECOND,
+			Values:       &greptimev1.Column_Values{TsMillisecondValues: values},
+		}},
+	}
+}
+
+func wait(t *testing.T, f *Future) uint32 {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	affected, err := f.Wait(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return affected
+}
+
+func TestBatchWriterFlushTriggers(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   BatchOptions
+		writes []*greptimev1.InsertRequest
+		// flushed is whether the writes fill a batch.
+		flushed bool
+		want    [][]string
+	}{
+		{
+			name:    "rows",
+			opts:    BatchOptions{MaxRows: 5, FlushInterval: time.Hour},
+			writes:  []*greptimev1.InsertRequest{rowsInsert("a", 2), rowsInsert("b", 2), rowsInsert("a", 1)},
+			flushed: true,
+			want:    [][]string{{"a", "b"}},
+		},
+		{
+			name:   "below rows",
+			opts:   BatchOptions{MaxRows: 6, FlushInterval: time.Hour},
+			writes: []*greptimev1.InsertRequest{rowsInsert("a", 2), rowsInsert("b", 2), rowsInsert("a", 1)},
+		},
+		{
+			name:    "bytes",
+			opts:    BatchOptions{MaxBytes: 10, FlushInterval: time.Hour},
+			writes:  []*greptimev1.InsertRequest{rowsInsert("a", 10)},
+			flushed: true,
+			want:    [][]string{{"a"}},
+		},
+		{
+			name:    "interval",
+			opts:    BatchOptions{FlushInterval: 10 * time.Millisecond},
+			writes:  []*greptimev1.InsertRequest{rowsInsert("a", 1), rowsInsert("b", 1)},
+			flushed: true,
+			want:    [][]string{{"a", "b"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &recordingClient{}
+			w := NewBatchWriter(c, tt.opts)
+			var f *Future
+			for _, req := range tt.writes {
+				f = w.Write(req)
+			}
+			if !tt.flushed {
+				select {
+				case <-f.Done():
+					t.Fatal("batch sent before reaching a threshold")
+				case <-time.After(20 * time.Millisecond):
+				}
+				return
+			}
+			wait(t, f)
+			if got := c.tables(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("calls = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBatchWriterMerge(t *testing.T) {
+	c := &recordingClient{}
+	w := NewBatchWriter(c, BatchOptions{MaxRows: 6, FlushInterval: time.Hour})
+	w.Write(rowsInsert("a", 2))
+	w.Write(rowsInsert("b", 1))
+	if affected := wait(t, w.Write(rowsInsert("a", 3))); affected != 6 {
+		t.Errorf("affected = %d, want 6", affected)
+	}
+	if len(c.calls) != 1 || len(c.calls[0]) != 2 || c.calls[0][0].GetRowCount() != 5 {
+		t.Errorf("calls = %v, want the 5 rows of a then b", c.calls)
+	}
+}
+
+func TestBatchWriterOrder(t *testing.T) {
+	c := &recordingClient{block: make(chan struct{})}
+	w := NewBatchWriter(c, BatchOptions{MaxRows: 1, FlushInterval: time.Millisecond})
+	tables := []string{"a", "b", "c", "d", "e"}
+	var futures []*Future
+	go func() {
+		for range tables {
+			c.block <- struct{}{}
+		}
+	}()
+	for _, table := range tables {
+		futures = append(futures, w.Write(rowsInsert(table, 1)))
+	}
+	for _, f := range futures {
+		wait(t, f)
+	}
+	want := make([][]string, len(tables))
+	for i, table := range tables {
+		want[i] = []string{table}
+	}
+	if got := c.tables(); !reflect.DeepEqual(got, want) {
+		t.Errorf("calls = %v, want %v", got, want)
+	}
+}
+
+func TestBatchWriterClose(t *testing.T) {
+	c := &recordingClient{}
+	w := NewBatchWriter(c, BatchOptions{FlushInterval: time.Hour})
+	f := w.Write(rowsInsert("a", 1))
+	if err := w.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-f.Done():
+	default:
+		t.Fatal("Close returned before the batch was sent")
+	}
+	if _, err := w.Write(rowsInsert("a", 1)).Wait(context.Background()); !errors.Is(err, ErrClosed) {
+		t.Errorf("Write after Close: %v, want ErrClosed", err)
+	}
+}
@@ -0,0 +1,434 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package client is a GreptimeDB client built on top of the generated
+// GreptimeDatabase, PrometheusGateway and HealthCheck gRPC clients, and of
+// the Arrow Flight service queries are answered through.
+package client
+
+import (
+	"context"
+	"time"
+
+	greptimev1 "github.com/GreptimeTeam/greptime-proto/go/greptime/v1"
+	"github.com/GreptimeTeam/greptime-proto/go/greptime/v1/prometheus"
+	"github.com/apache/arrow/go/v11/arrow/flight"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// RetryPolicy controls how calls failing with a retryable status code are
+// retried, with an exponential backoff between attempts.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, 1 disables retries.
+	MaxAttempts int
+	// InitialBackoff is the wait before the second attempt, doubled after
+	// every attempt up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Codes are the retryable status codes.
+	Codes []codes.Code
+}
+
+// DefaultRetryPolicy retries calls failing with Unavailable up to three
+// attempts. Unavailable usually means the server could not be reached, but
+// a call may also fail with it after the server received the request, so a
+// retried insert or DDL statement may be applied twice.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     2 * time.Second,
+	Codes:          []codes.Code{codes.Unavailable},
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	code := status.Code(err)
+	for _, c := range p.Codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+type options struct {
+	header      *greptimev1.RequestHeader
+	timeout     time.Duration
+	retry       RetryPolicy
+	dialOptions []grpc.DialOption
+	evolve      bool
+}
+
+// Option configures a Client.
+type Option func(*options)
+
+// WithCatalog sets the catalog of every request. Without it, the server
+// uses the catalog of the dbname, or "greptime".
+func WithCatalog(catalog string) Option {
+	return func(o *options) { o.header.Catalog = catalog }
+}
+
+// WithSchema sets the schema of every request. Without it, the server
+// uses the schema of the dbname, or "public".
+func WithSchema(schema string) Option {
+	return func(o *options) { o.header.Schema = schema }
+}
+
+// WithDatabase sets the dbname of every request.
+func WithDatabase(dbname string) Option {
+	return func(o *options) { o.header.Dbname = dbname }
+}
+
+// WithBasicAuth authenticates every request with a username and password.
+func WithBasicAuth(username, password string) Option {
+	return func(o *options) {
+		o.header.Authorization = &greptimev1.AuthHeader{
+			AuthScheme: &greptimev1.AuthHeader_Basic{Basic: &greptimev1.Basic{Username: username, Password: password}},
+		}
+	}
+}
+
+// WithToken authenticates every request with a token.
+func WithToken(token string) Option {
+	return func(o *options) {
+		o.header.Authorization = &greptimev1.AuthHeader{
+			AuthScheme: &greptimev1.AuthHeader_Token{Token: &greptimev1.Token{Token: token}},
+		}
+	}
+}
+
+// WithTimeout bounds every call, retries included, unless the context of
+// the call has an earlier deadline.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) { o.timeout = timeout }
+}
+
+// WithRetryPolicy replaces DefaultRetryPolicy.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(o *options) { o.retry = policy }
+}
+
+// WithDialOptions sets the options used by New to dial the server. Without
+// them the connection is insecure.
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(o *options) { o.dialOptions = append(o.dialOptions, opts...) }
+}
+
+// Client is a GreptimeDB client. It fills the RequestHeader of every
+// request and is safe for concurrent use.
+type Client struct {
+	conn     grpc.ClientConnInterface
+	database greptimev1.GreptimeDatabaseClient
+	prom     greptimev1.PrometheusGatewayClient
+	health   greptimev1.HealthCheckClient
+	flight   flight.FlightServiceClient
+	opts     options
+	owned    bool
+	evolver  *schemaEvolver
+}
+
+// New dials the GreptimeDB frontend at target and returns a client owning
+// the connection.
+func New(target string, opts ...Option) (*Client, error) {
+	c := newClient(nil, opts)
+	dialOptions := c.opts.dialOptions
+	if len(dialOptions) == 0 {
+		dialOptions = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+	conn, err := grpc.Dial(target, dialOptions...)
+	if err != nil {
+		return nil, err
+	}
+	c.setConn(conn)
+	c.owned = true
+	return c, nil
+}
+
+// NewFromConn returns a client using an existing connection, which Close
+// doesn't close.
+func NewFromConn(conn grpc.ClientConnInterface, opts ...Option) *Client {
+	return newClient(conn, opts)
+}
+
+func newClient(conn grpc.ClientConnInterface, opts []Option) *Client {
+	c := &Client{opts: options{
+		header: &greptimev1.RequestHeader{},
+		retry:  DefaultRetryPolicy,
+	}}
+	for _, opt := range opts {
+		opt(&c.opts)
+	}
+	if c.opts.evolve {
+		c.evolver = &schemaEvolver{client: c, tables: make(map[tableKey]*evolvingTable)}
+	}
+	if conn != nil {
+		c.setConn(conn)
+	}
+	return c
+}
+
+func (c *Client) setConn(conn grpc.ClientConnInterface) {
+	c.conn = conn
+	c.database = greptimev1.NewGreptimeDatabaseClient(conn)
+	c.prom = greptimev1.NewPrometheusGatewayClient(conn)
+	c.health = greptimev1.NewHealthCheckClient(conn)
+	c.flight = flight.NewFlightServiceClient(conn)
+}
+
+// Close closes the connection if the client owns it.
+func (c *Client) Close() error {
+	if !c.owned {
+		return nil
+	}
+	return c.conn.(*grpc.ClientConn).Close()
+}
+
+// Header returns a copy of the header sent with every request.
+func (c *Client) Header() *greptimev1.RequestHeader {
+	return proto.Clone(c.opts.header).(*greptimev1.RequestHeader)
+}
+
+// withTimeout applies the client's timeout to ctx.
+func (c *Client) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.opts.timeout > 0 {
+		return context.WithTimeout(ctx, c.opts.timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// call runs f with the client's timeout and retry policy.
+func (c *Client) call(ctx context.Context, f func(ctx context.Context) error) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	return c.retry(ctx, f)
+}
+
+// retry runs f with the client's retry policy.
+func (c *Client) retry(ctx context.Context, f func(ctx context.Context) error) error {
+	backoff := c.opts.retry.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := f(ctx)
+		if err == nil || attempt >= c.opts.retry.MaxAttempts || !c.opts.retry.retryable(err) {
+			return err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return err
+		}
+		if backoff *= 2; backoff > c.opts.retry.MaxBackoff {
+			backoff = c.opts.retry.MaxBackoff
+		}
+	}
+}
+
+// Do sends req, with the client's header if it has none. req is left as
+// is.
+func (c *Client) Do(ctx context.Context, req *greptimev1.GreptimeRequest) (*greptimev1.GreptimeResponse, error) {
+	if req.Header == nil {
+		req = &greptimev1.GreptimeRequest{Header: c.opts.header, Request: req.Request}
+	}
+	var resp *greptimev1.GreptimeResponse
+	err := c.call(ctx, func(ctx context.Context) (err error) {
+		resp, err = c.database.Handle(ctx, req)
+		return err
+	})
+	return resp, err
+}
+
+func (c *Client) affectedRows(ctx context.Context, req *greptimev1.GreptimeRequest) (uint32, error) {
+	resp, err := c.Do(ctx, req)
+	if err != nil {
+		return 0, err
+	}
+	return resp.GetAffectedRows().GetValue(), nil
+}
+
+// Insert validates and writes the requests in one call, returning the
+// number of rows written. With WithSchemaEvolution, the columns missing
+// from known tables are added first.
+func (c *Client) Insert(ctx context.Context, reqs ...*greptimev1.InsertRequest) (uint32, error) {
+	inserts := &greptimev1.InsertRequests{Inserts: reqs}
+	if err := inserts.Validate(); err != nil {
+		return 0, err
+	}
+	if c.evolver != nil {
+		if err := c.evolver.evolve(ctx, c.opts.header, reqs); err != nil {
+			return 0, err
+		}
+	}
+	return c.affectedRows(ctx, &greptimev1.GreptimeRequest{
+		Request: &greptimev1.GreptimeRequest_Inserts{Inserts: inserts},
+	})
+}
+
+// Delete deletes the rows whose keys are in the request, returning the
+// number of rows deleted.
+func (c *Client) Delete(ctx context.Context, req *greptimev1.DeleteRequest) (uint32, error) {
+	if err := req.Validate(); err != nil {
+		return 0, err
+	}
+	return c.affectedRows(ctx, &greptimev1.GreptimeRequest{
+		Request: &greptimev1.GreptimeRequest_Delete{Delete: req},
+	})
+}
+
+// SQL executes a statement that doesn't return rows, like INSERT or a DDL
+// statement, and returns the number of affected rows.
+func (c *Client) SQL(ctx context.Context, sql string) (uint32, error) {
+	return c.affectedRows(ctx, &greptimev1.GreptimeRequest{
+		Request: &greptimev1.GreptimeRequest_Query{Query: &greptimev1.QueryRequest{
+			Query: &greptimev1.QueryRequest_Sql{Sql: sql},
+		}},
+	})
+}
+
+func (c *Client) ddl(ctx context.Context, ddl *greptimev1.DdlRequest) (uint32, error) {
+	return c.affectedRows(ctx, &greptimev1.GreptimeRequest{
+		Request: &greptimev1.GreptimeRequest_Ddl{Ddl: ddl},
+	})
+}
+
+// qualify fills empty catalog and schema names with the client's, if set.
+// Names left empty are resolved by the server from the header.
+func (c *Client) qualify(catalog, schema *string) {
+	if *catalog == "" {
+		*catalog = c.opts.header.Catalog
+	}
+	if *schema == "" {
+		*schema = c.opts.header.Schema
+	}
+}
+
+// CreateDatabase creates a database.
+func (c *Client) CreateDatabase(ctx context.Context, expr *greptimev1.CreateDatabaseExpr) error {
+	_, err := c.ddl(ctx, &greptimev1.DdlRequest{Expr: &greptimev1.DdlRequest_CreateDatabase{CreateDatabase: expr}})
+	return err
+}
+
+// CreateTable creates a table, in the client's catalog and schema unless
+// the expression names them.
+func (c *Client) CreateTable(ctx context.Context, expr *greptimev1.CreateTableExpr) error {
+	expr = proto.Clone(expr).(*greptimev1.CreateTableExpr)
+	c.qualify(&expr.CatalogName, &expr.SchemaName)
+	_, err := c.ddl(ctx, &greptimev1.DdlRequest{Expr: &greptimev1.DdlRequest_CreateTable{CreateTable: expr}})
+	if err == nil && c.evolver != nil {
+		c.evolver.register(expr)
+	}
+	return err
+}
+
+// Alter alters a table, in the client's catalog and schema unless the
+// expression names them.
+func (c *Client) Alter(ctx context.Context, expr *greptimev1.AlterExpr) error {
+	expr = proto.Clone(expr).(*greptimev1.AlterExpr)
+	c.qualify(&expr.CatalogName, &expr.SchemaName)
+	_, err := c.ddl(ctx, &greptimev1.DdlRequest{Expr: &greptimev1.DdlRequest_Alter{Alter: expr}})
+	if err == nil && c.evolver != nil {
+		c.evolver.forget(expr.CatalogName, expr.SchemaName, expr.TableName)
+	}
+	return err
+}
+
+// DropTable drops a table, in the client's catalog and schema unless the
+// expression names them.
+func (c *Client) DropTable(ctx context.Context, expr *greptimev1.DropTableExpr) error {
+	expr = proto.Clone(expr).(*greptimev1.DropTableExpr)
+	c.qualify(&expr.CatalogName, &expr.SchemaName)
+	_, err := c.ddl(ctx, &greptimev1.DdlRequest{Expr: &greptimev1.DdlRequest_DropTable{DropTable: expr}})
+	if err == nil && c.evolver != nil {
+		c.evolver.forget(expr.CatalogName, expr.SchemaName, expr.TableName)
+	}
+	return err
+}
+
+// Flush flushes the memtables of a table, or of one of its regions.
+func (c *Client) Flush(ctx context.Context, expr *greptimev1.FlushTableExpr) error {
+	expr = proto.Clone(expr).(*greptimev1.FlushTableExpr)
+	c.qualify(&expr.CatalogName, &expr.SchemaName)
+	_, err := c.ddl(ctx, &greptimev1.DdlRequest{Expr: &greptimev1.DdlRequest_FlushTable{FlushTable: expr}})
+	return err
+}
+
+// Compact compacts the files of a table, or of one of its regions.
+func (c *Client) Compact(ctx context.Context, expr *greptimev1.CompactTableExpr) error {
+	expr = proto.Clone(expr).(*greptimev1.CompactTableExpr)
+	c.qualify(&expr.CatalogName, &expr.SchemaName)
+	_, err := c.ddl(ctx, &greptimev1.DdlRequest{Expr: &greptimev1.DdlRequest_CompactTable{CompactTable: expr}})
+	return err
+}
+
+// PromQL evaluates a PromQL query through the Prometheus gateway, with the
+// client's header if req has none. req is left as is. The body of the
+// response is in the JSON format of the Prometheus HTTP API.
+func (c *Client) PromQL(ctx context.Context, req *greptimev1.PromqlRequest) (*greptimev1.PromqlResponse, error) {
+	if req.Header == nil {
+		req = &greptimev1.PromqlRequest{Header: c.opts.header, Promql: req.Promql}
+	}
+	var resp *greptimev1.PromqlResponse
+	err := c.call(ctx, func(ctx context.Context) (err error) {
+		resp, err = c.prom.Handle(ctx, req)
+		return err
+	})
+	return resp, err
+}
+
+// PromQLRange evaluates a PromQL range query from start to end every step
+// through the Prometheus gateway. Ranges of more than
+// greptimev1.MaxPromPoints points are split in several queries, sent one
+// after the other, whose results are stitched together.
+func (c *Client) PromQLRange(ctx context.Context, query string, start, end time.Time, step time.Duration) (*prometheus.QueryResponse, error) {
+	queries, err := greptimev1.SplitPromRangeQuery(query, start, end, step, 0)
+	if err != nil {
+		return nil, err
+	}
+	resps := make([]*prometheus.QueryResponse, len(queries))
+	for i, query := range queries {
+		resp, err := c.PromQL(ctx, query.Request())
+		if err != nil {
+			return nil, err
+		}
+		if resps[i], err = prometheus.DecodePromqlResponse(resp); err != nil {
+			return nil, err
+		}
+	}
+	if len(resps) == 1 {
+		return resps[0], nil
+	}
+	return prometheus.StitchResponses(resps...)
+}
+
+// Ping checks the server is healthy.
+func (c *Client) Ping(ctx context.Context) error {
+	return c.call(ctx, func(ctx context.Context) error {
+		_, err := c.health.HealthCheck(ctx, &greptimev1.HealthCheckRequest{})
+		return err
+	})
+}
+
+// NewBatchWriter returns a BatchWriter sending batches through the client's
+// connection with the client's header, unless opts has one. With
+// WithSchemaEvolution, the columns of a batch missing from known tables are
+// added before sending it.
+func (c *Client) NewBatchWriter(opts BatchOptions) *BatchWriter {
+	if opts.Header == nil {
+		opts.Header = c.opts.header
+	}
+	w := NewBatchWriter(c.database, opts)
+	w.evolver = c.evolver
+	return w
+}
@@ -0,0 +1,174 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	greptimev1 "github.com/GreptimeTeam/greptime-proto/go/greptime/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// fakeConn answers unary calls with reply, after failing the first
+// failures calls with err, and records the requests.
+type fakeConn struct {
+	mu       sync.Mutex
+	methods  []string
+	requests []proto.Message
+	failures int
+	err      error
+	reply    proto.Message
+}
+
+func (c *fakeConn) Invoke(ctx context.Context, method string, args, reply any, _ ...grpc.CallOption) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.methods = append(c.methods, method)
+	c.requests = append(c.requests, proto.Clone(args.(proto.Message)))
+	if c.failures > 0 {
+		c.failures--
+		return c.err
+	}
+	if c.reply != nil {
+		proto.Merge(reply.(proto.Message), c.reply)
+	}
+	return nil
+}
+
+func (c *fakeConn) NewStream(context.Context, *grpc.StreamDesc, string, ...grpc.CallOption) (grpc.ClientStream, error) {
+	return nil, errors.New("not implemented")
+}
+
+func affected(n uint32) *greptimev1.GreptimeResponse {
+	return &greptimev1.GreptimeResponse{
+		Response: &greptimev1.GreptimeResponse_AffectedRows{AffectedRows: &greptimev1.AffectedRows{Value: n}},
+	}
+}
+
+func TestClientHeader(t *testing.T) {
+	conn := &fakeConn{reply: affected(1)}
+	c := NewFromConn(conn, WithDatabase("db"), WithBasicAuth("u", "p"))
+	ctx := context.Background()
+
+	req := &greptimev1.GreptimeRequest{
+		Request: &greptimev1.GreptimeRequest_Query{Query: &greptimev1.QueryRequest{
+			Query: &greptimev1.QueryRequest_Sql{Sql: "SELECT 1"},
+		}},
+	}
+	if _, err := c.Do(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if req.Header != nil {
+		t.Errorf("Do set the header of the caller's request to %v", req.Header)
+	}
+	want := &greptimev1.RequestHeader{
+		Dbname: "db",
+		Authorization: &greptimev1.AuthHeader{
+			AuthScheme: &greptimev1.AuthHeader_Basic{Basic: &greptimev1.Basic{Username: "u", Password: "p"}},
+		},
+	}
+	if got := conn.requests[0].(*greptimev1.GreptimeRequest).GetHeader(); !proto.Equal(got, want) {
+		t.Errorf("sent header %v, want %v", got, want)
+	}
+
+	own := &greptimev1.RequestHeader{Dbname: "other"}
+	if _, err := c.Do(ctx, &greptimev1.GreptimeRequest{Header: own}); err != nil {
+		t.Fatal(err)
+	}
+	if got := conn.requests[1].(*greptimev1.GreptimeRequest).GetHeader(); !proto.Equal(got, own) {
+		t.Errorf("sent header %v, want the request's %v", got, own)
+	}
+
+	conn.reply = &greptimev1.PromqlResponse{}
+	prom := (&greptimev1.PromInstantQuery{Query: "up", Time: "1"}).Request()
+	if _, err := c.PromQL(ctx, prom); err != nil {
+		t.Fatal(err)
+	}
+	if prom.Header != nil {
+		t.Errorf("PromQL set the header of the caller's request to %v", prom.Header)
+	}
+	if got := conn.requests[2].(*greptimev1.PromqlRequest).GetHeader(); !proto.Equal(got, want) {
+		t.Errorf("sent header %v, want %v", got, want)
+	}
+}
+
+func TestClientQualify(t *testing.T) {
+	tests := []struct {
+		name                    string
+		opts                    []Option
+		catalog, schema         string
+		wantCatalog, wantSchema string
+	}{
+		{name: "dbname", opts: []Option{WithDatabase("db")}},
+		{name: "client", opts: []Option{WithCatalog("c"), WithSchema("s")}, wantCatalog: "c", wantSchema: "s"},
+		{name: "expression", opts: []Option{WithCatalog("c"), WithSchema("s")}, catalog: "ec", schema: "es", wantCatalog: "ec", wantSchema: "es"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := &fakeConn{reply: affected(0)}
+			c := NewFromConn(conn, tt.opts...)
+			expr := &greptimev1.DropTableExpr{CatalogName: tt.catalog, SchemaName: tt.schema, TableName: "t"}
+			if err := c.DropTable(context.Background(), expr); err != nil {
+				t.Fatal(err)
+			}
+			got := conn.requests[0].(*greptimev1.GreptimeRequest).GetDdl().GetDropTable()
+			if got.CatalogName != tt.wantCatalog || got.SchemaName != tt.wantSchema {
+				t.Errorf("sent %s.%s, want %s.%s", got.CatalogName, got.SchemaName, tt.wantCatalog, tt.wantSchema)
+			}
+			if expr.CatalogName != tt.catalog || expr.SchemaName != tt.schema {
+				t.Errorf("DropTable changed the caller's expression to %v", expr)
+			}
+		})
+	}
+}
+
+func TestClientRetry(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond, Codes: []codes.Code{codes.Unavailable}}
+	tests := []struct {
+		name     string
+		failures int
+		err      error
+		wantErr  codes.Code
+		attempts int
+	}{
+		{name: "success", attempts: 1},
+		{name: "retried", failures: 2, err: status.Error(codes.Unavailable, ""), attempts: 3},
+		{name: "exhausted", failures: 3, err: status.Error(codes.Unavailable, ""), wantErr: codes.Unavailable, attempts: 3},
+		{name: "not retryable", failures: 1, err: status.Error(codes.InvalidArgument, ""), wantErr: codes.InvalidArgument, attempts: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := &fakeConn{reply: affected(2), failures: tt.failures, err: tt.err}
+			c := NewFromConn(conn, WithRetryPolicy(policy))
+			n, err := c.SQL(context.Background(), "DELETE FROM t")
+			if status.Code(err) != tt.wantErr {
+				t.Errorf("SQL() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && n != 2 {
+				t.Errorf("SQL() = %d, want 2", n)
+			}
+			if len(conn.methods) != tt.attempts {
+				t.Errorf("%d attempts, want %d", len(conn.methods), tt.attempts)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	greptimev1 "github.com/GreptimeTeam/greptime-proto/go/greptime/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// WithSchemaEvolution makes the client add the columns of outgoing
+// InsertRequests missing from their tables before writing them, for the
+// tables whose definition it knows. See RegisterTable.
+func WithSchemaEvolution() Option {
+	return func(o *options) { o.evolve = true }
+}
+
+// tableKey is the qualified name of a table.
+type tableKey struct {
+	catalog, schema, table string
+}
+
+// newTableKey qualifies a table with the database header selects unless
+// catalog or schema are set.
+func newTableKey(header *greptimev1.RequestHeader, catalog, schema, table string) tableKey {
+	headerCatalog, headerSchema := header.Database()
+	if catalog == "" {
+		catalog = headerCatalog
+	}
+	if schema == "" {
+		schema = headerSchema
+	}
+	return tableKey{catalog, schema, table}
+}
+
+// evolvingTable is the known definition of a table. Its mutex is held
+// while the columns of a write are checked and added, so that concurrent
+// writers add each column once.
+type evolvingTable struct {
+	key     tableKey
+	mu      sync.Mutex
+	expr    *greptimev1.CreateTableExpr
+	columns map[string]*greptimev1.ColumnDef
+}
+
+func newEvolvingTable(key tableKey, expr *greptimev1.CreateTableExpr) *evolvingTable {
+	t := &evolvingTable{key: key, expr: expr, columns: make(map[string]*greptimev1.ColumnDef, len(expr.ColumnDefs))}
+	for _, def := range expr.ColumnDefs {
+		t.columns[def.Name] = def
+	}
+	return t
+}
+
+// schemaEvolver adds the columns missing from the known tables.
+type schemaEvolver struct {
+	client *Client
+
+	mu     sync.Mutex
+	tables map[tableKey]*evolvingTable
+}
+
+func (e *schemaEvolver) table(key tableKey) *evolvingTable {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.tables[key]
+}
+
+func (e *schemaEvolver) register(expr *greptimev1.CreateTableExpr) {
+	expr = proto.Clone(expr).(*greptimev1.CreateTableExpr)
+	key := newTableKey(e.client.opts.header, expr.CatalogName, expr.SchemaName, expr.TableName)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.tables[key] = newEvolvingTable(key, expr)
+}
+
+func (e *schemaEvolver) forget(catalog, schema, table string) {
+	key := newTableKey(e.client.opts.header, catalog, schema, table)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.tables, key)
+}
+
+// evolve adds the columns of reqs missing from their tables, in the
+// database header selects. Tables that aren't known are left alone.
+func (e *schemaEvolver) evolve(ctx context.Context, header *greptimev1.RequestHeader, reqs []*greptimev1.InsertRequest) error {
+	byTable := make(map[string][]*greptimev1.InsertRequest)
+	var order []string
+	for _, req := range reqs {
+		name := req.GetTableName()
+		if _, ok := byTable[name]; !ok {
+			order = append(order, name)
+		}
+		byTable[name] = append(byTable[name], req)
+	}
+	for _, name := range order {
+		t := e.table(newTableKey(header, "", "", name))
+		if t == nil {
+			continue
+		}
+		if err := e.evolveTable(ctx, t, byTable[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// evolveTable adds the columns of reqs missing from t with a single
+// AlterExpr, tags becoming primary keys.
+func (e *schemaEvolver) evolveTable(ctx context.Context, t *evolvingTable, reqs []*greptimev1.InsertRequest) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var adds []*greptimev1.AddColumn
+	added := make(map[string]bool)
+	for _, req := range reqs {
+		for _, column := range req.GetColumns() {
+			name := column.GetColumnName()
+			if def := t.columns[name]; def != nil {
+				if def.Datatype != column.GetDatatype() {
+					return fmt.Errorf("column %q of table %q is %s, got %s values",
+						name, t.expr.TableName, def.Datatype, column.GetDatatype())
+				}
+				continue
+			}
+			if added[name] {
+				continue
+			}
+			if column.GetSemanticType() == greptimev1.Column_TIMESTAMP {
+				return fmt.Errorf("table %q has time index %q, cannot add timestamp column %q",
+					t.expr.TableName, t.expr.TimeIndex, name)
+			}
+			added[name] = true
+			adds = append(adds, &greptimev1.AddColumn{
+				ColumnDef: &greptimev1.ColumnDef{Name: name, Datatype: column.GetDatatype(), IsNullable: true},
+				IsKey:     column.GetSemanticType() == greptimev1.Column_TAG,
+			})
+		}
+	}
+	if len(adds) == 0 {
+		return nil
+	}
+
+	alter := &greptimev1.AlterExpr{
+		CatalogName: t.key.catalog,
+		SchemaName:  t.key.schema,
+		TableName:   t.key.table,
+		Kind:        &greptimev1.AlterExpr_AddColumns{AddColumns: &greptimev1.AddColumns{AddColumns: adds}},
+	}
+	if _, err := e.client.ddl(ctx, &greptimev1.DdlRequest{Expr: &greptimev1.DdlRequest_Alter{Alter: alter}}); err != nil {
+		return err
+	}
+	expr := proto.Clone(t.expr).(*greptimev1.CreateTableExpr)
+	for _, add := range adds {
+		expr.ColumnDefs = append(expr.ColumnDefs, add.ColumnDef)
+		if add.IsKey {
+			expr.PrimaryKeys = append(expr.PrimaryKeys, add.ColumnDef.Name)
+		}
+		t.columns[add.ColumnDef.Name] = add.ColumnDef
+	}
+	t.expr = expr
+	return nil
+}
+
+// RegisterTable records the current definition of a table for schema
+// evolution, in the database of the client's header unless the expression
+// names its catalog and schema. Before writing to the table, the client
+// then adds the columns of the InsertRequests it lacks, nullable, tags
+// being added to the primary key, and records them.
+//
+// Tables created with CreateTable are registered, and tables successfully
+// altered with Alter or dropped with DropTable are forgotten until
+// registered again.
+//
+// RegisterTable has no effect unless the client was created
+// WithSchemaEvolution.
+func (c *Client) RegisterTable(expr *greptimev1.CreateTableExpr) {
+	if c.evolver != nil {
+		c.evolver.register(expr)
+	}
+}
+
+// Table returns the definition of a table recorded for schema evolution,
+// nil if it isn't known.
+func (c *Client) Table(catalog, schema, table string) *greptimev1.CreateTableExpr {
+	if c.evolver == nil {
+		return nil
+	}
+	t := c.evolver.table(newTableKey(c.opts.header, catalog, schema, table))
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return proto.Clone(t.expr).(*greptimev1.CreateTableExpr)
+}
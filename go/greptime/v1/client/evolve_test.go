@@ -0,0 +1,117 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	greptimev1 "github.com/GreptimeTeam/greptime-proto/go/greptime/v1"
+	"github.com/GreptimeTeam/greptime-proto/go/greptime/v1/greptimetest"
+)
+
+// newEvolvingClient returns a client with schema evolution of a new
+// in-memory server, and a table "t" of a time index "ts" created through
+// it.
+func newEvolvingClient(t *testing.T) (*Client, *greptimetest.Server) {
+	t.Helper()
+	srv := greptimetest.NewServer()
+	t.Cleanup(srv.Close)
+	conn, err := srv.Dial(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewFromConn(conn, WithSchemaEvolution())
+	t.Cleanup(func() { c.Close() })
+	expr, err := greptimev1.NewTable("t").Timestamp("ts", greptimev1.ColumnDataType_TIMESTAMP_MILLISECOND).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.CreateTable(context.Background(), expr); err != nil {
+		t.Fatal(err)
+	}
+	return c, srv
+}
+
+func columnNames(expr *greptimev1.CreateTableExpr) []string {
+	var names []string
+	for _, def := range expr.GetColumnDefs() {
+		names = append(names, def.Name)
+	}
+	return names
+}
+
+func TestSchemaEvolution(t *testing.T) {
+	c, srv := newEvolvingClient(t)
+	ctx := context.Background()
+
+	b := greptimev1.NewInsertBuilder("t").
+		Tag("host", greptimev1.ColumnDataType_STRING).
+		Field("usage", greptimev1.ColumnDataType_FLOAT64).
+		Timestamp("ts", greptimev1.ColumnDataType_TIMESTAMP_MILLISECOND)
+	if err := b.AddRow(map[string]any{"host": "a", "usage": 1.5, "ts": int64(1)}); err != nil {
+		t.Fatal(err)
+	}
+	req, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Insert(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"ts", "host", "usage"}
+	if got := columnNames(srv.Table("greptime", "public", "t")); !reflect.DeepEqual(got, want) {
+		t.Errorf("server columns = %v, want %v", got, want)
+	}
+	known := c.Table("", "", "t")
+	if got := columnNames(known); !reflect.DeepEqual(got, want) {
+		t.Errorf("known columns = %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(known.PrimaryKeys, []string{"host"}) {
+		t.Errorf("known primary keys = %v, want [host]", known.PrimaryKeys)
+	}
+}
+
+func TestSchemaEvolutionAlter(t *testing.T) {
+	c, _ := newEvolvingClient(t)
+	ctx := context.Background()
+	drop := func(column string) error {
+		return c.Alter(ctx, &greptimev1.AlterExpr{
+			TableName: "t",
+			Kind: &greptimev1.AlterExpr_DropColumns{DropColumns: &greptimev1.DropColumns{
+				DropColumns: []*greptimev1.DropColumn{{Name: column}},
+			}},
+		})
+	}
+
+	if err := drop("missing"); err == nil {
+		t.Fatal("dropping a missing column succeeded")
+	}
+	if c.Table("greptime", "public", "t") == nil {
+		t.Error("failed Alter forgot the table")
+	}
+	if err := c.Alter(ctx, &greptimev1.AlterExpr{
+		TableName: "t",
+		Kind: &greptimev1.AlterExpr_AddColumns{AddColumns: &greptimev1.AddColumns{AddColumns: []*greptimev1.AddColumn{{
+			ColumnDef: &greptimev1.ColumnDef{Name: "v", Datatype: greptimev1.ColumnDataType_INT64, IsNullable: true},
+		}}}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if expr := c.Table("greptime", "public", "t"); expr != nil {
+		t.Errorf("Alter kept the table %v", expr)
+	}
+}
@@ -0,0 +1,247 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	greptimev1 "github.com/GreptimeTeam/greptime-proto/go/greptime/v1"
+	"github.com/apache/arrow/go/v11/arrow"
+	"github.com/apache/arrow/go/v11/arrow/array"
+	"github.com/apache/arrow/go/v11/arrow/flight"
+	"google.golang.org/protobuf/proto"
+)
+
+// QueryResult is the result of a query sent over Arrow Flight. Statements
+// that don't return rows, like INSERT or DDL, only report AffectedRows;
+// the others stream record batches read with Next and Record.
+//
+// A QueryResult must be released once read.
+type QueryResult struct {
+	// AffectedRows is the number of rows affected by a statement that
+	// returns no records.
+	AffectedRows uint32
+
+	reader *flight.Reader
+	cancel context.CancelFunc
+}
+
+// HasRecords reports whether the query returned records rather than a
+// number of affected rows.
+func (r *QueryResult) HasRecords() bool {
+	return r.reader != nil
+}
+
+// Schema returns the schema of the records, nil if the query returned
+// none.
+func (r *QueryResult) Schema() *arrow.Schema {
+	if r.reader == nil {
+		return nil
+	}
+	return r.reader.Schema()
+}
+
+// Next advances to the next record batch, returning false at the end of
+// the stream or on error, see Err.
+func (r *QueryResult) Next() bool {
+	return r.reader != nil && r.reader.Next()
+}
+
+// Record returns the current record batch. It is valid until the next call
+// to Next unless retained.
+func (r *QueryResult) Record() arrow.Record {
+	return r.reader.Record()
+}
+
+// Err returns the error that stopped Next, nil at the end of the stream.
+func (r *QueryResult) Err() error {
+	if r.reader == nil {
+		return nil
+	}
+	return r.reader.Err()
+}
+
+// Release releases the records and ends the stream.
+func (r *QueryResult) Release() {
+	if r.reader != nil {
+		r.reader.Release()
+		r.reader = nil
+	}
+	if r.cancel != nil {
+		r.cancel()
+	}
+}
+
+// Rows reads the remaining record batches and decodes them into rows, see
+// RecordRows for the Go types of the values.
+func (r *QueryResult) Rows() ([][]any, error) {
+	var rows [][]any
+	for r.Next() {
+		batch, err := RecordRows(r.Record())
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, batch...)
+	}
+	return rows, r.Err()
+}
+
+// RecordRows decodes a record batch into one value per column and row,
+// nil for nulls. Values are bool, int8 to int64, uint8 to uint64, float32,
+// float64, string, []byte, time.Time in UTC for timestamps and dates, and
+// time.Duration since midnight for times, like Column.Decode.
+func RecordRows(rec arrow.Record) ([][]any, error) {
+	rows := make([][]any, rec.NumRows())
+	for i := range rows {
+		rows[i] = make([]any, rec.NumCols())
+	}
+	for j, col := range rec.Columns() {
+		for i := range rows {
+			v, err := arrayValue(col, i)
+			if err != nil {
+				return nil, fmt.Errorf("column %q: %w", rec.ColumnName(j), err)
+			}
+			rows[i][j] = v
+		}
+	}
+	return rows, nil
+}
+
+// arrayValue returns the i-th value of arr as its Go type.
+func arrayValue(arr arrow.Array, i int) (any, error) {
+	if arr.IsNull(i) {
+		return nil, nil
+	}
+	switch a := arr.(type) {
+	case *array.Boolean:
+		return a.Value(i), nil
+	case *array.Int8:
+		return a.Value(i), nil
+	case *array.Int16:
+		return a.Value(i), nil
+	case *array.Int32:
+		return a.Value(i), nil
+	case *array.Int64:
+		return a.Value(i), nil
+	case *array.Uint8:
+		return a.Value(i), nil
+	case *array.Uint16:
+		return a.Value(i), nil
+	case *array.Uint32:
+		return a.Value(i), nil
+	case *array.Uint64:
+		return a.Value(i), nil
+	case *array.Float32:
+		return a.Value(i), nil
+	case *array.Float64:
+		return a.Value(i), nil
+	case *array.String:
+		return a.Value(i), nil
+	case *array.LargeString:
+		return a.Value(i), nil
+	case *array.Binary:
+		return append([]byte(nil), a.Value(i)...), nil
+	case *array.LargeBinary:
+		return append([]byte(nil), a.Value(i)...), nil
+	case *array.Date32:
+		return a.Value(i).ToTime(), nil
+	case *array.Date64:
+		// Date64.ToTime truncates to the day, dropping the time of
+		// DATETIME values.
+		return time.UnixMilli(int64(a.Value(i))).UTC(), nil
+	case *array.Timestamp:
+		return a.Value(i).ToTime(a.DataType().(*arrow.TimestampType).Unit), nil
+	case *array.Time32:
+		return time.Duration(a.Value(i)) * a.DataType().(*arrow.Time32Type).Unit.Multiplier(), nil
+	case *array.Time64:
+		return time.Duration(a.Value(i)) * a.DataType().(*arrow.Time64Type).Unit.Multiplier(), nil
+	}
+	return nil, fmt.Errorf("unsupported arrow type %s", arr.DataType())
+}
+
+// peekedStream replays the first message of a Flight stream, read to tell
+// affected rows from records, before the rest of the stream.
+type peekedStream struct {
+	first  *flight.FlightData
+	stream flight.DataStreamReader
+}
+
+func (s *peekedStream) Recv() (*flight.FlightData, error) {
+	if first := s.first; first != nil {
+		s.first = nil
+		return first, nil
+	}
+	return s.stream.Recv()
+}
+
+// Query runs a query over Arrow Flight, the GreptimeRequest holding it
+// being the ticket of a DoGet call. The client's timeout bounds the call
+// until the result is released.
+func (c *Client) Query(ctx context.Context, req *greptimev1.QueryRequest) (*QueryResult, error) {
+	ticket, err := proto.Marshal(&greptimev1.GreptimeRequest{
+		Header:  c.opts.header,
+		Request: &greptimev1.GreptimeRequest_Query{Query: req},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := c.withTimeout(ctx)
+	var (
+		stream flight.FlightService_DoGetClient
+		first  *flight.FlightData
+	)
+	err = c.retry(ctx, func(ctx context.Context) (err error) {
+		stream, err = c.flight.DoGet(ctx, &flight.Ticket{Ticket: ticket})
+		if err != nil {
+			return err
+		}
+		// Errors of a stream surface with its first message.
+		first, err = stream.Recv()
+		return err
+	})
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	if len(first.DataHeader) == 0 && len(first.AppMetadata) > 0 {
+		defer cancel()
+		var metadata greptimev1.FlightMetadata
+		if err := proto.Unmarshal(first.AppMetadata, &metadata); err != nil {
+			return nil, fmt.Errorf("decode flight metadata: %w", err)
+		}
+		return &QueryResult{AffectedRows: metadata.GetAffectedRows().GetValue()}, nil
+	}
+	reader, err := flight.NewRecordReader(&peekedStream{first: first, stream: stream})
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &QueryResult{reader: reader, cancel: cancel}, nil
+}
+
+// QuerySQL runs a SQL query.
+func (c *Client) QuerySQL(ctx context.Context, sql string) (*QueryResult, error) {
+	return c.Query(ctx, &greptimev1.QueryRequest{Query: &greptimev1.QueryRequest_Sql{Sql: sql}})
+}
+
+// QueryPromRange runs a PromQL range query, returning its series as
+// records.
+func (c *Client) QueryPromRange(ctx context.Context, query *greptimev1.PromRangeQuery) (*QueryResult, error) {
+	return c.Query(ctx, &greptimev1.QueryRequest{Query: &greptimev1.QueryRequest_PromRangeQuery{PromRangeQuery: query}})
+}
@@ -0,0 +1,279 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	greptimev1 "github.com/GreptimeTeam/greptime-proto/go/greptime/v1"
+	"github.com/apache/arrow/go/v11/arrow"
+	"github.com/apache/arrow/go/v11/arrow/array"
+	"github.com/apache/arrow/go/v11/arrow/decimal128"
+	"github.com/apache/arrow/go/v11/arrow/flight"
+	"github.com/apache/arrow/go/v11/arrow/ipc"
+	"github.com/apache/arrow/go/v11/arrow/memory"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+// datetime has a time of day, which DATETIME values must keep.
+var datetime = time.Date(2023, 5, 6, 7, 8, 9, 10e6, time.UTC)
+
+// typedRecord returns a record of one column per Arrow type RecordRows
+// decodes, the first row holding values and the second nulls, with the
+// values expected of its rows.
+func typedRecord() (arrow.Record, [][]any) {
+	fields := []struct {
+		typ   arrow.DataType
+		value any
+		want  any
+	}{
+		{arrow.FixedWidthTypes.Boolean, true, true},
+		{arrow.PrimitiveTypes.Int8, int8(-8), int8(-8)},
+		{arrow.PrimitiveTypes.Int16, int16(-16), int16(-16)},
+		{arrow.PrimitiveTypes.Int32, int32(-32), int32(-32)},
+		{arrow.PrimitiveTypes.Int64, int64(-64), int64(-64)},
+		{arrow.PrimitiveTypes.Uint8, uint8(8), uint8(8)},
+		{arrow.PrimitiveTypes.Uint16, uint16(16), uint16(16)},
+		{arrow.PrimitiveTypes.Uint32, uint32(32), uint32(32)},
+		{arrow.PrimitiveTypes.Uint64, uint64(64), uint64(64)},
+		{arrow.PrimitiveTypes.Float32, float32(0.5), float32(0.5)},
+		{arrow.PrimitiveTypes.Float64, 1.5, 1.5},
+		{arrow.BinaryTypes.String, "s", "s"},
+		{arrow.BinaryTypes.LargeString, "large", "large"},
+		{arrow.BinaryTypes.Binary, []byte{0, 255}, []byte{0, 255}},
+		{arrow.BinaryTypes.LargeBinary, []byte{1}, []byte{1}},
+		{arrow.FixedWidthTypes.Date32, arrow.Date32(2), time.Unix(2*86400, 0).UTC()},
+		{arrow.FixedWidthTypes.Date64, arrow.Date64(datetime.UnixMilli()), datetime},
+		{arrow.FixedWidthTypes.Timestamp_s, arrow.Timestamp(-1), time.Unix(-1, 0).UTC()},
+		{arrow.FixedWidthTypes.Timestamp_ms, arrow.Timestamp(1500), time.UnixMilli(1500).UTC()},
+		{arrow.FixedWidthTypes.Timestamp_us, arrow.Timestamp(1500), time.UnixMicro(1500).UTC()},
+		{arrow.FixedWidthTypes.Timestamp_ns, arrow.Timestamp(1500), time.Unix(0, 1500).UTC()},
+		{arrow.FixedWidthTypes.Time32s, arrow.Time32(3600), time.Hour},
+		{arrow.FixedWidthTypes.Time32ms, arrow.Time32(1000), time.Second},
+		{arrow.FixedWidthTypes.Time64us, arrow.Time64(1000), time.Millisecond},
+		{arrow.FixedWidthTypes.Time64ns, arrow.Time64(1000), time.Microsecond},
+	}
+	schemaFields := make([]arrow.Field, len(fields))
+	for j, f := range fields {
+		schemaFields[j] = arrow.Field{Name: f.typ.String(), Type: f.typ, Nullable: true}
+	}
+	b := array.NewRecordBuilder(memory.DefaultAllocator, arrow.NewSchema(schemaFields, nil))
+	defer b.Release()
+	want := [][]any{make([]any, len(fields)), make([]any, len(fields))}
+	for j, f := range fields {
+		switch fb := b.Field(j).(type) {
+		case *array.BooleanBuilder:
+			fb.Append(f.value.(bool))
+		case *array.Int8Builder:
+			fb.Append(f.value.(int8))
+		case *array.Int16Builder:
+			fb.Append(f.value.(int16))
+		case *array.Int32Builder:
+			fb.Append(f.value.(int32))
+		case *array.Int64Builder:
+			fb.Append(f.value.(int64))
+		case *array.Uint8Builder:
+			fb.Append(f.value.(uint8))
+		case *array.Uint16Builder:
+			fb.Append(f.value.(uint16))
+		case *array.Uint32Builder:
+			fb.Append(f.value.(uint32))
+		case *array.Uint64Builder:
+			fb.Append(f.value.(uint64))
+		case *array.Float32Builder:
+			fb.Append(f.value.(float32))
+		case *array.Float64Builder:
+			fb.Append(f.value.(float64))
+		case *array.StringBuilder:
+			fb.Append(f.value.(string))
+		case *array.LargeStringBuilder:
+			fb.Append(f.value.(string))
+		case *array.BinaryBuilder:
+			fb.Append(f.value.([]byte))
+		case *array.Date32Builder:
+			fb.Append(f.value.(arrow.Date32))
+		case *array.Date64Builder:
+			fb.Append(f.value.(arrow.Date64))
+		case *array.TimestampBuilder:
+			fb.Append(f.value.(arrow.Timestamp))
+		case *array.Time32Builder:
+			fb.Append(f.value.(arrow.Time32))
+		case *array.Time64Builder:
+			fb.Append(f.value.(arrow.Time64))
+		default:
+			panic(fmt.Sprintf("no builder for %s", f.typ))
+		}
+		b.Field(j).AppendNull()
+		want[0][j] = f.want
+	}
+	return b.NewRecord(), want
+}
+
+func TestRecordRows(t *testing.T) {
+	rec, want := typedRecord()
+	defer rec.Release()
+	got, err := RecordRows(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("RecordRows() = %d rows, want %d", len(got), len(want))
+	}
+	for i := range want {
+		for j := range want[i] {
+			if !reflect.DeepEqual(got[i][j], want[i][j]) {
+				t.Errorf("row %d column %s = %#v, want %#v", i, rec.ColumnName(j), got[i][j], want[i][j])
+			}
+		}
+	}
+}
+
+func TestRecordRowsUnsupported(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{{Name: "d", Type: &arrow.Decimal128Type{Precision: 10, Scale: 2}}}, nil)
+	b := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	defer b.Release()
+	b.Field(0).(*array.Decimal128Builder).Append(decimal128.FromI64(1))
+	rec := b.NewRecord()
+	defer rec.Release()
+	if rows, err := RecordRows(rec); err == nil {
+		t.Errorf("RecordRows() of a decimal column = %v, want an error", rows)
+	}
+}
+
+// flightServer answers DoGet calls with err, else with the records or,
+// if there are none, with the affected rows as metadata, and records the
+// request of the last ticket.
+type flightServer struct {
+	flight.BaseFlightServer
+	records  []arrow.Record
+	affected uint32
+	err      error
+	req      *greptimev1.GreptimeRequest
+}
+
+func (s *flightServer) DoGet(ticket *flight.Ticket, stream flight.FlightService_DoGetServer) error {
+	s.req = &greptimev1.GreptimeRequest{}
+	if err := proto.Unmarshal(ticket.GetTicket(), s.req); err != nil {
+		return err
+	}
+	if s.err != nil {
+		return s.err
+	}
+	if len(s.records) == 0 {
+		metadata, err := proto.Marshal(&greptimev1.FlightMetadata{AffectedRows: &greptimev1.AffectedRows{Value: s.affected}})
+		if err != nil {
+			return err
+		}
+		return stream.Send(&flight.FlightData{AppMetadata: metadata})
+	}
+	w := flight.NewRecordWriter(stream, ipc.WithSchema(s.records[0].Schema()))
+	defer w.Close()
+	for _, rec := range s.records {
+		if err := w.Write(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newFlightClient returns a client of a Flight server serving srv.
+func newFlightClient(t *testing.T, srv *flightServer) *Client {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	flight.RegisterFlightServiceServer(s, srv)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return NewFromConn(conn, WithDatabase("db"))
+}
+
+func TestQueryAffectedRows(t *testing.T) {
+	srv := &flightServer{affected: 3}
+	c := newFlightClient(t, srv)
+	res, err := c.QuerySQL(context.Background(), "INSERT INTO t VALUES (1), (2), (3)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Release()
+	if res.HasRecords() || res.Schema() != nil || res.Next() || res.Err() != nil {
+		t.Errorf("QuerySQL() of an INSERT has records")
+	}
+	if res.AffectedRows != 3 {
+		t.Errorf("AffectedRows = %d, want 3", res.AffectedRows)
+	}
+	if got := srv.req.GetQuery().GetSql(); got != "INSERT INTO t VALUES (1), (2), (3)" {
+		t.Errorf("ticket SQL = %q", got)
+	}
+	if got := srv.req.GetHeader().GetDbname(); got != "db" {
+		t.Errorf("ticket database = %q, want db", got)
+	}
+}
+
+func TestQueryRecords(t *testing.T) {
+	rec, want := typedRecord()
+	defer rec.Release()
+	// The schema message is peeked, then replayed ahead of the batches.
+	srv := &flightServer{records: []arrow.Record{rec, rec}}
+	c := newFlightClient(t, srv)
+	query := &greptimev1.PromRangeQuery{Query: "up", Start: "0", End: "10", Step: "5s"}
+	res, err := c.QueryPromRange(context.Background(), query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Release()
+	if !res.HasRecords() {
+		t.Fatal("QueryPromRange() has no records")
+	}
+	if !res.Schema().Equal(rec.Schema()) {
+		t.Errorf("Schema() = %v, want %v", res.Schema(), rec.Schema())
+	}
+	rows, err := res.Rows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := append(want, want...); !reflect.DeepEqual(rows, want) {
+		t.Errorf("Rows() = %v, want %v", rows, want)
+	}
+	if !proto.Equal(srv.req.GetQuery().GetPromRangeQuery(), query) {
+		t.Errorf("ticket query = %v, want %v", srv.req.GetQuery(), query)
+	}
+}
+
+func TestQueryError(t *testing.T) {
+	c := newFlightClient(t, &flightServer{err: status.Error(codes.InvalidArgument, "bad query")})
+	res, err := c.QuerySQL(context.Background(), "SELEC 1")
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("QuerySQL() = %v, %v, want InvalidArgument", res, err)
+	}
+}
@@ -0,0 +1,252 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+
+	greptimev1 "github.com/GreptimeTeam/greptime-proto/go/greptime/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// SessionOptions configures a Session. Zero fields take their default.
+type SessionOptions struct {
+	// MaxInFlightBytes bounds the encoded size of the requests sent on a
+	// stream and not acknowledged by the server yet, 8 MiB by default. Once
+	// reached, the stream is closed to acknowledge them and a new one is
+	// opened by the next push.
+	MaxInFlightBytes int
+}
+
+func (o *SessionOptions) withDefaults() SessionOptions {
+	opts := *o
+	if opts.MaxInFlightBytes <= 0 {
+		opts.MaxInFlightBytes = 8 << 20
+	}
+	return opts
+}
+
+// Session pushes inserts and deletes onto a HandleRequests stream. It is
+// safe for concurrent use, pushes being sent in turn.
+//
+// The server acknowledges the requests of a stream once it is closed, so
+// a stream is closed whenever the in-flight byte budget is reached, and
+// at Close. A stream broken with a retryable status code is reopened with
+// the client's retry policy and its unacknowledged requests sent again,
+// which may write some of them twice; GreptimeDB keeps the last of the
+// rows having the same primary key and timestamp.
+type Session struct {
+	client *Client
+	opts   SessionOptions
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// sem is held to use the stream and the fields below.
+	sem      chan struct{}
+	stream   greptimev1.GreptimeDatabase_HandleRequestsClient
+	unacked  []*greptimev1.GreptimeRequest
+	inFlight int
+	closed   bool
+	err      error
+
+	affected uint32
+}
+
+// NewSession returns a session whose streams live until ctx is done or the
+// session is closed. Streams are opened on demand.
+func (c *Client) NewSession(ctx context.Context, opts SessionOptions) *Session {
+	s := &Session{
+		client: c,
+		opts:   opts.withDefaults(),
+		sem:    make(chan struct{}, 1),
+	}
+	s.ctx, s.cancel = context.WithCancel(ctx)
+	return s
+}
+
+// Insert validates and pushes the requests as one message, after adding
+// the columns missing from known tables with WithSchemaEvolution.
+func (s *Session) Insert(ctx context.Context, reqs ...*greptimev1.InsertRequest) error {
+	inserts := &greptimev1.InsertRequests{Inserts: reqs}
+	if err := inserts.Validate(); err != nil {
+		return err
+	}
+	if s.client.evolver != nil {
+		if err := s.client.evolver.evolve(ctx, s.client.opts.header, reqs); err != nil {
+			return err
+		}
+	}
+	return s.push(ctx, &greptimev1.GreptimeRequest{
+		Request: &greptimev1.GreptimeRequest_Inserts{Inserts: inserts},
+	})
+}
+
+// Delete validates and pushes the request.
+func (s *Session) Delete(ctx context.Context, req *greptimev1.DeleteRequest) error {
+	if err := req.Validate(); err != nil {
+		return err
+	}
+	return s.push(ctx, &greptimev1.GreptimeRequest{
+		Request: &greptimev1.GreptimeRequest_Delete{Delete: req},
+	})
+}
+
+// AffectedRows returns the rows the server reported as affected by the
+// streams closed so far.
+func (s *Session) AffectedRows() uint32 {
+	return atomic.LoadUint32(&s.affected)
+}
+
+// Close closes the stream and returns the rows affected by every request
+// of the session. Once a push has failed, the session is unusable and
+// Close returns its error. Later pushes fail with ErrClosed.
+func (s *Session) Close(ctx context.Context) (uint32, error) {
+	if err := s.acquire(ctx); err != nil {
+		return s.AffectedRows(), err
+	}
+	defer s.release()
+	if s.closed {
+		return s.AffectedRows(), ErrClosed
+	}
+	s.closed = true
+	defer s.cancel()
+	if s.err != nil {
+		return s.AffectedRows(), s.err
+	}
+	err := s.commit(ctx)
+	return s.AffectedRows(), err
+}
+
+func (s *Session) acquire(ctx context.Context) error {
+	select {
+	case s.sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Session) release() {
+	<-s.sem
+}
+
+func (s *Session) push(ctx context.Context, req *greptimev1.GreptimeRequest) error {
+	req.Header = s.client.opts.header
+	size := proto.Size(req)
+
+	if err := s.acquire(ctx); err != nil {
+		return err
+	}
+	defer s.release()
+	if s.closed {
+		return ErrClosed
+	}
+	if s.err != nil {
+		return s.err
+	}
+	if s.inFlight > 0 && s.inFlight+size > s.opts.MaxInFlightBytes {
+		if err := s.commit(ctx); err != nil {
+			s.fail(err)
+			return err
+		}
+	}
+	s.unacked = append(s.unacked, req)
+	s.inFlight += size
+	if err := s.send(ctx, req); err != nil {
+		s.fail(err)
+		return err
+	}
+	return nil
+}
+
+// fail makes err sticky and abandons the stream.
+func (s *Session) fail(err error) {
+	s.err = err
+	s.stream = nil
+	s.cancel()
+}
+
+// send sends req, the last unacknowledged request, reopening the stream if
+// it is broken.
+func (s *Session) send(ctx context.Context, req *greptimev1.GreptimeRequest) error {
+	if s.stream != nil {
+		err := s.stream.Send(req)
+		if err == nil {
+			return nil
+		}
+		err = brokenStatus(s.stream)
+		s.stream = nil
+		if !s.client.opts.retry.retryable(err) {
+			return err
+		}
+	}
+	return s.client.retry(ctx, func(context.Context) error {
+		return s.resend()
+	})
+}
+
+// resend opens a stream and sends the unacknowledged requests on it.
+func (s *Session) resend() error {
+	stream, err := s.client.database.HandleRequests(s.ctx)
+	if err != nil {
+		return err
+	}
+	for _, req := range s.unacked {
+		if err := stream.Send(req); err != nil {
+			return brokenStatus(stream)
+		}
+	}
+	s.stream = stream
+	return nil
+}
+
+// commit closes the stream, adding the rows it affected, reopening it if
+// it is broken.
+func (s *Session) commit(ctx context.Context) error {
+	if len(s.unacked) == 0 {
+		return nil
+	}
+	err := s.client.retry(ctx, func(context.Context) error {
+		if s.stream == nil {
+			if err := s.resend(); err != nil {
+				return err
+			}
+		}
+		resp, err := s.stream.CloseAndRecv()
+		s.stream = nil
+		if err != nil {
+			return err
+		}
+		atomic.AddUint32(&s.affected, resp.GetAffectedRows().GetValue())
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.unacked = nil
+	s.inFlight = 0
+	return nil
+}
+
+// brokenStatus returns the status of a stream Send failed on.
+func brokenStatus(stream greptimev1.GreptimeDatabase_HandleRequestsClient) error {
+	// The status of a broken stream is reported by CloseAndRecv.
+	if _, err := stream.CloseAndRecv(); err != nil {
+		return err
+	}
+	return errors.New("stream closed by the server")
+}
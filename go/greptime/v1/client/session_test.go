@@ -0,0 +1,207 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	greptimev1 "github.com/GreptimeTeam/greptime-proto/go/greptime/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// streamingClient serves HandleRequests streams, answering the rows of the
+// inserts of a stream as affected once it is closed, and records the
+// tables of the inserts of every committed stream.
+type streamingClient struct {
+	opened    int
+	committed [][]string
+	// broken, if set, breaks the open stream at its next Send or
+	// CloseAndRecv, which fails with it.
+	broken error
+}
+
+func (c *streamingClient) Handle(context.Context, *greptimev1.GreptimeRequest, ...grpc.CallOption) (*greptimev1.GreptimeResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c *streamingClient) HandleRequests(context.Context, ...grpc.CallOption) (greptimev1.GreptimeDatabase_HandleRequestsClient, error) {
+	c.opened++
+	return &fakeStream{client: c}, nil
+}
+
+type fakeStream struct {
+	grpc.ClientStream
+	client *streamingClient
+	tables []string
+	rows   uint32
+	err    error
+}
+
+func (s *fakeStream) Send(req *greptimev1.GreptimeRequest) error {
+	if s.err == nil && s.client.broken != nil {
+		s.err, s.client.broken = s.client.broken, nil
+	}
+	if s.err != nil {
+		return io.EOF
+	}
+	for _, insert := range req.GetInserts().GetInserts() {
+		s.tables = append(s.tables, insert.GetTableName())
+		s.rows += insert.GetRowCount()
+	}
+	return nil
+}
+
+func (s *fakeStream) CloseAndRecv() (*greptimev1.GreptimeResponse, error) {
+	if s.err == nil && s.client.broken != nil {
+		s.err, s.client.broken = s.client.broken, nil
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+	s.client.committed = append(s.client.committed, s.tables)
+	return affected(s.rows), nil
+}
+
+// newStreamingSession returns a session of a streamingClient, retrying
+// Unavailable without backoff.
+func newStreamingSession(opts SessionOptions) (*Session, *streamingClient) {
+	c := newClient(nil, []Option{WithRetryPolicy(RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+		Codes:          []codes.Code{codes.Unavailable},
+	})})
+	database := &streamingClient{}
+	c.database = database
+	return c.NewSession(context.Background(), opts), database
+}
+
+func insert(t *testing.T, s *Session, tables ...string) {
+	t.Helper()
+	for _, table := range tables {
+		if err := s.Insert(context.Background(), rowsInsert(table, 2)); err != nil {
+			t.Fatalf("Insert(%s) = %v", table, err)
+		}
+	}
+}
+
+func TestSessionCommit(t *testing.T) {
+	tests := []struct {
+		name string
+		opts SessionOptions
+		// committed are the tables of the streams committed before
+		// Close.
+		committed [][]string
+	}{
+		{"default budget", SessionOptions{}, nil},
+		// Every push but the first reaches the budget.
+		{"budget", SessionOptions{MaxInFlightBytes: 1}, [][]string{{"a"}, {"b"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, database := newStreamingSession(tt.opts)
+			insert(t, s, "a", "b", "c")
+			if !reflect.DeepEqual(database.committed, tt.committed) {
+				t.Errorf("committed before Close = %v, want %v", database.committed, tt.committed)
+			}
+			if got, want := s.AffectedRows(), uint32(2*len(tt.committed)); got != want {
+				t.Errorf("AffectedRows() = %d, want %d", got, want)
+			}
+			affected, err := s.Close(context.Background())
+			if err != nil || affected != 6 {
+				t.Errorf("Close() = %d, %v, want 6", affected, err)
+			}
+			var tables []string
+			for _, stream := range database.committed {
+				tables = append(tables, stream...)
+			}
+			if want := []string{"a", "b", "c"}; !reflect.DeepEqual(tables, want) {
+				t.Errorf("committed tables = %v, want %v", tables, want)
+			}
+			if err := s.Insert(context.Background(), rowsInsert("d", 1)); err != ErrClosed {
+				t.Errorf("Insert() after Close = %v, want ErrClosed", err)
+			}
+		})
+	}
+}
+
+func TestSessionRetry(t *testing.T) {
+	s, database := newStreamingSession(SessionOptions{})
+	unavailable := status.Error(codes.Unavailable, "connection reset")
+	insert(t, s, "a")
+	// The stream breaks sending b, then again closing: each time a new
+	// stream is opened with a and b.
+	database.broken = unavailable
+	insert(t, s, "b")
+	database.broken = unavailable
+	affected, err := s.Close(context.Background())
+	if err != nil || affected != 4 {
+		t.Errorf("Close() = %d, %v, want 4", affected, err)
+	}
+	if database.opened != 3 {
+		t.Errorf("opened %d streams, want 3", database.opened)
+	}
+	if want := [][]string{{"a", "b"}}; !reflect.DeepEqual(database.committed, want) {
+		t.Errorf("committed = %v, want %v", database.committed, want)
+	}
+}
+
+func TestSessionError(t *testing.T) {
+	tests := []struct {
+		name string
+		opts SessionOptions
+	}{
+		{"send", SessionOptions{}},
+		// The stream breaks closing it at the budget.
+		{"commit", SessionOptions{MaxInFlightBytes: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, database := newStreamingSession(tt.opts)
+			insert(t, s, "a")
+			database.broken = status.Error(codes.InvalidArgument, "table not found")
+			err := s.Insert(context.Background(), rowsInsert("b", 2))
+			if status.Code(err) != codes.InvalidArgument {
+				t.Fatalf("Insert() = %v, want InvalidArgument", err)
+			}
+			if database.opened != 1 {
+				t.Errorf("opened %d streams, want 1", database.opened)
+			}
+			// The error sticks without reaching the server.
+			if got := s.Insert(context.Background(), rowsInsert("c", 2)); got != err {
+				t.Errorf("Insert() after an error = %v, want %v", got, err)
+			}
+			if got := s.Delete(context.Background(), &greptimev1.DeleteRequest{TableName: "c"}); got != err {
+				t.Errorf("Delete() after an error = %v, want %v", got, err)
+			}
+			if affected, got := s.Close(context.Background()); got != err || affected != 0 {
+				t.Errorf("Close() = %d, %v, want 0, %v", affected, got, err)
+			}
+			if _, got := s.Close(context.Background()); got != ErrClosed {
+				t.Errorf("second Close() = %v, want ErrClosed", got)
+			}
+			if database.opened != 1 || database.committed != nil {
+				t.Errorf("opened %d streams, committed %v, want 1 and none", database.opened, database.committed)
+			}
+		})
+	}
+}
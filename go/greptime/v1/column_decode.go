@@ -0,0 +1,289 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"fmt"
+	"time"
+)
+
+// valueCount returns the number of values stored in the field of values
+// that holds datatype.
+func valueCount(values *Column_Values, datatype ColumnDataType) int {
+	switch datatype {
+	case ColumnDataType_BOOLEAN:
+		return len(values.GetBoolValues())
+	case ColumnDataType_INT8:
+		return len(values.GetI8Values())
+	case ColumnDataType_INT16:
+		return len(values.GetI16Values())
+	case ColumnDataType_INT32:
+		return len(values.GetI32Values())
+	case ColumnDataType_INT64:
+		return len(values.GetI64Values())
+	case ColumnDataType_UINT8:
+		return len(values.GetU8Values())
+	case ColumnDataType_UINT16:
+		return len(values.GetU16Values())
+	case ColumnDataType_UINT32:
+		return len(values.GetU32Values())
+	case ColumnDataType_UINT64:
+		return len(values.GetU64Values())
+	case ColumnDataType_FLOAT32:
+		return len(values.GetF32Values())
+	case ColumnDataType_FLOAT64:
+		return len(values.GetF64Values())
+	case ColumnDataType_BINARY:
+		return len(values.GetBinaryValues())
+	case ColumnDataType_STRING:
+		return len(values.GetStringValues())
+	case ColumnDataType_DATE:
+		return len(values.GetDateValues())
+	case ColumnDataType_DATETIME:
+		return len(values.GetDatetimeValues())
+	case ColumnDataType_TIMESTAMP_SECOND:
+		return len(values.GetTsSecondValues())
+	case ColumnDataType_TIMESTAMP_MILLISECOND:
+		return len(values.GetTsMillisecondValues())
+	case ColumnDataType_TIMESTAMP_MICROSECOND:
+		return len(values.GetTsMicrosecondValues())
+	case ColumnDataType_TIMESTAMP_NANOSECOND:
+		return len(values.GetTsNanosecondValues())
+	case ColumnDataType_TIME_SECOND:
+		return len(values.GetTimeSecondValues())
+	case ColumnDataType_TIME_MILLISECOND:
+		return len(values.GetTimeMillisecondValues())
+	case ColumnDataType_TIME_MICROSECOND:
+		return len(values.GetTimeMicrosecondValues())
+	case ColumnDataType_TIME_NANOSECOND:
+		return len(values.GetTimeNanosecondValues())
+	}
+	return 0
+}
+
+// fromTicks converts a number of units since the UNIX epoch to a UTC time.
+func fromTicks(ticks int64, unit time.Duration) time.Time {
+	switch unit {
+	case time.Second:
+		return time.Unix(ticks, 0).UTC()
+	case time.Millisecond:
+		return time.UnixMilli(ticks).UTC()
+	case time.Microsecond:
+		return time.UnixMicro(ticks).UTC()
+	default:
+		return time.Unix(0, ticks).UTC()
+	}
+}
+
+// valueAt returns the i-th value stored for datatype as its Go type:
+// bool, the sized Go integer and float types, []byte, string, time.Time in
+// UTC for DATE, DATETIME and TIMESTAMP_*, and time.Duration since midnight
+// for TIME_*.
+func valueAt(values *Column_Values, datatype ColumnDataType, i int) any {
+	switch datatype {
+	case ColumnDataType_BOOLEAN:
+		return values.BoolValues[i]
+	case ColumnDataType_INT8:
+		return int8(values.I8Values[i])
+	case ColumnDataType_INT16:
+		return int16(values.I16Values[i])
+	case ColumnDataType_INT32:
+		return values.I32Values[i]
+	case ColumnDataType_INT64:
+		return values.I64Values[i]
+	case ColumnDataType_UINT8:
+		return uint8(values.U8Values[i])
+	case ColumnDataType_UINT16:
+		return uint16(values.U16Values[i])
+	case ColumnDataType_UINT32:
+		return values.U32Values[i]
+	case ColumnDataType_UINT64:
+		return values.U64Values[i]
+	case ColumnDataType_FLOAT32:
+		return values.F32Values[i]
+	case ColumnDataType_FLOAT64:
+		return values.F64Values[i]
+	case ColumnDataType_BINARY:
+		return values.BinaryValues[i]
+	case ColumnDataType_STRING:
+		return values.StringValues[i]
+	case ColumnDataType_DATE:
+		return time.Unix(int64(values.DateValues[i])*86400, 0).UTC()
+	case ColumnDataType_DATETIME:
+		return fromTicks(values.DatetimeValues[i], time.Millisecond)
+	case ColumnDataType_TIMESTAMP_SECOND:
+		return fromTicks(values.TsSecondValues[i], time.Second)
+	case ColumnDataType_TIMESTAMP_MILLISECOND:
+		return fromTicks(values.TsMillisecondValues[i], time.Millisecond)
+	case ColumnDataType_TIMESTAMP_MICROSECOND:
+		return fromTicks(values.TsMicrosecondValues[i], time.Microsecond)
+	case ColumnDataType_TIMESTAMP_NANOSECOND:
+		return fromTicks(values.TsNanosecondValues[i], time.Nanosecond)
+	case ColumnDataType_TIME_SECOND:
+		return time.Duration(values.TimeSecondValues[i]) * time.Second
+	case ColumnDataType_TIME_MILLISECOND:
+		return time.Duration(values.TimeMillisecondValues[i]) * time.Millisecond
+	case ColumnDataType_TIME_MICROSECOND:
+		return time.Duration(values.TimeMicrosecondValues[i]) * time.Microsecond
+	case ColumnDataType_TIME_NANOSECOND:
+		return time.Duration(values.TimeNanosecondValues[i])
+	}
+	return nil
+}
+
+// ColumnReader iterates over the rows of a Column, expanding the null mask
+// so that every row yields either a value or a null.
+type ColumnReader struct {
+	column   *Column
+	nulls    *Bitmap
+	rowCount int
+	row      int
+	next     int
+	null     bool
+}
+
+// NewColumnReader returns a reader over the first rowCount rows of column.
+// It fails for a negative rowCount, and if the number of values and nulls
+// in the column don't add up to rowCount.
+func NewColumnReader(column *Column, rowCount int) (*ColumnReader, error) {
+	if rowCount < 0 {
+		return nil, fmt.Errorf("column %q: negative row count %d", column.GetColumnName(), rowCount)
+	}
+	mask, err := BitmapFromBytes(column.GetNullMask(), rowCount)
+	if err != nil {
+		return nil, fmt.Errorf("column %q: null mask: %w", column.GetColumnName(), err)
+	}
+	nulls := mask.Count()
+	if n := valueCount(column.GetValues(), column.GetDatatype()); n != rowCount-nulls {
+		return nil, fmt.Errorf("column %q: expect %d %s values for %d rows with %d nulls, got %d",
+			column.GetColumnName(), rowCount-nulls, column.GetDatatype(), rowCount, nulls, n)
+	}
+	return &ColumnReader{column: column, nulls: mask, rowCount: rowCount, row: -1}, nil
+}
+
+// Next advances to the next row, returning false after the last one.
+func (r *ColumnReader) Next() bool {
+	if r.row >= 0 && !r.null {
+		r.next++
+	}
+	if r.row+1 >= r.rowCount {
+		r.row = r.rowCount
+		return false
+	}
+	r.row++
+	r.null = r.nulls.Test(r.row)
+	return true
+}
+
+// Row returns the index of the current row.
+func (r *ColumnReader) Row() int {
+	return r.row
+}
+
+// IsNull reports whether the current row is null.
+func (r *ColumnReader) IsNull() bool {
+	return r.null
+}
+
+// Value returns the value of the current row, or nil if it is null. See
+// Column.Decode for the Go types of the values.
+func (r *ColumnReader) Value() any {
+	if r.null {
+		return nil
+	}
+	return valueAt(r.column.Values, r.column.Datatype, r.next)
+}
+
+// Decode expands the column into one value per row, nil for null rows.
+// Values are bool, int8 to int64, uint8 to uint64, float32, float64,
+// []byte and string for the matching datatypes, time.Time in UTC for DATE,
+// DATETIME and TIMESTAMP_*, and time.Duration since midnight for TIME_*.
+func (x *Column) Decode(rowCount int) ([]any, error) {
+	r, err := NewColumnReader(x, rowCount)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]any, 0, rowCount)
+	for r.Next() {
+		out = append(out, r.Value())
+	}
+	return out, nil
+}
+
+// RowIterator iterates over the rows of a set of columns sharing the same
+// row count, like the columns of an InsertRequest or a DeleteRequest.
+type RowIterator struct {
+	columns []*Column
+	readers []*ColumnReader
+	values  []any
+}
+
+// NewRowIterator returns an iterator over rowCount rows of columns.
+func NewRowIterator(columns []*Column, rowCount uint32) (*RowIterator, error) {
+	it := &RowIterator{
+		columns: columns,
+		readers: make([]*ColumnReader, len(columns)),
+		values:  make([]any, len(columns)),
+	}
+	for i, column := range columns {
+		r, err := NewColumnReader(column, int(rowCount))
+		if err != nil {
+			return nil, err
+		}
+		it.readers[i] = r
+	}
+	return it, nil
+}
+
+// Rows returns an iterator over the rows of the request.
+func (x *InsertRequest) Rows() (*RowIterator, error) {
+	return NewRowIterator(x.GetColumns(), x.GetRowCount())
+}
+
+// Rows returns an iterator over the key rows of the request.
+func (x *DeleteRequest) Rows() (*RowIterator, error) {
+	return NewRowIterator(x.GetKeyColumns(), x.GetRowCount())
+}
+
+// Next advances to the next row, returning false after the last one.
+func (it *RowIterator) Next() bool {
+	for i, r := range it.readers {
+		if !r.Next() {
+			return false
+		}
+		it.values[i] = r.Value()
+	}
+	return len(it.readers) > 0
+}
+
+// Columns returns the columns being iterated, in the order of Values.
+func (it *RowIterator) Columns() []*Column {
+	return it.columns
+}
+
+// Values returns the values of the current row in column order. The slice
+// is reused by the next call to Next.
+func (it *RowIterator) Values() []any {
+	return it.values
+}
+
+// Map returns the current row as column name to value.
+func (it *RowIterator) Map() map[string]any {
+	row := make(map[string]any, len(it.columns))
+	for i, column := range it.columns {
+		row[column.GetColumnName()] = it.values[i]
+	}
+	return row
+}
@@ -0,0 +1,138 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestColumnDecode(t *testing.T) {
+	tests := []struct {
+		datatype ColumnDataType
+		values   *Column_Values
+		want     any
+	}{
+		{ColumnDataType_BOOLEAN, &Column_Values{BoolValues: []bool{true}}, true},
+		{ColumnDataType_INT8, &Column_Values{I8Values: []int32{-8}}, int8(-8)},
+		{ColumnDataType_INT16, &Column_Values{I16Values: []int32{-16}}, int16(-16)},
+		{ColumnDataType_INT32, &Column_Values{I32Values: []int32{-32}}, int32(-32)},
+		{ColumnDataType_INT64, &Column_Values{I64Values: []int64{-64}}, int64(-64)},
+		{ColumnDataType_UINT8, &Column_Values{U8Values: []uint32{8}}, uint8(8)},
+		{ColumnDataType_UINT16, &Column_Values{U16Values: []uint32{16}}, uint16(16)},
+		{ColumnDataType_UINT32, &Column_Values{U32Values: []uint32{32}}, uint32(32)},
+		{ColumnDataType_UINT64, &Column_Values{U64Values: []uint64{64}}, uint64(64)},
+		{ColumnDataType_FLOAT32, &Column_Values{F32Values: []float32{0.5}}, float32(0.5)},
+		{ColumnDataType_FLOAT64, &Column_Values{F64Values: []float64{0.25}}, 0.25},
+		{ColumnDataType_BINARY, &Column_Values{BinaryValues: [][]byte{{1, 2}}}, []byte{1, 2}},
+		{ColumnDataType_STRING, &Column_Values{StringValues: []string{"s"}}, "s"},
+		{ColumnDataType_DATE, &Column_Values{DateValues: []int32{2}}, time.Date(1970, 1, 3, 0, 0, 0, 0, time.UTC)},
+		{ColumnDataType_DATETIME, &Column_Values{DatetimeValues: []int64{1500}}, time.UnixMilli(1500).UTC()},
+		{ColumnDataType_TIMESTAMP_SECOND, &Column_Values{TsSecondValues: []int64{-1}}, time.Unix(-1, 0).UTC()},
+		{ColumnDataType_TIMESTAMP_MILLISECOND, &Column_Values{TsMillisecondValues: []int64{1500}}, time.UnixMilli(1500).UTC()},
+		{ColumnDataType_TIMESTAMP_MICROSECOND, &Column_Values{TsMicrosecondValues: []int64{1500}}, time.UnixMicro(1500).UTC()},
+		{ColumnDataType_TIMESTAMP_NANOSECOND, &Column_Values{TsNanosecondValues: []int64{1500}}, time.Unix(0, 1500).UTC()},
+		{ColumnDataType_TIME_SECOND, &Column_Values{TimeSecondValues: []int64{3}}, 3 * time.Second},
+		{ColumnDataType_TIME_MILLISECOND, &Column_Values{TimeMillisecondValues: []int64{3}}, 3 * time.Millisecond},
+		{ColumnDataType_TIME_MICROSECOND, &Column_Values{TimeMicrosecondValues: []int64{3}}, 3 * time.Microsecond},
+		{ColumnDataType_TIME_NANOSECOND, &Column_Values{TimeNanosecondValues: []int64{3}}, time.Duration(3)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.datatype.String(), func(t *testing.T) {
+			// A null before and after the value.
+			column := &Column{ColumnName: "c", Datatype: tt.datatype, Values: tt.values, NullMask: []byte{0b101}}
+			got, err := column.Decode(3)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []any{nil, tt.want, nil}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Decode(3) = %#v, want %#v", got, want)
+			}
+		})
+	}
+}
+
+func TestColumnDecodeErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		column   *Column
+		rowCount int
+	}{
+		{
+			name:     "missing values",
+			column:   &Column{Datatype: ColumnDataType_INT64, Values: &Column_Values{I64Values: []int64{1}}},
+			rowCount: 2,
+		},
+		{
+			name:     "extra values",
+			column:   &Column{Datatype: ColumnDataType_INT64, Values: &Column_Values{I64Values: []int64{1, 2}}, NullMask: []byte{1}},
+			rowCount: 2,
+		},
+		{
+			name:     "values of another datatype",
+			column:   &Column{Datatype: ColumnDataType_INT64, Values: &Column_Values{I32Values: []int32{1}}},
+			rowCount: 1,
+		},
+		{
+			name:     "null past the rows",
+			column:   &Column{Datatype: ColumnDataType_INT64, Values: &Column_Values{I64Values: []int64{1}}, NullMask: []byte{0b10}},
+			rowCount: 1,
+		},
+		{
+			name:     "negative row count",
+			column:   &Column{Datatype: ColumnDataType_INT64, NullMask: []byte{0x01}},
+			rowCount: -1,
+		},
+		{
+			name:     "negative row count without null mask",
+			column:   &Column{Datatype: ColumnDataType_INT64},
+			rowCount: -7,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := tt.column.Decode(tt.rowCount); err == nil {
+				t.Errorf("Decode(%d) = %v, want an error", tt.rowCount, got)
+			}
+		})
+	}
+}
+
+func TestRowIterator(t *testing.T) {
+	req := &InsertRequest{
+		RowCount: 2,
+		Columns: []*Column{
+			{ColumnName: "host", Datatype: ColumnDataType_STRING, Values: &Column_Values{StringValues: []string{"a", "b"}}},
+			{ColumnName: "v", Datatype: ColumnDataType_FLOAT64, Values: &Column_Values{F64Values: []float64{1}}, NullMask: []byte{0b01}},
+		},
+	}
+	it, err := req.Rows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []map[string]any
+	for it.Next() {
+		got = append(got, it.Map())
+	}
+	want := []map[string]any{
+		{"host": "a", "v": nil},
+		{"host": "b", "v": 1.0},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rows = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,248 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Functions GreptimeDB evaluates as column defaults.
+const (
+	DefaultNow              = "now()"
+	DefaultCurrentTimestamp = "current_timestamp()"
+)
+
+// DefaultConstraint is the decoded default_constraint of a column: either
+// the function computing the default, or the default value, nil for NULL.
+type DefaultConstraint struct {
+	Function string
+	Value    any
+}
+
+// defaultVariants are the names the server gives to the values of the
+// datatypes.
+var defaultVariants = map[ColumnDataType]string{
+	ColumnDataType_BOOLEAN:               "Boolean",
+	ColumnDataType_INT8:                  "Int8",
+	ColumnDataType_INT16:                 "Int16",
+	ColumnDataType_INT32:                 "Int32",
+	ColumnDataType_INT64:                 "Int64",
+	ColumnDataType_UINT8:                 "UInt8",
+	ColumnDataType_UINT16:                "UInt16",
+	ColumnDataType_UINT32:                "UInt32",
+	ColumnDataType_UINT64:                "UInt64",
+	ColumnDataType_FLOAT32:               "Float32",
+	ColumnDataType_FLOAT64:               "Float64",
+	ColumnDataType_BINARY:                "Binary",
+	ColumnDataType_STRING:                "String",
+	ColumnDataType_DATE:                  "Date",
+	ColumnDataType_DATETIME:              "DateTime",
+	ColumnDataType_TIMESTAMP_SECOND:      "Timestamp",
+	ColumnDataType_TIMESTAMP_MILLISECOND: "Timestamp",
+	ColumnDataType_TIMESTAMP_MICROSECOND: "Timestamp",
+	ColumnDataType_TIMESTAMP_NANOSECOND:  "Timestamp",
+	ColumnDataType_TIME_SECOND:           "Time",
+	ColumnDataType_TIME_MILLISECOND:      "Time",
+	ColumnDataType_TIME_MICROSECOND:      "Time",
+	ColumnDataType_TIME_NANOSECOND:       "Time",
+}
+
+// timeUnitNames are the names the server gives to the units of timestamps
+// and times.
+var timeUnitNames = map[time.Duration]string{
+	time.Second:      "Second",
+	time.Millisecond: "Millisecond",
+	time.Microsecond: "Microsecond",
+	time.Nanosecond:  "Nanosecond",
+}
+
+// timeValue is how the server encodes timestamps and times.
+type timeValue struct {
+	Value int64  `json:"value"`
+	Unit  string `json:"unit"`
+}
+
+// DefaultValue returns the default_constraint of a column of datatype
+// defaulting to v, or to NULL if v is nil. v is converted like the values
+// added to an InsertBuilder.
+//
+// The constraint is encoded as the server does, in JSON: {"Value":"Null"},
+// {"Value":{"Int32":1}} or {"Value":{"Timestamp":{"value":1,"unit":
+// "Millisecond"}}} for instance.
+func DefaultValue(datatype ColumnDataType, v any) ([]byte, error) {
+	variant, ok := defaultVariants[datatype]
+	if !ok {
+		return nil, fmt.Errorf("%w %d", ErrUnknownDatatype, datatype)
+	}
+	if v = indirect(v); v == nil {
+		return []byte(`{"Value":"Null"}`), nil
+	}
+	c, err := toCell(datatype, v)
+	if err != nil {
+		return nil, err
+	}
+	var value any
+	switch variant {
+	case "Boolean":
+		value = c.b
+	case "Int8", "Int16", "Int32", "Int64", "Date", "DateTime":
+		value = c.i
+	case "UInt8", "UInt16", "UInt32", "UInt64":
+		value = c.u
+	case "Float32":
+		value = float32(c.f)
+	case "Float64":
+		value = c.f
+	case "Binary":
+		// A JSON array of bytes, not the base64 string of encoding/json.
+		bytes := make([]int, len(c.bin))
+		for i, b := range c.bin {
+			bytes[i] = int(b)
+		}
+		value = bytes
+	case "String":
+		value = c.s
+	case "Timestamp", "Time":
+		value = timeValue{Value: c.i, Unit: timeUnitNames[timeUnit(datatype)]}
+	}
+	b, err := json.Marshal(map[string]map[string]any{"Value": {variant: value}})
+	if err != nil {
+		return nil, fmt.Errorf("default %v for %s: %w", v, datatype, err)
+	}
+	return b, nil
+}
+
+// DefaultFunction returns the default_constraint of a column defaulting to
+// the result of a function, like DefaultNow, encoded as the server does:
+// {"Function":"now()"}.
+func DefaultFunction(function string) []byte {
+	b, _ := json.Marshal(map[string]string{"Function": function})
+	return b
+}
+
+// ParseDefaultConstraint decodes a default_constraint. Values have the Go
+// types of Column.Decode.
+func ParseDefaultConstraint(b []byte) (*DefaultConstraint, error) {
+	var constraint struct {
+		Function *string
+		Value    json.RawMessage
+	}
+	if err := json.Unmarshal(b, &constraint); err != nil {
+		return nil, fmt.Errorf("invalid default constraint %q: %w", b, err)
+	}
+	switch {
+	case constraint.Function != nil && constraint.Value == nil:
+		return &DefaultConstraint{Function: *constraint.Function}, nil
+	case constraint.Function != nil || constraint.Value == nil:
+		return nil, fmt.Errorf("invalid default constraint %q", b)
+	case string(constraint.Value) == `"Null"`:
+		return &DefaultConstraint{}, nil
+	}
+
+	var variants map[string]json.RawMessage
+	if err := json.Unmarshal(constraint.Value, &variants); err != nil || len(variants) != 1 {
+		return nil, fmt.Errorf("invalid default value %s", constraint.Value)
+	}
+	var variant string
+	var raw json.RawMessage
+	for variant, raw = range variants {
+	}
+	v, err := decodeDefault(variant, raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid default value %s: %w", constraint.Value, err)
+	}
+	return &DefaultConstraint{Value: v}, nil
+}
+
+// decodeDefault decodes the value of a variant.
+func decodeDefault(variant string, raw json.RawMessage) (any, error) {
+	var v any
+	switch variant {
+	case "Boolean":
+		v = new(bool)
+	case "Int8":
+		v = new(int8)
+	case "Int16":
+		v = new(int16)
+	case "Int32":
+		v = new(int32)
+	case "Int64":
+		v = new(int64)
+	case "UInt8":
+		v = new(uint8)
+	case "UInt16":
+		v = new(uint16)
+	case "UInt32":
+		v = new(uint32)
+	case "UInt64":
+		v = new(uint64)
+	case "Float32":
+		v = new(float32)
+	case "Float64":
+		v = new(float64)
+	case "String":
+		v = new(string)
+	case "Binary":
+		var bytes []byte
+		if err := json.Unmarshal(raw, &bytes); err != nil {
+			return nil, err
+		}
+		return bytes, nil
+	case "Date":
+		var days int32
+		if err := json.Unmarshal(raw, &days); err != nil {
+			return nil, err
+		}
+		return time.Unix(int64(days)*86400, 0).UTC(), nil
+	case "DateTime":
+		var millis int64
+		if err := json.Unmarshal(raw, &millis); err != nil {
+			return nil, err
+		}
+		return fromTicks(millis, time.Millisecond), nil
+	case "Timestamp", "Time":
+		var t timeValue
+		if err := json.Unmarshal(raw, &t); err != nil {
+			return nil, err
+		}
+		for unit, name := range timeUnitNames {
+			if name != t.Unit {
+				continue
+			}
+			if variant == "Time" {
+				return time.Duration(t.Value) * unit, nil
+			}
+			return fromTicks(t.Value, unit), nil
+		}
+		return nil, fmt.Errorf("unknown time unit %q", t.Unit)
+	default:
+		return nil, fmt.Errorf("unsupported value type %s", variant)
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return nil, err
+	}
+	return indirect(v), nil
+}
+
+// Default decodes the default constraint of the column, nil if it has
+// none.
+func (x *ColumnDef) Default() (*DefaultConstraint, error) {
+	if len(x.GetDefaultConstraint()) == 0 {
+		return nil, nil
+	}
+	return ParseDefaultConstraint(x.DefaultConstraint)
+}
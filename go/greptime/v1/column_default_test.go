@@ -0,0 +1,116 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestDefaultValue checks default constraints are encoded as the serde
+// serialization of the ColumnDefaultConstraint of the server.
+func TestDefaultValue(t *testing.T) {
+	tests := []struct {
+		datatype ColumnDataType
+		v        any
+		json     string
+		// decoded is v as ParseDefaultConstraint returns it.
+		decoded any
+	}{
+		{ColumnDataType_INT32, nil, `{"Value":"Null"}`, nil},
+		{ColumnDataType_BOOLEAN, true, `{"Value":{"Boolean":true}}`, true},
+		{ColumnDataType_INT8, -8, `{"Value":{"Int8":-8}}`, int8(-8)},
+		{ColumnDataType_INT16, int16(-16), `{"Value":{"Int16":-16}}`, int16(-16)},
+		{ColumnDataType_INT32, int64(-32), `{"Value":{"Int32":-32}}`, int32(-32)},
+		{ColumnDataType_INT64, int64(-1 << 63), `{"Value":{"Int64":-9223372036854775808}}`, int64(-1 << 63)},
+		{ColumnDataType_UINT8, 8, `{"Value":{"UInt8":8}}`, uint8(8)},
+		{ColumnDataType_UINT16, 16, `{"Value":{"UInt16":16}}`, uint16(16)},
+		{ColumnDataType_UINT32, 32, `{"Value":{"UInt32":32}}`, uint32(32)},
+		{ColumnDataType_UINT64, uint64(1<<64 - 1), `{"Value":{"UInt64":18446744073709551615}}`, uint64(1<<64 - 1)},
+		{ColumnDataType_FLOAT32, float32(0.1), `{"Value":{"Float32":0.1}}`, float32(0.1)},
+		{ColumnDataType_FLOAT64, 1.5, `{"Value":{"Float64":1.5}}`, 1.5},
+		{ColumnDataType_BINARY, []byte{0, 255}, `{"Value":{"Binary":[0,255]}}`, []byte{0, 255}},
+		{ColumnDataType_STRING, "a\"b", `{"Value":{"String":"a\"b"}}`, "a\"b"},
+		{ColumnDataType_DATE, time.Unix(2*86400, 0), `{"Value":{"Date":2}}`, time.Unix(2*86400, 0).UTC()},
+		{ColumnDataType_DATETIME, time.UnixMilli(1500), `{"Value":{"DateTime":1500}}`, time.UnixMilli(1500).UTC()},
+		{ColumnDataType_TIMESTAMP_SECOND, time.Unix(-1, 0), `{"Value":{"Timestamp":{"value":-1,"unit":"Second"}}}`, time.Unix(-1, 0).UTC()},
+		{ColumnDataType_TIMESTAMP_MILLISECOND, time.UnixMilli(1500), `{"Value":{"Timestamp":{"value":1500,"unit":"Millisecond"}}}`, time.UnixMilli(1500).UTC()},
+		{ColumnDataType_TIMESTAMP_MICROSECOND, time.UnixMicro(1500), `{"Value":{"Timestamp":{"value":1500,"unit":"Microsecond"}}}`, time.UnixMicro(1500).UTC()},
+		{ColumnDataType_TIMESTAMP_NANOSECOND, time.Unix(0, 1500), `{"Value":{"Timestamp":{"value":1500,"unit":"Nanosecond"}}}`, time.Unix(0, 1500).UTC()},
+		{ColumnDataType_TIME_SECOND, time.Hour, `{"Value":{"Time":{"value":3600,"unit":"Second"}}}`, time.Hour},
+		{ColumnDataType_TIME_MILLISECOND, time.Second, `{"Value":{"Time":{"value":1000,"unit":"Millisecond"}}}`, time.Second},
+		{ColumnDataType_TIME_MICROSECOND, time.Millisecond, `{"Value":{"Time":{"value":1000,"unit":"Microsecond"}}}`, time.Millisecond},
+		{ColumnDataType_TIME_NANOSECOND, time.Microsecond, `{"Value":{"Time":{"value":1000,"unit":"Nanosecond"}}}`, time.Microsecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.datatype.String(), func(t *testing.T) {
+			b, err := DefaultValue(tt.datatype, tt.v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.json {
+				t.Errorf("DefaultValue(%v) = %s, want %s", tt.v, b, tt.json)
+			}
+			got, err := (&ColumnDef{DefaultConstraint: b}).Default()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := (&DefaultConstraint{Value: tt.decoded}); !reflect.DeepEqual(got, want) {
+				t.Errorf("Default() = %#v, want %#v", got, want)
+			}
+		})
+	}
+}
+
+func TestDefaultFunction(t *testing.T) {
+	b := DefaultFunction(DefaultNow)
+	if string(b) != `{"Function":"now()"}` {
+		t.Errorf("DefaultFunction(%q) = %s", DefaultNow, b)
+	}
+	got, err := ParseDefaultConstraint(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (&DefaultConstraint{Function: DefaultNow}); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseDefaultConstraint(%s) = %#v, want %#v", b, got, want)
+	}
+	if got, err := (&ColumnDef{}).Default(); got != nil || err != nil {
+		t.Errorf("Default() of no constraint = %v, %v, want nil", got, err)
+	}
+}
+
+func TestDefaultErrors(t *testing.T) {
+	if b, err := DefaultValue(ColumnDataType_UINT8, -1); err == nil {
+		t.Errorf("DefaultValue(UINT8, -1) = %s, want an error", b)
+	}
+	if b, err := DefaultValue(100, 1); err == nil {
+		t.Errorf("DefaultValue of an unknown datatype = %s, want an error", b)
+	}
+	for _, b := range []string{
+		``,
+		`{}`,
+		`{"Function":"now()","Value":"Null"}`,
+		`{"Value":{}}`,
+		`{"Value":{"Int8":1,"Int16":1}}`,
+		`{"Value":{"Int8":128}}`,
+		`{"Value":{"Decimal128":1}}`,
+		`{"Value":{"Timestamp":{"value":1,"unit":"Minute"}}}`,
+	} {
+		if got, err := ParseDefaultConstraint([]byte(b)); err == nil {
+			t.Errorf("ParseDefaultConstraint(%s) = %#v, want an error", b, got)
+		}
+	}
+}
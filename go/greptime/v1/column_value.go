@@ -0,0 +1,333 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+)
+
+var (
+	timeType  = reflect.TypeOf(time.Time{})
+	bytesType = reflect.TypeOf([]byte(nil))
+)
+
+// cell is a non-null value converted to the representation of a
+// ColumnDataType, ready to be appended to Column_Values.
+type cell struct {
+	i   int64
+	u   uint64
+	f   float64
+	b   bool
+	s   string
+	bin []byte
+}
+
+// indirect dereferences pointers, returning nil for nil pointers.
+func indirect(v any) any {
+	for {
+		rv := reflect.ValueOf(v)
+		if rv.Kind() != reflect.Pointer {
+			return v
+		}
+		if rv.IsNil() {
+			return nil
+		}
+		v = rv.Elem().Interface()
+	}
+}
+
+// inferDatatype returns the ColumnDataType a Go value maps to when the
+// column has not been declared. time.Time maps to TIMESTAMP_MILLISECOND.
+func inferDatatype(v any) (ColumnDataType, bool) {
+	return datatypeOf(reflect.TypeOf(v))
+}
+
+// datatypeOf returns the ColumnDataType values of the Go type t map to.
+func datatypeOf(t reflect.Type) (ColumnDataType, bool) {
+	switch t {
+	case timeType:
+		return ColumnDataType_TIMESTAMP_MILLISECOND, true
+	case bytesType:
+		return ColumnDataType_BINARY, true
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return ColumnDataType_BOOLEAN, true
+	case reflect.Int8:
+		return ColumnDataType_INT8, true
+	case reflect.Int16:
+		return ColumnDataType_INT16, true
+	case reflect.Int32:
+		return ColumnDataType_INT32, true
+	case reflect.Int, reflect.Int64:
+		return ColumnDataType_INT64, true
+	case reflect.Uint8:
+		return ColumnDataType_UINT8, true
+	case reflect.Uint16:
+		return ColumnDataType_UINT16, true
+	case reflect.Uint32:
+		return ColumnDataType_UINT32, true
+	case reflect.Uint, reflect.Uint64:
+		return ColumnDataType_UINT64, true
+	case reflect.Float32:
+		return ColumnDataType_FLOAT32, true
+	case reflect.Float64:
+		return ColumnDataType_FLOAT64, true
+	case reflect.String:
+		return ColumnDataType_STRING, true
+	}
+	return 0, false
+}
+
+func asInt(v any) (int64, bool) {
+	switch x := v.(type) {
+	case int64:
+		return x, true
+	case int:
+		return int64(x), true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if u := rv.Uint(); u <= math.MaxInt64 {
+			return int64(u), true
+		}
+	}
+	return 0, false
+}
+
+func asUint(v any) (uint64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return rv.Uint(), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if i := rv.Int(); i >= 0 {
+			return uint64(i), true
+		}
+	}
+	return 0, false
+}
+
+func asFloat(v any) (float64, bool) {
+	if x, ok := v.(float64); ok {
+		return x, true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	if i, ok := asInt(v); ok {
+		return float64(i), true
+	}
+	if u, ok := asUint(v); ok {
+		return float64(u), true
+	}
+	return 0, false
+}
+
+// timeUnit returns the duration of one tick of a timestamp or time
+// datatype.
+func timeUnit(datatype ColumnDataType) time.Duration {
+	switch datatype {
+	case ColumnDataType_TIMESTAMP_SECOND, ColumnDataType_TIME_SECOND:
+		return time.Second
+	case ColumnDataType_TIMESTAMP_MILLISECOND, ColumnDataType_TIME_MILLISECOND, ColumnDataType_DATETIME:
+		return time.Millisecond
+	case ColumnDataType_TIMESTAMP_MICROSECOND, ColumnDataType_TIME_MICROSECOND:
+		return time.Microsecond
+	default:
+		return time.Nanosecond
+	}
+}
+
+// toTicks converts t to the number of units since the UNIX epoch.
+func toTicks(t time.Time, unit time.Duration) int64 {
+	switch unit {
+	case time.Second:
+		return t.Unix()
+	case time.Millisecond:
+		return t.UnixMilli()
+	case time.Microsecond:
+		return t.UnixMicro()
+	default:
+		return t.UnixNano()
+	}
+}
+
+// toCell converts v to the representation of datatype. v must not be nil.
+//
+// Integer columns accept any Go integer that fits, float columns accept
+// floats and integers. DATE accepts time.Time (days since the UNIX epoch),
+// DATETIME and TIMESTAMP_* accept time.Time, TIME_* accept time.Duration
+// since midnight. All of them also accept the raw integer representation.
+func toCell(datatype ColumnDataType, v any) (cell, error) {
+	var c cell
+	ok := false
+	switch datatype {
+	case ColumnDataType_BOOLEAN:
+		if rv := reflect.ValueOf(v); rv.Kind() == reflect.Bool {
+			c.b, ok = rv.Bool(), true
+		}
+	case ColumnDataType_INT8:
+		c.i, ok = asInt(v)
+		ok = ok && c.i >= math.MinInt8 && c.i <= math.MaxInt8
+	case ColumnDataType_INT16:
+		c.i, ok = asInt(v)
+		ok = ok && c.i >= math.MinInt16 && c.i <= math.MaxInt16
+	case ColumnDataType_INT32:
+		c.i, ok = asInt(v)
+		ok = ok && c.i >= math.MinInt32 && c.i <= math.MaxInt32
+	case ColumnDataType_INT64:
+		c.i, ok = asInt(v)
+	case ColumnDataType_UINT8:
+		c.u, ok = asUint(v)
+		ok = ok && c.u <= math.MaxUint8
+	case ColumnDataType_UINT16:
+		c.u, ok = asUint(v)
+		ok = ok && c.u <= math.MaxUint16
+	case ColumnDataType_UINT32:
+		c.u, ok = asUint(v)
+		ok = ok && c.u <= math.MaxUint32
+	case ColumnDataType_UINT64:
+		c.u, ok = asUint(v)
+	case ColumnDataType_FLOAT32, ColumnDataType_FLOAT64:
+		c.f, ok = asFloat(v)
+	case ColumnDataType_BINARY:
+		switch x := v.(type) {
+		case []byte:
+			c.bin, ok = x, true
+		case string:
+			c.bin, ok = []byte(x), true
+		}
+	case ColumnDataType_STRING:
+		switch x := v.(type) {
+		case string:
+			c.s, ok = x, true
+		case []byte:
+			c.s, ok = string(x), true
+		default:
+			if rv := reflect.ValueOf(v); rv.Kind() == reflect.String {
+				c.s, ok = rv.String(), true
+			}
+		}
+	case ColumnDataType_DATE:
+		if t, isTime := v.(time.Time); isTime {
+			secs := t.Unix()
+			days := secs / 86400
+			if secs%86400 < 0 {
+				days--
+			}
+			c.i, ok = days, true
+		} else {
+			c.i, ok = asInt(v)
+		}
+		ok = ok && c.i >= math.MinInt32 && c.i <= math.MaxInt32
+	case ColumnDataType_DATETIME,
+		ColumnDataType_TIMESTAMP_SECOND,
+		ColumnDataType_TIMESTAMP_MILLISECOND,
+		ColumnDataType_TIMESTAMP_MICROSECOND,
+		ColumnDataType_TIMESTAMP_NANOSECOND:
+		if t, isTime := v.(time.Time); isTime {
+			c.i, ok = toTicks(t, timeUnit(datatype)), true
+		} else {
+			c.i, ok = asInt(v)
+		}
+	case ColumnDataType_TIME_SECOND,
+		ColumnDataType_TIME_MILLISECOND,
+		ColumnDataType_TIME_MICROSECOND,
+		ColumnDataType_TIME_NANOSECOND:
+		if d, isDuration := v.(time.Duration); isDuration {
+			c.i, ok = int64(d/timeUnit(datatype)), true
+		} else {
+			c.i, ok = asInt(v)
+		}
+	}
+	if !ok {
+		return c, fmt.Errorf("cannot use %T value %v as %s", v, v, datatype)
+	}
+	return c, nil
+}
+
+// appendCell appends c to the field of values that holds datatype.
+func appendCell(values *Column_Values, datatype ColumnDataType, c cell) {
+	switch datatype {
+	case ColumnDataType_BOOLEAN:
+		values.BoolValues = append(values.BoolValues, c.b)
+	case ColumnDataType_INT8:
+		values.I8Values = append(values.I8Values, int32(c.i))
+	case ColumnDataType_INT16:
+		values.I16Values = append(values.I16Values, int32(c.i))
+	case ColumnDataType_INT32:
+		values.I32Values = append(values.I32Values, int32(c.i))
+	case ColumnDataType_INT64:
+		values.I64Values = append(values.I64Values, c.i)
+	case ColumnDataType_UINT8:
+		values.U8Values = append(values.U8Values, uint32(c.u))
+	case ColumnDataType_UINT16:
+		values.U16Values = append(values.U16Values, uint32(c.u))
+	case ColumnDataType_UINT32:
+		values.U32Values = append(values.U32Values, uint32(c.u))
+	case ColumnDataType_UINT64:
+		values.U64Values = append(values.U64Values, c.u)
+	case ColumnDataType_FLOAT32:
+		values.F32Values = append(values.F32Values, float32(c.f))
+	case ColumnDataType_FLOAT64:
+		values.F64Values = append(values.F64Values, c.f)
+	case ColumnDataType_BINARY:
+		values.BinaryValues = append(values.BinaryValues, c.bin)
+	case ColumnDataType_STRING:
+		values.StringValues = append(values.StringValues, c.s)
+	case ColumnDataType_DATE:
+		values.DateValues = append(values.DateValues, int32(c.i))
+	case ColumnDataType_DATETIME:
+		values.DatetimeValues = append(values.DatetimeValues, c.i)
+	case ColumnDataType_TIMESTAMP_SECOND:
+		values.TsSecondValues = append(values.TsSecondValues, c.i)
+	case ColumnDataType_TIMESTAMP_MILLISECOND:
+		values.TsMillisecondValues = append(values.TsMillisecondValues, c.i)
+	case ColumnDataType_TIMESTAMP_MICROSECOND:
+		values.TsMicrosecondValues = append(values.TsMicrosecondValues, c.i)
+	case ColumnDataType_TIMESTAMP_NANOSECOND:
+		values.TsNanosecondValues = append(values.TsNanosecondValues, c.i)
+	case ColumnDataType_TIME_SECOND:
+		values.TimeSecondValues = append(values.TimeSecondValues, c.i)
+	case ColumnDataType_TIME_MILLISECOND:
+		values.TimeMillisecondValues = append(values.TimeMillisecondValues, c.i)
+	case ColumnDataType_TIME_MICROSECOND:
+		values.TimeMicrosecondValues = append(values.TimeMicrosecondValues, c.i)
+	case ColumnDataType_TIME_NANOSECOND:
+		values.TimeNanosecondValues = append(values.TimeNanosecondValues, c.i)
+	}
+}
+
+// IsTimestamp reports whether the datatype is one of the TIMESTAMP_* types,
+// which are the types a time index column may have.
+func (x ColumnDataType) IsTimestamp() bool {
+	switch x {
+	case ColumnDataType_TIMESTAMP_SECOND,
+		ColumnDataType_TIMESTAMP_MILLISECOND,
+		ColumnDataType_TIMESTAMP_MICROSECOND,
+		ColumnDataType_TIMESTAMP_NANOSECOND:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,660 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ddlsql
+
+import (
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	greptimev1 "github.com/GreptimeTeam/greptime-proto/go/greptime/v1"
+	"github.com/GreptimeTeam/greptime-proto/go/internal/sqlscan"
+)
+
+// Parse parses SQL DDL statements separated by semicolons into one
+// DdlRequest each. It accepts what Render returns and, more generally:
+//
+//	CREATE DATABASE [IF NOT EXISTS] name
+//	CREATE TABLE [IF NOT EXISTS] [[catalog.]schema.]name (
+//	  column type [NULL | NOT NULL] [DEFAULT default] [PRIMARY KEY] [TIME INDEX], ...
+//	  [, TIME INDEX (column)]
+//	  [, PRIMARY KEY (column, ...)]
+//	) [ENGINE [=] engine] [COMMENT [=] 'desc'] [WITH (key = value, ...)]
+//	ALTER TABLE name ADD [COLUMN] column type ... [FIRST | AFTER column]
+//	ALTER TABLE name DROP [COLUMN] column
+//	ALTER TABLE name RENAME [TO] new_name
+//	DROP TABLE name
+//	SELECT flush_table('name' [, region]) | compact_table('name' [, region])
+//
+// Types are those of SQLType and their usual aliases, like INTEGER, TEXT
+// or TIMESTAMP, which is TIMESTAMP(3). Defaults are literals converted to
+// the type of the column, like those of Literal, or calls of functions
+// taking no arguments, like now(). Columns are nullable unless
+// declared NOT NULL, except the time index. Tables are built with
+// greptimev1.NewTable and checked like by TableBuilder.Build; the
+// "regions" option sets the number of regions.
+func Parse(sql string) ([]*greptimev1.DdlRequest, error) {
+	p, err := sqlscan.NewParser(sql)
+	if err != nil {
+		return nil, err
+	}
+	var reqs []*greptimev1.DdlRequest
+	for {
+		for p.Symbol(";") {
+		}
+		if p.Peek().Kind == sqlscan.EOF {
+			return reqs, nil
+		}
+		req, err := parseStatement(p)
+		if err != nil {
+			return nil, err
+		}
+		reqs = append(reqs, req)
+		if p.Peek().Kind != sqlscan.EOF {
+			if err := p.ExpectSymbol(";"); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func parseStatement(p *sqlscan.Parser) (*greptimev1.DdlRequest, error) {
+	switch {
+	case p.Keyword("CREATE", "DATABASE"):
+		ifNotExists := p.Keyword("IF", "NOT", "EXISTS")
+		name, err := p.Ident()
+		if err != nil {
+			return nil, err
+		}
+		return &greptimev1.DdlRequest{Expr: &greptimev1.DdlRequest_CreateDatabase{CreateDatabase: &greptimev1.CreateDatabaseExpr{
+			DatabaseName:      name,
+			CreateIfNotExists: ifNotExists,
+		}}}, nil
+	case p.Keyword("CREATE", "TABLE"):
+		expr, err := parseCreateTable(p)
+		if err != nil {
+			return nil, err
+		}
+		return &greptimev1.DdlRequest{Expr: &greptimev1.DdlRequest_CreateTable{CreateTable: expr}}, nil
+	case p.Keyword("ALTER", "TABLE"):
+		expr, err := parseAlter(p)
+		if err != nil {
+			return nil, err
+		}
+		return &greptimev1.DdlRequest{Expr: &greptimev1.DdlRequest_Alter{Alter: expr}}, nil
+	case p.Keyword("DROP", "TABLE"):
+		catalog, schema, table, err := parseTableName(p)
+		if err != nil {
+			return nil, err
+		}
+		return &greptimev1.DdlRequest{Expr: &greptimev1.DdlRequest_DropTable{DropTable: &greptimev1.DropTableExpr{
+			CatalogName: catalog,
+			SchemaName:  schema,
+			TableName:   table,
+		}}}, nil
+	case p.Keyword("SELECT"):
+		return parseTableFunction(p)
+	}
+	return nil, p.Errorf("expect a DDL statement")
+}
+
+// parseTableName parses a table name qualified with its schema and
+// catalog or not.
+func parseTableName(p *sqlscan.Parser) (catalog, schema, table string, err error) {
+	parts, err := p.ObjectName()
+	if err != nil {
+		return "", "", "", err
+	}
+	switch len(parts) {
+	case 1:
+		return "", "", parts[0], nil
+	case 2:
+		return "", parts[0], parts[1], nil
+	case 3:
+		return parts[0], parts[1], parts[2], nil
+	}
+	return "", "", "", p.Errorf("invalid table name %s", strings.Join(parts, "."))
+}
+
+func parseIdentList(p *sqlscan.Parser) ([]string, error) {
+	if err := p.ExpectSymbol("("); err != nil {
+		return nil, err
+	}
+	var names []string
+	for {
+		name, err := p.Ident()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+		if !p.Symbol(",") {
+			break
+		}
+	}
+	return names, p.ExpectSymbol(")")
+}
+
+type columnSpec struct {
+	def       *greptimev1.ColumnDef
+	null      bool
+	key       bool
+	timeIndex bool
+}
+
+// parseColumnDef parses a column name, type and options.
+func parseColumnDef(p *sqlscan.Parser) (*columnSpec, error) {
+	name, err := p.Ident()
+	if err != nil {
+		return nil, err
+	}
+	datatype, err := parseType(p)
+	if err != nil {
+		return nil, err
+	}
+	c := &columnSpec{def: &greptimev1.ColumnDef{Name: name, Datatype: datatype, IsNullable: true}}
+	for {
+		switch {
+		case p.Keyword("NOT", "NULL"):
+			c.def.IsNullable = false
+		case p.Keyword("NULL"):
+			c.def.IsNullable = true
+			c.null = true
+		case p.Keyword("PRIMARY", "KEY"):
+			c.key = true
+		case p.Keyword("TIME", "INDEX"):
+			c.timeIndex = true
+		case p.Keyword("DEFAULT"):
+			if c.def.DefaultConstraint, err = parseDefault(p, datatype); err != nil {
+				return nil, err
+			}
+		default:
+			return c, nil
+		}
+	}
+}
+
+func parseCreateTable(p *sqlscan.Parser) (*greptimev1.CreateTableExpr, error) {
+	ifNotExists := p.Keyword("IF", "NOT", "EXISTS")
+	catalog, schema, table, err := parseTableName(p)
+	if err != nil {
+		return nil, err
+	}
+	b := greptimev1.NewTable(table).Catalog(catalog).Schema(schema)
+	if ifNotExists {
+		b.IfNotExists()
+	}
+
+	if err := p.ExpectSymbol("("); err != nil {
+		return nil, err
+	}
+	var columns []*columnSpec
+	var timeIndex string
+	for {
+		switch {
+		case p.Keyword("TIME", "INDEX"):
+			names, err := parseIdentList(p)
+			if err != nil {
+				return nil, err
+			}
+			if len(names) != 1 {
+				return nil, p.Errorf("the time index must be a single column")
+			}
+			timeIndex = names[0]
+		case p.Keyword("PRIMARY", "KEY"):
+			names, err := parseIdentList(p)
+			if err != nil {
+				return nil, err
+			}
+			b.PrimaryKey(names...)
+		default:
+			c, err := parseColumnDef(p)
+			if err != nil {
+				return nil, err
+			}
+			if c.key {
+				b.PrimaryKey(c.def.Name)
+			}
+			if c.timeIndex {
+				timeIndex = c.def.Name
+			}
+			columns = append(columns, c)
+		}
+		if !p.Symbol(",") {
+			break
+		}
+	}
+	if err := p.ExpectSymbol(")"); err != nil {
+		return nil, err
+	}
+	for _, c := range columns {
+		if c.def.Name == timeIndex && !c.null {
+			c.def.IsNullable = false
+		}
+		b.Column(c.def)
+	}
+	b.TimeIndex(timeIndex)
+
+	for {
+		switch {
+		case p.Keyword("ENGINE"):
+			p.Symbol("=")
+			engine, err := p.Ident()
+			if err != nil {
+				return nil, err
+			}
+			b.Engine(engine)
+		case p.Keyword("COMMENT"):
+			p.Symbol("=")
+			t := p.Next()
+			if t.Kind != sqlscan.String {
+				return nil, p.Errorf("expect a string")
+			}
+			b.Desc(t.Text)
+		case p.Keyword("WITH"):
+			if err := parseOptions(p, b); err != nil {
+				return nil, err
+			}
+		default:
+			return b.Build()
+		}
+	}
+}
+
+// parseOptions parses the options of a table, keys being identifiers,
+// dotted or not, or strings and values being literals.
+func parseOptions(p *sqlscan.Parser, b *greptimev1.TableBuilder) error {
+	if err := p.ExpectSymbol("("); err != nil {
+		return err
+	}
+	if p.Symbol(")") {
+		return nil
+	}
+	for {
+		var key string
+		if t := p.Peek(); t.Kind == sqlscan.String {
+			key = p.Next().Text
+		} else {
+			parts, err := p.ObjectName()
+			if err != nil {
+				return err
+			}
+			key = strings.Join(parts, ".")
+		}
+		if err := p.ExpectSymbol("="); err != nil {
+			return err
+		}
+		value := p.Next()
+		switch value.Kind {
+		case sqlscan.String, sqlscan.Number, sqlscan.Ident:
+		default:
+			return p.Errorf("expect the value of option %q", key)
+		}
+		if strings.EqualFold(key, "regions") {
+			n, err := strconv.ParseUint(value.Text, 10, 32)
+			if err != nil || n == 0 || n > greptimev1.MaxRegions {
+				return p.Errorf("invalid number of regions %s, must be 1 to %d", value, greptimev1.MaxRegions)
+			}
+			regions := make([]uint32, n)
+			for i := range regions {
+				regions[i] = uint32(i)
+			}
+			b.RegionNumbers(regions...)
+		} else {
+			b.Option(key, value.Text)
+		}
+		if !p.Symbol(",") {
+			break
+		}
+	}
+	return p.ExpectSymbol(")")
+}
+
+func parseAlter(p *sqlscan.Parser) (*greptimev1.AlterExpr, error) {
+	catalog, schema, table, err := parseTableName(p)
+	if err != nil {
+		return nil, err
+	}
+	expr := &greptimev1.AlterExpr{CatalogName: catalog, SchemaName: schema, TableName: table}
+	switch {
+	case p.Keyword("ADD"):
+		p.Keyword("COLUMN")
+		c, err := parseColumnDef(p)
+		if err != nil {
+			return nil, err
+		}
+		if c.timeIndex {
+			return nil, p.Errorf("cannot add a time index column")
+		}
+		add := &greptimev1.AddColumn{ColumnDef: c.def, IsKey: c.key}
+		switch {
+		case p.Keyword("FIRST"):
+			add.Location = &greptimev1.AddColumn_Location{LocationType: greptimev1.AddColumn_Location_FIRST}
+		case p.Keyword("AFTER"):
+			after, err := p.Ident()
+			if err != nil {
+				return nil, err
+			}
+			add.Location = &greptimev1.AddColumn_Location{
+				LocationType:    greptimev1.AddColumn_Location_AFTER,
+				AfterCloumnName: after,
+			}
+		}
+		expr.Kind = &greptimev1.AlterExpr_AddColumns{AddColumns: &greptimev1.AddColumns{
+			AddColumns: []*greptimev1.AddColumn{add},
+		}}
+	case p.Keyword("DROP"):
+		p.Keyword("COLUMN")
+		name, err := p.Ident()
+		if err != nil {
+			return nil, err
+		}
+		expr.Kind = &greptimev1.AlterExpr_DropColumns{DropColumns: &greptimev1.DropColumns{
+			DropColumns: []*greptimev1.DropColumn{{Name: name}},
+		}}
+	case p.Keyword("RENAME"):
+		p.Keyword("TO")
+		name, err := p.Ident()
+		if err != nil {
+			return nil, err
+		}
+		expr.Kind = &greptimev1.AlterExpr_RenameTable{RenameTable: &greptimev1.RenameTable{NewTableName: name}}
+	default:
+		return nil, p.Errorf("expect ADD, DROP or RENAME")
+	}
+	return expr, nil
+}
+
+// parseTableFunction parses the call of flush_table or compact_table
+// following SELECT.
+func parseTableFunction(p *sqlscan.Parser) (*greptimev1.DdlRequest, error) {
+	function := p.Peek()
+	if !function.Is("flush_table") && !function.Is("compact_table") {
+		return nil, p.Errorf("expect flush_table or compact_table")
+	}
+	p.Next()
+	if err := p.ExpectSymbol("("); err != nil {
+		return nil, err
+	}
+	arg := p.Next()
+	if arg.Kind != sqlscan.String {
+		return nil, p.Errorf("expect a table name")
+	}
+	name, err := sqlscan.NewParser(arg.Text)
+	if err != nil {
+		return nil, err
+	}
+	catalog, schema, table, err := parseTableName(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := name.End(); err != nil {
+		return nil, err
+	}
+	var region *uint32
+	if p.Symbol(",") {
+		t := p.Next()
+		n, err := strconv.ParseUint(t.Text, 10, 32)
+		if t.Kind != sqlscan.Number || err != nil {
+			return nil, p.Errorf("expect a region number")
+		}
+		r := uint32(n)
+		region = &r
+	}
+	if err := p.ExpectSymbol(")"); err != nil {
+		return nil, err
+	}
+
+	if function.Is("flush_table") {
+		return &greptimev1.DdlRequest{Expr: &greptimev1.DdlRequest_FlushTable{FlushTable: &greptimev1.FlushTableExpr{
+			CatalogName:  catalog,
+			SchemaName:   schema,
+			TableName:    table,
+			RegionNumber: region,
+		}}}, nil
+	}
+	return &greptimev1.DdlRequest{Expr: &greptimev1.DdlRequest_CompactTable{CompactTable: &greptimev1.CompactTableExpr{
+		CatalogName:  catalog,
+		SchemaName:   schema,
+		TableName:    table,
+		RegionNumber: region,
+	}}}, nil
+}
+
+// integerTypes are the signed integer types and the unsigned types they
+// become with UNSIGNED.
+var integerTypes = map[string][2]greptimev1.ColumnDataType{
+	"TINYINT":  {greptimev1.ColumnDataType_INT8, greptimev1.ColumnDataType_UINT8},
+	"INT8":     {greptimev1.ColumnDataType_INT8, greptimev1.ColumnDataType_UINT8},
+	"SMALLINT": {greptimev1.ColumnDataType_INT16, greptimev1.ColumnDataType_UINT16},
+	"INT16":    {greptimev1.ColumnDataType_INT16, greptimev1.ColumnDataType_UINT16},
+	"INT":      {greptimev1.ColumnDataType_INT32, greptimev1.ColumnDataType_UINT32},
+	"INTEGER":  {greptimev1.ColumnDataType_INT32, greptimev1.ColumnDataType_UINT32},
+	"INT32":    {greptimev1.ColumnDataType_INT32, greptimev1.ColumnDataType_UINT32},
+	"BIGINT":   {greptimev1.ColumnDataType_INT64, greptimev1.ColumnDataType_UINT64},
+	"INT64":    {greptimev1.ColumnDataType_INT64, greptimev1.ColumnDataType_UINT64},
+}
+
+// simpleTypes are the types taking no UNSIGNED or precision, some taking
+// an ignored length.
+var simpleTypes = map[string]greptimev1.ColumnDataType{
+	"BOOLEAN":   greptimev1.ColumnDataType_BOOLEAN,
+	"BOOL":      greptimev1.ColumnDataType_BOOLEAN,
+	"UINT8":     greptimev1.ColumnDataType_UINT8,
+	"UINT16":    greptimev1.ColumnDataType_UINT16,
+	"UINT32":    greptimev1.ColumnDataType_UINT32,
+	"UINT64":    greptimev1.ColumnDataType_UINT64,
+	"FLOAT":     greptimev1.ColumnDataType_FLOAT32,
+	"FLOAT32":   greptimev1.ColumnDataType_FLOAT32,
+	"REAL":      greptimev1.ColumnDataType_FLOAT32,
+	"DOUBLE":    greptimev1.ColumnDataType_FLOAT64,
+	"FLOAT64":   greptimev1.ColumnDataType_FLOAT64,
+	"VARBINARY": greptimev1.ColumnDataType_BINARY,
+	"BINARY":    greptimev1.ColumnDataType_BINARY,
+	"BYTEA":     greptimev1.ColumnDataType_BINARY,
+	"BLOB":      greptimev1.ColumnDataType_BINARY,
+	"STRING":    greptimev1.ColumnDataType_STRING,
+	"TEXT":      greptimev1.ColumnDataType_STRING,
+	"VARCHAR":   greptimev1.ColumnDataType_STRING,
+	"CHAR":      greptimev1.ColumnDataType_STRING,
+	"DATE":      greptimev1.ColumnDataType_DATE,
+	"DATETIME":  greptimev1.ColumnDataType_DATETIME,
+
+	"TIMESTAMP_S":  greptimev1.ColumnDataType_TIMESTAMP_SECOND,
+	"TIMESTAMP_MS": greptimev1.ColumnDataType_TIMESTAMP_MILLISECOND,
+	"TIMESTAMP_US": greptimev1.ColumnDataType_TIMESTAMP_MICROSECOND,
+	"TIMESTAMP_NS": greptimev1.ColumnDataType_TIMESTAMP_NANOSECOND,
+}
+
+// precisionTypes are the types taking a precision of 0, 3, 6 or 9
+// fractional digits, 3 by default.
+var precisionTypes = map[string][4]greptimev1.ColumnDataType{
+	"TIMESTAMP": {
+		greptimev1.ColumnDataType_TIMESTAMP_SECOND,
+		greptimev1.ColumnDataType_TIMESTAMP_MILLISECOND,
+		greptimev1.ColumnDataType_TIMESTAMP_MICROSECOND,
+		greptimev1.ColumnDataType_TIMESTAMP_NANOSECOND,
+	},
+	"TIME": {
+		greptimev1.ColumnDataType_TIME_SECOND,
+		greptimev1.ColumnDataType_TIME_MILLISECOND,
+		greptimev1.ColumnDataType_TIME_MICROSECOND,
+		greptimev1.ColumnDataType_TIME_NANOSECOND,
+	},
+}
+
+// parseType parses an SQL type.
+func parseType(p *sqlscan.Parser) (greptimev1.ColumnDataType, error) {
+	t := p.Peek()
+	if t.Kind != sqlscan.Ident {
+		return 0, p.Errorf("expect a type")
+	}
+	name := strings.ToUpper(t.Text)
+	if types, ok := integerTypes[name]; ok {
+		p.Next()
+		if _, err := parseLength(p); err != nil {
+			return 0, err
+		}
+		if p.Keyword("UNSIGNED") {
+			return types[1], nil
+		}
+		return types[0], nil
+	}
+	if datatype, ok := simpleTypes[name]; ok {
+		p.Next()
+		if datatype == greptimev1.ColumnDataType_FLOAT64 {
+			p.Keyword("PRECISION")
+		}
+		_, err := parseLength(p)
+		return datatype, err
+	}
+	if types, ok := precisionTypes[name]; ok {
+		p.Next()
+		precision, err := parseLength(p)
+		if err != nil {
+			return 0, err
+		}
+		switch precision {
+		case 0:
+			return types[0], nil
+		case -1, 3:
+			return types[1], nil
+		case 6:
+			return types[2], nil
+		case 9:
+			return types[3], nil
+		}
+		return 0, p.Errorf("unsupported %s precision %d", name, precision)
+	}
+	return 0, p.Errorf("unknown type %s", t.Text)
+}
+
+// parseLength parses an optional parenthesized length or precision, -1 if
+// missing.
+func parseLength(p *sqlscan.Parser) (int, error) {
+	if !p.Symbol("(") {
+		return -1, nil
+	}
+	t := p.Next()
+	n, err := strconv.Atoi(t.Text)
+	if t.Kind != sqlscan.Number || err != nil {
+		return 0, p.Errorf("expect a length")
+	}
+	return n, p.ExpectSymbol(")")
+}
+
+// parseDefault parses the default of a column of datatype and returns its
+// default_constraint.
+func parseDefault(p *sqlscan.Parser, datatype greptimev1.ColumnDataType) ([]byte, error) {
+	t := p.Next()
+	switch {
+	case t.Is("NULL"):
+		return greptimev1.DefaultValue(datatype, nil)
+	case t.Is("TRUE"), t.Is("FALSE"):
+		return defaultValue(p, datatype, t.Is("TRUE"))
+	case t.Is("CURRENT_TIMESTAMP") && p.Peek().Text != "(":
+		return greptimev1.DefaultFunction(greptimev1.DefaultCurrentTimestamp), nil
+	case t.Is("X") && p.Peek().Kind == sqlscan.String:
+		b, err := hex.DecodeString(p.Next().Text)
+		if err != nil {
+			return nil, p.Errorf("invalid hexadecimal string")
+		}
+		return defaultValue(p, datatype, b)
+	case t.Kind == sqlscan.Ident && p.Symbol("("):
+		if err := p.ExpectSymbol(")"); err != nil {
+			return nil, err
+		}
+		return greptimev1.DefaultFunction(strings.ToLower(t.Text) + "()"), nil
+	case t.Kind == sqlscan.Symbol && t.Text == "-" && p.Peek().Kind == sqlscan.Number:
+		return defaultNumber(p, datatype, "-"+p.Next().Text)
+	case t.Kind == sqlscan.Number:
+		return defaultNumber(p, datatype, t.Text)
+	case t.Kind == sqlscan.String:
+		return defaultString(p, datatype, t.Text)
+	}
+	return nil, p.Errorf("expect a default value")
+}
+
+func defaultValue(p *sqlscan.Parser, datatype greptimev1.ColumnDataType, v any) ([]byte, error) {
+	b, err := greptimev1.DefaultValue(datatype, v)
+	if err != nil {
+		return nil, p.Errorf("invalid default: %v", err)
+	}
+	return b, nil
+}
+
+// defaultNumber converts a number to the default of a column of datatype,
+// the raw representation of dates and times being accepted.
+func defaultNumber(p *sqlscan.Parser, datatype greptimev1.ColumnDataType, text string) ([]byte, error) {
+	var v any
+	var err error
+	switch datatype {
+	case greptimev1.ColumnDataType_FLOAT32, greptimev1.ColumnDataType_FLOAT64:
+		v, err = strconv.ParseFloat(text, 64)
+	case greptimev1.ColumnDataType_UINT8, greptimev1.ColumnDataType_UINT16,
+		greptimev1.ColumnDataType_UINT32, greptimev1.ColumnDataType_UINT64:
+		v, err = strconv.ParseUint(text, 10, 64)
+	default:
+		v, err = strconv.ParseInt(text, 10, 64)
+	}
+	if err != nil {
+		return nil, p.Errorf("invalid %s default %s", datatype, text)
+	}
+	return defaultValue(p, datatype, v)
+}
+
+// timeLayouts are the layouts of the strings accepted as dates, datetimes
+// and timestamps, in UTC unless they have an offset.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	dateLayout,
+}
+
+// defaultString converts a string to the default of a column of datatype,
+// parsing it unless the column holds strings or bytes.
+func defaultString(p *sqlscan.Parser, datatype greptimev1.ColumnDataType, s string) ([]byte, error) {
+	switch datatype {
+	case greptimev1.ColumnDataType_STRING:
+		return defaultValue(p, datatype, s)
+	case greptimev1.ColumnDataType_BINARY:
+		return defaultValue(p, datatype, []byte(s))
+	case greptimev1.ColumnDataType_BOOLEAN:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, p.Errorf("invalid BOOLEAN default %q", s)
+		}
+		return defaultValue(p, datatype, b)
+	case greptimev1.ColumnDataType_TIME_SECOND, greptimev1.ColumnDataType_TIME_MILLISECOND,
+		greptimev1.ColumnDataType_TIME_MICROSECOND, greptimev1.ColumnDataType_TIME_NANOSECOND:
+		t, err := time.Parse(timeLayout, s)
+		if err != nil {
+			return nil, p.Errorf("invalid %s default %q", datatype, s)
+		}
+		return defaultValue(p, datatype, t.Sub(time.Date(0, 1, 1, 0, 0, 0, 0, time.UTC)))
+	case greptimev1.ColumnDataType_DATE, greptimev1.ColumnDataType_DATETIME,
+		greptimev1.ColumnDataType_TIMESTAMP_SECOND, greptimev1.ColumnDataType_TIMESTAMP_MILLISECOND,
+		greptimev1.ColumnDataType_TIMESTAMP_MICROSECOND, greptimev1.ColumnDataType_TIMESTAMP_NANOSECOND:
+		for _, layout := range timeLayouts {
+			if t, err := time.Parse(layout, s); err == nil {
+				return defaultValue(p, datatype, t)
+			}
+		}
+		return nil, p.Errorf("invalid %s default %q", datatype, s)
+	}
+	return defaultNumber(p, datatype, s)
+}
@@ -0,0 +1,243 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ddlsql
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	greptimev1 "github.com/GreptimeTeam/greptime-proto/go/greptime/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// defaults are a default value of every datatype.
+var defaults = []struct {
+	datatype greptimev1.ColumnDataType
+	v        any
+}{
+	{greptimev1.ColumnDataType_BOOLEAN, true},
+	{greptimev1.ColumnDataType_INT8, int8(-8)},
+	{greptimev1.ColumnDataType_INT16, int16(-16)},
+	{greptimev1.ColumnDataType_INT32, int32(-32)},
+	{greptimev1.ColumnDataType_INT64, int64(-1 << 63)},
+	{greptimev1.ColumnDataType_UINT8, uint8(8)},
+	{greptimev1.ColumnDataType_UINT16, uint16(16)},
+	{greptimev1.ColumnDataType_UINT32, uint32(32)},
+	{greptimev1.ColumnDataType_UINT64, uint64(1<<64 - 1)},
+	{greptimev1.ColumnDataType_FLOAT32, float32(0.1)},
+	{greptimev1.ColumnDataType_FLOAT64, -1.5e-10},
+	{greptimev1.ColumnDataType_BINARY, []byte{0, 0xff}},
+	{greptimev1.ColumnDataType_STRING, "it's"},
+	{greptimev1.ColumnDataType_DATE, time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)},
+	{greptimev1.ColumnDataType_DATETIME, time.Date(2023, 6, 1, 1, 2, 3, 0, time.UTC)},
+	{greptimev1.ColumnDataType_TIMESTAMP_SECOND, time.Date(2023, 6, 1, 1, 2, 3, 0, time.UTC)},
+	{greptimev1.ColumnDataType_TIMESTAMP_MILLISECOND, time.Date(2023, 6, 1, 1, 2, 3, 4e6, time.UTC)},
+	{greptimev1.ColumnDataType_TIMESTAMP_MICROSECOND, time.Date(1969, 6, 1, 1, 2, 3, 4e3, time.UTC)},
+	{greptimev1.ColumnDataType_TIMESTAMP_NANOSECOND, time.Date(2023, 6, 1, 1, 2, 3, 4, time.UTC)},
+	{greptimev1.ColumnDataType_TIME_SECOND, time.Hour + time.Second},
+	{greptimev1.ColumnDataType_TIME_MILLISECOND, 1500 * time.Millisecond},
+	{greptimev1.ColumnDataType_TIME_MICROSECOND, 1500 * time.Microsecond},
+	{greptimev1.ColumnDataType_TIME_NANOSECOND, 23*time.Hour + 1500},
+}
+
+// TestRenderParse checks Parse returns the requests Render renders.
+func TestRenderParse(t *testing.T) {
+	table := greptimev1.NewTable("t").Catalog("c").Schema("my schema").IfNotExists().
+		Tag("host", greptimev1.ColumnDataType_STRING).
+		Tag("Region", greptimev1.ColumnDataType_STRING).
+		Column(&greptimev1.ColumnDef{
+			Name:              "ts",
+			Datatype:          greptimev1.ColumnDataType_TIMESTAMP_NANOSECOND,
+			DefaultConstraint: greptimev1.DefaultFunction(greptimev1.DefaultCurrentTimestamp),
+		}).
+		TimeIndex("ts").
+		Desc("a 'table'").
+		Option("ttl", "7d").
+		Option("compaction.type", "twcs").
+		RegionNumbers(0, 1, 2)
+	for i, d := range defaults {
+		def := &greptimev1.ColumnDef{Name: "c" + d.datatype.String(), Datatype: d.datatype, IsNullable: i%2 == 0}
+		def.DefaultConstraint = mustDefaultValue(t, d.datatype, d.v)
+		table.Column(def)
+		table.Field("null"+d.datatype.String(), d.datatype)
+	}
+	table.Column(&greptimev1.ColumnDef{
+		Name:              "nothing",
+		Datatype:          greptimev1.ColumnDataType_INT64,
+		IsNullable:        true,
+		DefaultConstraint: mustDefaultValue(t, greptimev1.ColumnDataType_INT64, nil),
+	})
+
+	region := uint32(3)
+	reqs := []*greptimev1.DdlRequest{
+		{Expr: &greptimev1.DdlRequest_CreateDatabase{CreateDatabase: &greptimev1.CreateDatabaseExpr{DatabaseName: "select"}}},
+		createTable(t, table),
+		createTable(t, greptimev1.NewTable("minimal").Timestamp("ts", greptimev1.ColumnDataType_TIMESTAMP_SECOND)),
+		addColumns("t", &greptimev1.AddColumn{
+			ColumnDef: &greptimev1.ColumnDef{Name: "a", Datatype: greptimev1.ColumnDataType_UINT16, IsNullable: true},
+			IsKey:     true,
+			Location:  &greptimev1.AddColumn_Location{LocationType: greptimev1.AddColumn_Location_AFTER, AfterCloumnName: "host"},
+		}),
+		addColumns("t", &greptimev1.AddColumn{
+			ColumnDef: &greptimev1.ColumnDef{Name: "b", Datatype: greptimev1.ColumnDataType_FLOAT64, DefaultConstraint: mustDefaultValue(t, greptimev1.ColumnDataType_FLOAT64, 0.0)},
+			Location:  &greptimev1.AddColumn_Location{LocationType: greptimev1.AddColumn_Location_FIRST},
+		}),
+		alter(&greptimev1.AlterExpr{
+			CatalogName: "c",
+			SchemaName:  "s",
+			TableName:   "t",
+			Kind:        &greptimev1.AlterExpr_DropColumns{DropColumns: &greptimev1.DropColumns{DropColumns: []*greptimev1.DropColumn{{Name: "A b"}}}},
+		}),
+		alter(&greptimev1.AlterExpr{
+			TableName: "t",
+			Kind:      &greptimev1.AlterExpr_RenameTable{RenameTable: &greptimev1.RenameTable{NewTableName: "u"}},
+		}),
+		{Expr: &greptimev1.DdlRequest_DropTable{DropTable: &greptimev1.DropTableExpr{SchemaName: "s", TableName: "t"}}},
+		{Expr: &greptimev1.DdlRequest_FlushTable{FlushTable: &greptimev1.FlushTableExpr{SchemaName: "s", TableName: "t"}}},
+		{Expr: &greptimev1.DdlRequest_CompactTable{CompactTable: &greptimev1.CompactTableExpr{CatalogName: "c", SchemaName: "s", TableName: "T", RegionNumber: &region}}},
+	}
+	for _, req := range reqs {
+		sql, err := Render(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Parse(sql)
+		if err != nil {
+			t.Errorf("Parse(%s): %v", sql, err)
+			continue
+		}
+		if len(got) != 1 || !proto.Equal(got[0], req) {
+			t.Errorf("Parse(%s) = %v, want %v", sql, got, req)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want []*greptimev1.DdlRequest
+	}{
+		{
+			name: "inline keys and aliases",
+			sql: `create table if not exists "Cpu" (
+				host varchar(64) primary key,
+				usage double precision not null,
+				ts timestamp time index default current_timestamp
+			) engine = mito comment = 'cpu' with ('ttl' = '1d', regions = 2);`,
+			want: []*greptimev1.DdlRequest{createTable(t, greptimev1.NewTable("Cpu").IfNotExists().
+				Tag("host", greptimev1.ColumnDataType_STRING).
+				Column(&greptimev1.ColumnDef{Name: "usage", Datatype: greptimev1.ColumnDataType_FLOAT64}).
+				Column(&greptimev1.ColumnDef{
+					Name:              "ts",
+					Datatype:          greptimev1.ColumnDataType_TIMESTAMP_MILLISECOND,
+					DefaultConstraint: greptimev1.DefaultFunction(greptimev1.DefaultCurrentTimestamp),
+				}).
+				TimeIndex("ts").
+				Desc("cpu").
+				Option("ttl", "1d").
+				RegionNumbers(0, 1))},
+		},
+		{
+			name: "statements",
+			sql:  "CREATE DATABASE db;; ALTER TABLE t ADD x BIGINT UNSIGNED; ALTER TABLE t DROP x; ALTER TABLE t RENAME TO u",
+			want: []*greptimev1.DdlRequest{
+				{Expr: &greptimev1.DdlRequest_CreateDatabase{CreateDatabase: &greptimev1.CreateDatabaseExpr{DatabaseName: "db"}}},
+				addColumns("t", &greptimev1.AddColumn{ColumnDef: &greptimev1.ColumnDef{Name: "x", Datatype: greptimev1.ColumnDataType_UINT64, IsNullable: true}}),
+				alter(&greptimev1.AlterExpr{
+					TableName: "t",
+					Kind:      &greptimev1.AlterExpr_DropColumns{DropColumns: &greptimev1.DropColumns{DropColumns: []*greptimev1.DropColumn{{Name: "x"}}}},
+				}),
+				alter(&greptimev1.AlterExpr{
+					TableName: "t",
+					Kind:      &greptimev1.AlterExpr_RenameTable{RenameTable: &greptimev1.RenameTable{NewTableName: "u"}},
+				}),
+			},
+		},
+		{
+			name: "defaults",
+			sql:  "ALTER TABLE t ADD COLUMN d DATE DEFAULT 19000; ALTER TABLE t ADD COLUMN f FLOAT DEFAULT -1",
+			want: []*greptimev1.DdlRequest{
+				addColumns("t", &greptimev1.AddColumn{ColumnDef: &greptimev1.ColumnDef{
+					Name:              "d",
+					Datatype:          greptimev1.ColumnDataType_DATE,
+					IsNullable:        true,
+					DefaultConstraint: mustDefaultValue(t, greptimev1.ColumnDataType_DATE, time.Unix(19000*86400, 0).UTC()),
+				}}),
+				addColumns("t", &greptimev1.AddColumn{ColumnDef: &greptimev1.ColumnDef{
+					Name:              "f",
+					Datatype:          greptimev1.ColumnDataType_FLOAT32,
+					IsNullable:        true,
+					DefaultConstraint: mustDefaultValue(t, greptimev1.ColumnDataType_FLOAT32, float32(-1)),
+				}}),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Parse() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if !proto.Equal(got[i], tt.want[i]) {
+					t.Errorf("statement %d: %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, sql := range []string{
+		"SELECT 1",
+		"CREATE TABLE t (ts TIMESTAMP)",
+		"CREATE TABLE t (ts TIMESTAMP TIME INDEX, ts BIGINT)",
+		"CREATE TABLE t (ts BIGINT TIME INDEX)",
+		"CREATE TABLE t (ts TIMESTAMP NULL TIME INDEX)",
+		"CREATE TABLE t (ts TIMESTAMP TIME INDEX, PRIMARY KEY (x))",
+		"CREATE TABLE t (ts TIMESTAMP(2) TIME INDEX)",
+		"CREATE TABLE t (ts TIMESTAMP TIME INDEX) WITH (regions = 0)",
+		"CREATE TABLE t (ts TIMESTAMP TIME INDEX) WITH (regions = 4097)",
+		"CREATE TABLE t (ts TIMESTAMP TIME INDEX) WITH (regions = 4294967295)",
+		"CREATE TABLE t (ts TIMESTAMP TIME INDEX, v TINYINT DEFAULT 128)",
+		"CREATE TABLE t (ts TIMESTAMP TIME INDEX, v INT DEFAULT 'a')",
+		"ALTER TABLE t ADD COLUMN ts TIMESTAMP TIME INDEX",
+		"ALTER TABLE t MODIFY x INT",
+		"DROP TABLE a.b.c.d",
+		"SELECT flush_table('t', x)",
+		"DROP TABLE t DROP TABLE u",
+	} {
+		if got, err := Parse(sql); err == nil {
+			t.Errorf("Parse(%q) = %v, want an error", sql, got)
+		}
+	}
+}
+
+func TestParseMaxRegions(t *testing.T) {
+	sql := fmt.Sprintf("CREATE TABLE t (ts TIMESTAMP TIME INDEX) WITH (regions = %d)", greptimev1.MaxRegions)
+	reqs, err := Parse(sql)
+	if err != nil {
+		t.Fatal(err)
+	}
+	regions := reqs[0].GetCreateTable().GetRegionNumbers()
+	if len(regions) != greptimev1.MaxRegions || regions[len(regions)-1] != greptimev1.MaxRegions-1 {
+		t.Errorf("Parse(%q) has %d regions, want 0 to %d", sql, len(regions), greptimev1.MaxRegions-1)
+	}
+}
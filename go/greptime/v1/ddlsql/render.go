@@ -0,0 +1,347 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ddlsql converts DdlRequests to and from GreptimeDB SQL statements.
+package ddlsql
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	greptimev1 "github.com/GreptimeTeam/greptime-proto/go/greptime/v1"
+)
+
+// sqlTypes are the SQL types of the column datatypes.
+var sqlTypes = map[greptimev1.ColumnDataType]string{
+	greptimev1.ColumnDataType_BOOLEAN:               "BOOLEAN",
+	greptimev1.ColumnDataType_INT8:                  "TINYINT",
+	greptimev1.ColumnDataType_INT16:                 "SMALLINT",
+	greptimev1.ColumnDataType_INT32:                 "INT",
+	greptimev1.ColumnDataType_INT64:                 "BIGINT",
+	greptimev1.ColumnDataType_UINT8:                 "TINYINT UNSIGNED",
+	greptimev1.ColumnDataType_UINT16:                "SMALLINT UNSIGNED",
+	greptimev1.ColumnDataType_UINT32:                "INT UNSIGNED",
+	greptimev1.ColumnDataType_UINT64:                "BIGINT UNSIGNED",
+	greptimev1.ColumnDataType_FLOAT32:               "FLOAT",
+	greptimev1.ColumnDataType_FLOAT64:               "DOUBLE",
+	greptimev1.ColumnDataType_BINARY:                "VARBINARY",
+	greptimev1.ColumnDataType_STRING:                "STRING",
+	greptimev1.ColumnDataType_DATE:                  "DATE",
+	greptimev1.ColumnDataType_DATETIME:              "DATETIME",
+	greptimev1.ColumnDataType_TIMESTAMP_SECOND:      "TIMESTAMP(0)",
+	greptimev1.ColumnDataType_TIMESTAMP_MILLISECOND: "TIMESTAMP(3)",
+	greptimev1.ColumnDataType_TIMESTAMP_MICROSECOND: "TIMESTAMP(6)",
+	greptimev1.ColumnDataType_TIMESTAMP_NANOSECOND:  "TIMESTAMP(9)",
+	greptimev1.ColumnDataType_TIME_SECOND:           "TIME(0)",
+	greptimev1.ColumnDataType_TIME_MILLISECOND:      "TIME(3)",
+	greptimev1.ColumnDataType_TIME_MICROSECOND:      "TIME(6)",
+	greptimev1.ColumnDataType_TIME_NANOSECOND:       "TIME(9)",
+}
+
+// SQLType returns the SQL type of the columns of a datatype, like BIGINT or
+// TIMESTAMP(3).
+func SQLType(datatype greptimev1.ColumnDataType) (string, error) {
+	t, ok := sqlTypes[datatype]
+	if !ok {
+		return "", fmt.Errorf("unknown datatype %d", datatype)
+	}
+	return t, nil
+}
+
+// The layouts of the string literals of dates, datetimes and times.
+const (
+	dateLayout     = "2006-01-02"
+	datetimeLayout = "2006-01-02 15:04:05.999"
+	timeLayout     = "15:04:05.999999999"
+)
+
+// reserved are the keywords quoted when used as identifiers.
+var reserved = map[string]bool{
+	"add": true, "after": true, "alter": true, "and": true, "as": true,
+	"by": true, "column": true, "create": true, "database": true,
+	"default": true, "drop": true, "engine": true, "exists": true,
+	"first": true, "from": true, "if": true, "index": true, "key": true,
+	"not": true, "null": true, "or": true, "order": true, "primary": true,
+	"rename": true, "select": true, "table": true, "time": true,
+	"timestamp": true, "where": true, "with": true,
+}
+
+// Ident returns name as an SQL identifier, double-quoted unless it is a
+// plain lower case name that isn't a keyword.
+func Ident(name string) string {
+	plain := name != "" && !reserved[name]
+	for i, c := range name {
+		if !(c == '_' || 'a' <= c && c <= 'z' || i > 0 && '0' <= c && c <= '9') {
+			plain = false
+			break
+		}
+	}
+	if plain {
+		return name
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// Quote returns s as an SQL string literal.
+func Quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// tableName returns the name of a table, qualified with its schema and
+// catalog when set.
+func tableName(catalog, schema, table string) string {
+	name := Ident(table)
+	if schema != "" {
+		name = Ident(schema) + "." + name
+		if catalog != "" {
+			name = Ident(catalog) + "." + name
+		}
+	}
+	return name
+}
+
+// Render returns the SQL statements equivalent to a DDL request, each
+// ending with a semicolon and separated by new lines. An AlterExpr adding
+// or dropping several columns renders as one ALTER TABLE per column, and
+// its table_version precondition is not rendered. Flushes and compactions
+// render as calls of the flush_table and compact_table functions.
+func Render(req *greptimev1.DdlRequest) (string, error) {
+	var stmts []string
+	var err error
+	switch expr := req.GetExpr().(type) {
+	case *greptimev1.DdlRequest_CreateDatabase:
+		stmts = []string{CreateDatabase(expr.CreateDatabase)}
+	case *greptimev1.DdlRequest_CreateTable:
+		var stmt string
+		stmt, err = CreateTable(expr.CreateTable)
+		stmts = []string{stmt}
+	case *greptimev1.DdlRequest_Alter:
+		stmts, err = Alter(expr.Alter)
+	case *greptimev1.DdlRequest_DropTable:
+		stmts = []string{DropTable(expr.DropTable)}
+	case *greptimev1.DdlRequest_FlushTable:
+		stmts = []string{FlushTable(expr.FlushTable)}
+	case *greptimev1.DdlRequest_CompactTable:
+		stmts = []string{CompactTable(expr.CompactTable)}
+	default:
+		err = fmt.Errorf("unsupported DDL request %T", req.GetExpr())
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(stmts, ";\n") + ";", nil
+}
+
+// CreateDatabase renders a CREATE DATABASE statement.
+func CreateDatabase(expr *greptimev1.CreateDatabaseExpr) string {
+	var b strings.Builder
+	b.WriteString("CREATE DATABASE ")
+	if expr.GetCreateIfNotExists() {
+		b.WriteString("IF NOT EXISTS ")
+	}
+	b.WriteString(Ident(expr.GetDatabaseName()))
+	return b.String()
+}
+
+// columnDef renders the definition of a column.
+func columnDef(def *greptimev1.ColumnDef) (string, error) {
+	t, err := SQLType(def.GetDatatype())
+	if err != nil {
+		return "", fmt.Errorf("column %q: %w", def.GetName(), err)
+	}
+	null := "NOT NULL"
+	if def.GetIsNullable() {
+		null = "NULL"
+	}
+	sql := Ident(def.GetName()) + " " + t + " " + null
+	constraint, err := def.Default()
+	if err != nil {
+		return "", fmt.Errorf("column %q: %w", def.GetName(), err)
+	}
+	if constraint != nil {
+		value := constraint.Function
+		if value == "" {
+			if value, err = Literal(def.GetDatatype(), constraint.Value); err != nil {
+				return "", fmt.Errorf("column %q: %w", def.GetName(), err)
+			}
+		}
+		sql += " DEFAULT " + value
+	}
+	return sql, nil
+}
+
+// Literal returns v as the SQL literal of a value of datatype, v having
+// the Go type of Column.Decode, or being nil for NULL. Binary values render
+// as hexadecimal strings, dates and times as strings.
+func Literal(datatype greptimev1.ColumnDataType, v any) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "NULL", nil
+	case bool:
+		if v {
+			return "TRUE", nil
+		}
+		return "FALSE", nil
+	case int8, int16, int32, int64, uint8, uint16, uint32, uint64:
+		return fmt.Sprint(v), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32), nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	case string:
+		return Quote(v), nil
+	case []byte:
+		return "X'" + hex.EncodeToString(v) + "'", nil
+	case time.Time:
+		switch datatype {
+		case greptimev1.ColumnDataType_DATE:
+			return Quote(v.UTC().Format(dateLayout)), nil
+		case greptimev1.ColumnDataType_DATETIME:
+			return Quote(v.UTC().Format(datetimeLayout)), nil
+		}
+		return Quote(v.UTC().Format(time.RFC3339Nano)), nil
+	case time.Duration:
+		if v < 0 || v >= 24*time.Hour {
+			return "", fmt.Errorf("time %v out of range", v)
+		}
+		return Quote(time.Time{}.Add(v).Format(timeLayout)), nil
+	}
+	return "", fmt.Errorf("cannot render %T value %v", v, v)
+}
+
+func identList(names []string) string {
+	idents := make([]string, len(names))
+	for i, name := range names {
+		idents[i] = Ident(name)
+	}
+	return strings.Join(idents, ", ")
+}
+
+// CreateTable renders a CREATE TABLE statement in the layout of SHOW
+// CREATE TABLE. The number of region numbers is rendered as the "regions"
+// option and the description as a COMMENT.
+func CreateTable(expr *greptimev1.CreateTableExpr) (string, error) {
+	var b strings.Builder
+	b.WriteString("CREATE TABLE ")
+	if expr.GetCreateIfNotExists() {
+		b.WriteString("IF NOT EXISTS ")
+	}
+	b.WriteString(tableName(expr.GetCatalogName(), expr.GetSchemaName(), expr.GetTableName()))
+	b.WriteString(" (\n")
+	for _, def := range expr.GetColumnDefs() {
+		sql, err := columnDef(def)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString("  " + sql + ",\n")
+	}
+	b.WriteString("  TIME INDEX (" + Ident(expr.GetTimeIndex()) + ")")
+	if len(expr.GetPrimaryKeys()) > 0 {
+		b.WriteString(",\n  PRIMARY KEY (" + identList(expr.GetPrimaryKeys()) + ")")
+	}
+	b.WriteString("\n)")
+	if expr.GetEngine() != "" {
+		b.WriteString("\nENGINE=" + expr.GetEngine())
+	}
+	if expr.GetDesc() != "" {
+		b.WriteString("\nCOMMENT " + Quote(expr.GetDesc()))
+	}
+
+	var options []string
+	if n := len(expr.GetRegionNumbers()); n > 0 {
+		options = append(options, "regions = "+strconv.Itoa(n))
+	}
+	keys := make([]string, 0, len(expr.GetTableOptions()))
+	for key := range expr.GetTableOptions() {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		options = append(options, Ident(key)+" = "+Quote(expr.GetTableOptions()[key]))
+	}
+	if len(options) > 0 {
+		b.WriteString("\nWITH(\n  " + strings.Join(options, ",\n  ") + "\n)")
+	}
+	return b.String(), nil
+}
+
+// Alter renders the ALTER TABLE statements of an AlterExpr, one per added
+// or dropped column.
+func Alter(expr *greptimev1.AlterExpr) ([]string, error) {
+	prefix := "ALTER TABLE " + tableName(expr.GetCatalogName(), expr.GetSchemaName(), expr.GetTableName()) + " "
+	var stmts []string
+	switch kind := expr.GetKind().(type) {
+	case *greptimev1.AlterExpr_AddColumns:
+		for _, add := range kind.AddColumns.GetAddColumns() {
+			sql, err := columnDef(add.GetColumnDef())
+			if err != nil {
+				return nil, err
+			}
+			stmt := prefix + "ADD COLUMN " + sql
+			if add.GetIsKey() {
+				stmt += " PRIMARY KEY"
+			}
+			if loc := add.GetLocation(); loc != nil {
+				switch loc.GetLocationType() {
+				case greptimev1.AddColumn_Location_FIRST:
+					stmt += " FIRST"
+				case greptimev1.AddColumn_Location_AFTER:
+					stmt += " AFTER " + Ident(loc.GetAfterCloumnName())
+				}
+			}
+			stmts = append(stmts, stmt)
+		}
+	case *greptimev1.AlterExpr_DropColumns:
+		for _, drop := range kind.DropColumns.GetDropColumns() {
+			stmts = append(stmts, prefix+"DROP COLUMN "+Ident(drop.GetName()))
+		}
+	case *greptimev1.AlterExpr_RenameTable:
+		stmts = append(stmts, prefix+"RENAME "+Ident(kind.RenameTable.GetNewTableName()))
+	default:
+		return nil, fmt.Errorf("unsupported alter kind %T", expr.GetKind())
+	}
+	if len(stmts) == 0 {
+		return nil, fmt.Errorf("alter of table %q changes nothing", expr.GetTableName())
+	}
+	return stmts, nil
+}
+
+// DropTable renders a DROP TABLE statement.
+func DropTable(expr *greptimev1.DropTableExpr) string {
+	return "DROP TABLE " + tableName(expr.GetCatalogName(), expr.GetSchemaName(), expr.GetTableName())
+}
+
+// tableFunction renders the call of an administration function taking a
+// table name and an optional region number.
+func tableFunction(function, catalog, schema, table string, region *uint32) string {
+	args := Quote(tableName(catalog, schema, table))
+	if region != nil {
+		args += ", " + strconv.FormatUint(uint64(*region), 10)
+	}
+	return "SELECT " + function + "(" + args + ")"
+}
+
+// FlushTable renders a call of flush_table.
+func FlushTable(expr *greptimev1.FlushTableExpr) string {
+	return tableFunction("flush_table", expr.GetCatalogName(), expr.GetSchemaName(), expr.GetTableName(), expr.RegionNumber)
+}
+
+// CompactTable renders a call of compact_table.
+func CompactTable(expr *greptimev1.CompactTableExpr) string {
+	return tableFunction("compact_table", expr.GetCatalogName(), expr.GetSchemaName(), expr.GetTableName(), expr.RegionNumber)
+}
@@ -0,0 +1,217 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ddlsql
+
+import (
+	"testing"
+	"time"
+
+	greptimev1 "github.com/GreptimeTeam/greptime-proto/go/greptime/v1"
+)
+
+func createTable(t *testing.T, b *greptimev1.TableBuilder) *greptimev1.DdlRequest {
+	t.Helper()
+	expr, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &greptimev1.DdlRequest{Expr: &greptimev1.DdlRequest_CreateTable{CreateTable: expr}}
+}
+
+func alter(expr *greptimev1.AlterExpr) *greptimev1.DdlRequest {
+	return &greptimev1.DdlRequest{Expr: &greptimev1.DdlRequest_Alter{Alter: expr}}
+}
+
+func addColumns(table string, adds ...*greptimev1.AddColumn) *greptimev1.DdlRequest {
+	return alter(&greptimev1.AlterExpr{
+		TableName: table,
+		Kind:      &greptimev1.AlterExpr_AddColumns{AddColumns: &greptimev1.AddColumns{AddColumns: adds}},
+	})
+}
+
+func mustDefaultValue(t *testing.T, datatype greptimev1.ColumnDataType, v any) []byte {
+	t.Helper()
+	b, err := greptimev1.DefaultValue(datatype, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestRender(t *testing.T) {
+	region := uint32(2)
+	tests := []struct {
+		name string
+		req  *greptimev1.DdlRequest
+		want string
+	}{
+		{
+			name: "create database",
+			req:  &greptimev1.DdlRequest{Expr: &greptimev1.DdlRequest_CreateDatabase{CreateDatabase: &greptimev1.CreateDatabaseExpr{DatabaseName: "db", CreateIfNotExists: true}}},
+			want: "CREATE DATABASE IF NOT EXISTS db;",
+		},
+		{
+			name: "create table",
+			req: createTable(t, greptimev1.NewTable("cpu").Schema("my db").IfNotExists().
+				Tag("host", greptimev1.ColumnDataType_STRING).
+				Column(&greptimev1.ColumnDef{
+					Name:              "usage",
+					Datatype:          greptimev1.ColumnDataType_FLOAT64,
+					IsNullable:        true,
+					DefaultConstraint: mustDefaultValue(t, greptimev1.ColumnDataType_FLOAT64, 1.5),
+				}).
+				Column(&greptimev1.ColumnDef{
+					Name:              "ts",
+					Datatype:          greptimev1.ColumnDataType_TIMESTAMP_MILLISECOND,
+					DefaultConstraint: greptimev1.DefaultFunction("current_timestamp()"),
+				}).
+				TimeIndex("ts").
+				Desc("it's").
+				Option("ttl", "7d").
+				RegionNumbers(0, 1)),
+			want: `CREATE TABLE IF NOT EXISTS "my db".cpu (
+  host STRING NULL,
+  usage DOUBLE NULL DEFAULT 1.5,
+  ts TIMESTAMP(3) NOT NULL DEFAULT current_timestamp(),
+  TIME INDEX (ts),
+  PRIMARY KEY (host)
+)
+ENGINE=mito
+COMMENT 'it''s'
+WITH(
+  regions = 2,
+  ttl = '7d'
+);`,
+		},
+		{
+			name: "add columns",
+			req: addColumns("t",
+				&greptimev1.AddColumn{
+					ColumnDef: &greptimev1.ColumnDef{Name: "a", Datatype: greptimev1.ColumnDataType_DATE, IsNullable: true},
+					IsKey:     true,
+					Location:  &greptimev1.AddColumn_Location{LocationType: greptimev1.AddColumn_Location_AFTER, AfterCloumnName: "b"},
+				},
+				&greptimev1.AddColumn{
+					ColumnDef: &greptimev1.ColumnDef{Name: "c", Datatype: greptimev1.ColumnDataType_TIME_SECOND},
+					Location:  &greptimev1.AddColumn_Location{LocationType: greptimev1.AddColumn_Location_FIRST},
+				}),
+			want: "ALTER TABLE t ADD COLUMN a DATE NULL PRIMARY KEY AFTER b;\nALTER TABLE t ADD COLUMN c TIME(0) NOT NULL FIRST;",
+		},
+		{
+			name: "drop column",
+			req: alter(&greptimev1.AlterExpr{
+				TableName: "t",
+				Kind:      &greptimev1.AlterExpr_DropColumns{DropColumns: &greptimev1.DropColumns{DropColumns: []*greptimev1.DropColumn{{Name: "select"}}}},
+			}),
+			want: `ALTER TABLE t DROP COLUMN "select";`,
+		},
+		{
+			name: "rename table",
+			req: alter(&greptimev1.AlterExpr{
+				SchemaName: "s",
+				TableName:  "t",
+				Kind:       &greptimev1.AlterExpr_RenameTable{RenameTable: &greptimev1.RenameTable{NewTableName: "u"}},
+			}),
+			want: "ALTER TABLE s.t RENAME u;",
+		},
+		{
+			name: "drop table",
+			req:  &greptimev1.DdlRequest{Expr: &greptimev1.DdlRequest_DropTable{DropTable: &greptimev1.DropTableExpr{CatalogName: "c", SchemaName: "s", TableName: "t"}}},
+			want: "DROP TABLE c.s.t;",
+		},
+		{
+			name: "flush table",
+			req:  &greptimev1.DdlRequest{Expr: &greptimev1.DdlRequest_FlushTable{FlushTable: &greptimev1.FlushTableExpr{TableName: "t", RegionNumber: &region}}},
+			want: "SELECT flush_table('t', 2);",
+		},
+		{
+			name: "compact table",
+			req:  &greptimev1.DdlRequest{Expr: &greptimev1.DdlRequest_CompactTable{CompactTable: &greptimev1.CompactTableExpr{TableName: "t"}}},
+			want: "SELECT compact_table('t');",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Render(tt.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Render() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	for _, req := range []*greptimev1.DdlRequest{
+		{},
+		addColumns("t"),
+		addColumns("t", &greptimev1.AddColumn{ColumnDef: &greptimev1.ColumnDef{Name: "a", Datatype: 100}}),
+		alter(&greptimev1.AlterExpr{TableName: "t"}),
+	} {
+		if got, err := Render(req); err == nil {
+			t.Errorf("Render(%v) = %q, want an error", req, got)
+		}
+	}
+}
+
+func TestLiteral(t *testing.T) {
+	tests := []struct {
+		datatype greptimev1.ColumnDataType
+		v        any
+		want     string
+	}{
+		{greptimev1.ColumnDataType_BOOLEAN, nil, "NULL"},
+		{greptimev1.ColumnDataType_BOOLEAN, true, "TRUE"},
+		{greptimev1.ColumnDataType_INT8, int8(-1), "-1"},
+		{greptimev1.ColumnDataType_UINT64, uint64(1 << 63), "9223372036854775808"},
+		{greptimev1.ColumnDataType_FLOAT32, float32(0.1), "0.1"},
+		{greptimev1.ColumnDataType_FLOAT64, 1e100, "1e+100"},
+		{greptimev1.ColumnDataType_STRING, "it's", "'it''s'"},
+		{greptimev1.ColumnDataType_BINARY, []byte{1, 0xab}, "X'01ab'"},
+		{greptimev1.ColumnDataType_DATE, time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC), "'2023-06-01'"},
+		{greptimev1.ColumnDataType_DATETIME, time.Date(2023, 6, 1, 1, 2, 3, 0, time.UTC), "'2023-06-01 01:02:03'"},
+		{greptimev1.ColumnDataType_TIMESTAMP_MILLISECOND, time.Date(2023, 6, 1, 1, 2, 3, 5e6, time.UTC), "'2023-06-01T01:02:03.005Z'"},
+		{greptimev1.ColumnDataType_TIME_MILLISECOND, time.Hour + 1500*time.Millisecond, "'01:00:01.5'"},
+	}
+	for _, tt := range tests {
+		got, err := Literal(tt.datatype, tt.v)
+		if err != nil || got != tt.want {
+			t.Errorf("Literal(%s, %v) = %q, %v, want %q", tt.datatype, tt.v, got, err, tt.want)
+		}
+	}
+	if got, err := Literal(greptimev1.ColumnDataType_TIME_SECOND, 24*time.Hour); err == nil {
+		t.Errorf("Literal of a time of 24h = %q, want an error", got)
+	}
+}
+
+func TestIdent(t *testing.T) {
+	tests := []struct{ name, want string }{
+		{"host", "host"},
+		{"_a1", "_a1"},
+		{"select", `"select"`},
+		{"Ab", `"Ab"`},
+		{"a b", `"a b"`},
+		{`a"b`, `"a""b"`},
+		{"1a", `"1a"`},
+		{"", `""`},
+	}
+	for _, tt := range tests {
+		if got := Ident(tt.name); got != tt.want {
+			t.Errorf("Ident(%q) = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
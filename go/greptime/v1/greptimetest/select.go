@@ -0,0 +1,599 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package greptimetest
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	greptimev1 "github.com/GreptimeTeam/greptime-proto/go/greptime/v1"
+	"github.com/GreptimeTeam/greptime-proto/go/internal/sqlscan"
+	"github.com/apache/arrow/go/v11/arrow"
+	"github.com/apache/arrow/go/v11/arrow/array"
+	"github.com/apache/arrow/go/v11/arrow/memory"
+)
+
+// selectStmt is a SELECT statement of the subset the server answers:
+//
+//	SELECT * | COUNT(*) | column [AS alias], ...
+//	FROM [[catalog.]schema.]table
+//	[WHERE condition AND ...]
+//	[ORDER BY column [ASC | DESC], ...]
+//	[LIMIT n [OFFSET m]]
+//
+// where a condition compares a column with a literal, or is
+// column IS [NOT] NULL.
+type selectStmt struct {
+	items   []selectItem
+	count   bool
+	table   []string
+	where   []condition
+	orderBy []ordering
+	limit   int
+	offset  int
+}
+
+type selectItem struct {
+	column string
+	alias  string
+}
+
+type condition struct {
+	column string
+	// op is a comparison operator, or "IS NULL" or "IS NOT NULL".
+	op  string
+	lit sqlscan.Token
+}
+
+type ordering struct {
+	column string
+	desc   bool
+}
+
+// isSelect reports whether sql is a SELECT statement.
+func isSelect(sql string) bool {
+	p, err := sqlscan.NewParser(sql)
+	return err == nil && p.Peek().Is("SELECT")
+}
+
+func parseSelect(sql string) (*selectStmt, error) {
+	p, err := sqlscan.NewParser(sql)
+	if err != nil {
+		return nil, err
+	}
+	stmt := &selectStmt{limit: -1}
+	if err := p.ExpectKeyword("SELECT"); err != nil {
+		return nil, err
+	}
+	switch {
+	case p.Symbol("*"):
+	case p.Keyword("COUNT"):
+		if err := expectSymbols(p, "(", "*", ")"); err != nil {
+			return nil, err
+		}
+		stmt.count = true
+	default:
+		for {
+			var item selectItem
+			if item.column, err = p.Ident(); err != nil {
+				return nil, err
+			}
+			item.alias = item.column
+			if p.Keyword("AS") {
+				if item.alias, err = p.Ident(); err != nil {
+					return nil, err
+				}
+			}
+			stmt.items = append(stmt.items, item)
+			if !p.Symbol(",") {
+				break
+			}
+		}
+	}
+
+	if err := p.ExpectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+	if stmt.table, err = p.ObjectName(); err != nil {
+		return nil, err
+	}
+	if len(stmt.table) > 3 {
+		return nil, fmt.Errorf("invalid table name %s", strings.Join(stmt.table, "."))
+	}
+
+	if p.Keyword("WHERE") {
+		for {
+			var cond condition
+			if cond.column, err = p.Ident(); err != nil {
+				return nil, err
+			}
+			switch {
+			case p.Keyword("IS", "NULL"):
+				cond.op = "IS NULL"
+			case p.Keyword("IS", "NOT", "NULL"):
+				cond.op = "IS NOT NULL"
+			default:
+				t := p.Next()
+				switch t.Text {
+				case "=", "!=", "<>", "<", "<=", ">", ">=":
+				default:
+					return nil, fmt.Errorf("expect a comparison operator at offset %d near %s", t.Pos, t)
+				}
+				cond.op = t.Text
+				if cond.lit, err = parseLiteral(p); err != nil {
+					return nil, err
+				}
+			}
+			stmt.where = append(stmt.where, cond)
+			if !p.Keyword("AND") {
+				break
+			}
+		}
+	}
+
+	if p.Keyword("ORDER", "BY") {
+		for {
+			var o ordering
+			if o.column, err = p.Ident(); err != nil {
+				return nil, err
+			}
+			if p.Keyword("DESC") {
+				o.desc = true
+			} else {
+				p.Keyword("ASC")
+			}
+			stmt.orderBy = append(stmt.orderBy, o)
+			if !p.Symbol(",") {
+				break
+			}
+		}
+	}
+
+	if p.Keyword("LIMIT") {
+		if stmt.limit, err = parseCount(p); err != nil {
+			return nil, err
+		}
+		if p.Keyword("OFFSET") {
+			if stmt.offset, err = parseCount(p); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return stmt, p.End()
+}
+
+func expectSymbols(p *sqlscan.Parser, symbols ...string) error {
+	for _, s := range symbols {
+		if err := p.ExpectSymbol(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseLiteral parses a number, optionally negated, a string, TRUE or
+// FALSE.
+func parseLiteral(p *sqlscan.Parser) (sqlscan.Token, error) {
+	neg := p.Symbol("-")
+	t := p.Peek()
+	switch {
+	case t.Kind == sqlscan.Number:
+		if neg {
+			t.Text = "-" + t.Text
+		}
+	case !neg && (t.Kind == sqlscan.String || t.Is("TRUE") || t.Is("FALSE")):
+	default:
+		return t, p.Errorf("expect a literal")
+	}
+	p.Next()
+	return t, nil
+}
+
+func parseCount(p *sqlscan.Parser) (int, error) {
+	t := p.Peek()
+	n, err := strconv.Atoi(t.Text)
+	if t.Kind != sqlscan.Number || err != nil || n < 0 {
+		return 0, p.Errorf("expect a row count")
+	}
+	p.Next()
+	return n, nil
+}
+
+// execSelect runs stmt on t and returns its result as a record.
+func execSelect(t *table, stmt *selectStmt) (arrow.Record, error) {
+	rows := make([][]any, 0, len(t.rows))
+	var where []int
+	for _, cond := range stmt.where {
+		col := t.column(cond.column)
+		if col < 0 {
+			return nil, fmt.Errorf("column %q not found", cond.column)
+		}
+		where = append(where, col)
+	}
+	for _, row := range t.rows {
+		match := true
+		for i, cond := range stmt.where {
+			ok, err := cond.eval(row[where[i]], t.expr.ColumnDefs[where[i]].Datatype)
+			if err != nil {
+				return nil, err
+			}
+			match = match && ok
+		}
+		if match {
+			rows = append(rows, row)
+		}
+	}
+
+	if stmt.count {
+		b := array.NewInt64Builder(memory.DefaultAllocator)
+		defer b.Release()
+		b.Append(int64(len(rows)))
+		column := b.NewArray()
+		defer column.Release()
+		schema := arrow.NewSchema([]arrow.Field{{Name: "COUNT(*)", Type: arrow.PrimitiveTypes.Int64}}, nil)
+		return array.NewRecord(schema, []arrow.Array{column}, 1), nil
+	}
+
+	var orderBy []int
+	for _, o := range stmt.orderBy {
+		col := t.column(o.column)
+		if col < 0 {
+			return nil, fmt.Errorf("column %q not found", o.column)
+		}
+		orderBy = append(orderBy, col)
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		for k, col := range orderBy {
+			if c := compareValues(rows[i][col], rows[j][col]); c != 0 {
+				return c < 0 != stmt.orderBy[k].desc
+			}
+		}
+		return false
+	})
+	if stmt.offset < len(rows) {
+		rows = rows[stmt.offset:]
+	} else {
+		rows = nil
+	}
+	if stmt.limit >= 0 && stmt.limit < len(rows) {
+		rows = rows[:stmt.limit]
+	}
+
+	items := stmt.items
+	if items == nil {
+		for _, def := range t.expr.ColumnDefs {
+			items = append(items, selectItem{column: def.Name, alias: def.Name})
+		}
+	}
+	fields := make([]arrow.Field, len(items))
+	cols := make([]int, len(items))
+	for i, item := range items {
+		cols[i] = t.column(item.column)
+		if cols[i] < 0 {
+			return nil, fmt.Errorf("column %q not found", item.column)
+		}
+		def := t.expr.ColumnDefs[cols[i]]
+		fields[i] = arrow.Field{Name: item.alias, Type: arrowType(def.Datatype), Nullable: def.IsNullable}
+	}
+	b := array.NewRecordBuilder(memory.DefaultAllocator, arrow.NewSchema(fields, nil))
+	defer b.Release()
+	for _, row := range rows {
+		for i, col := range cols {
+			appendValue(b.Field(i), row[col])
+		}
+	}
+	return b.NewRecord(), nil
+}
+
+func (c *condition) eval(v any, datatype greptimev1.ColumnDataType) (bool, error) {
+	switch c.op {
+	case "IS NULL":
+		return v == nil, nil
+	case "IS NOT NULL":
+		return v != nil, nil
+	}
+	if v == nil {
+		return false, nil
+	}
+	cmp, err := compareLiteral(v, datatype, c.lit)
+	if err != nil {
+		return false, fmt.Errorf("column %q: %w", c.column, err)
+	}
+	switch c.op {
+	case "=":
+		return cmp == 0, nil
+	case "!=", "<>":
+		return cmp != 0, nil
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	default:
+		return cmp >= 0, nil
+	}
+}
+
+// timeLayouts are the layouts of the string literals compared with
+// timestamps and dates.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+}
+
+// unitOf returns the unit of the integers that hold datatype.
+func unitOf(datatype greptimev1.ColumnDataType) time.Duration {
+	switch datatype {
+	case greptimev1.ColumnDataType_DATE:
+		return 24 * time.Hour
+	case greptimev1.ColumnDataType_TIMESTAMP_SECOND, greptimev1.ColumnDataType_TIME_SECOND:
+		return time.Second
+	case greptimev1.ColumnDataType_DATETIME, greptimev1.ColumnDataType_TIMESTAMP_MILLISECOND, greptimev1.ColumnDataType_TIME_MILLISECOND:
+		return time.Millisecond
+	case greptimev1.ColumnDataType_TIMESTAMP_MICROSECOND, greptimev1.ColumnDataType_TIME_MICROSECOND:
+		return time.Microsecond
+	}
+	return time.Nanosecond
+}
+
+func ticks(t time.Time, unit time.Duration) int64 {
+	switch unit {
+	case 24 * time.Hour:
+		days := t.Unix() / 86400
+		if t.Unix()%86400 < 0 {
+			days--
+		}
+		return days
+	case time.Second:
+		return t.Unix()
+	case time.Millisecond:
+		return t.UnixMilli()
+	case time.Microsecond:
+		return t.UnixMicro()
+	}
+	return t.UnixNano()
+}
+
+func compareLiteral(v any, datatype greptimev1.ColumnDataType, lit sqlscan.Token) (int, error) {
+	mismatch := fmt.Errorf("cannot compare %s with %s", datatype, lit)
+	switch v := v.(type) {
+	case time.Time:
+		switch lit.Kind {
+		case sqlscan.String:
+			for _, layout := range timeLayouts {
+				if t, err := time.ParseInLocation(layout, lit.Text, time.UTC); err == nil {
+					return compareValues(v, t), nil
+				}
+			}
+		case sqlscan.Number:
+			n, err := strconv.ParseInt(lit.Text, 10, 64)
+			if err == nil {
+				return compareValues(ticks(v, unitOf(datatype)), n), nil
+			}
+		}
+		return 0, mismatch
+	case time.Duration:
+		n, err := strconv.ParseInt(lit.Text, 10, 64)
+		if lit.Kind != sqlscan.Number || err != nil {
+			return 0, mismatch
+		}
+		return compareValues(int64(v/unitOf(datatype)), n), nil
+	case bool:
+		if !lit.Is("TRUE") && !lit.Is("FALSE") {
+			return 0, mismatch
+		}
+		return compareValues(v, lit.Is("TRUE")), nil
+	case string:
+		if lit.Kind != sqlscan.String {
+			return 0, mismatch
+		}
+		return strings.Compare(v, lit.Text), nil
+	case []byte:
+		if lit.Kind != sqlscan.String {
+			return 0, mismatch
+		}
+		return bytes.Compare(v, []byte(lit.Text)), nil
+	}
+
+	if lit.Kind != sqlscan.Number {
+		return 0, mismatch
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n, err := strconv.ParseInt(lit.Text, 10, 64); err == nil {
+			return compareValues(rv.Int(), n), nil
+		}
+		f, _ := strconv.ParseFloat(lit.Text, 64)
+		return compareValues(float64(rv.Int()), f), nil
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if n, err := strconv.ParseUint(lit.Text, 10, 64); err == nil {
+			return compareValues(rv.Uint(), n), nil
+		}
+		f, _ := strconv.ParseFloat(lit.Text, 64)
+		return compareValues(float64(rv.Uint()), f), nil
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(lit.Text, 64)
+		if err != nil {
+			return 0, mismatch
+		}
+		return compareValues(rv.Float(), f), nil
+	}
+	return 0, mismatch
+}
+
+// compareValues compares two values of the same Go type, nulls sorting
+// after any value.
+func compareValues(a, b any) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+	switch a := a.(type) {
+	case time.Time:
+		switch b := b.(time.Time); {
+		case a.Before(b):
+			return -1
+		case a.After(b):
+			return 1
+		}
+		return 0
+	case bool:
+		switch b := b.(bool); {
+		case a == b:
+			return 0
+		case b:
+			return -1
+		}
+		return 1
+	case string:
+		return strings.Compare(a, b.(string))
+	case []byte:
+		return bytes.Compare(a, b.([]byte))
+	}
+	av, bv := reflect.ValueOf(a), reflect.ValueOf(b)
+	switch av.Kind() {
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return compareOrdered(av.Int(), bv.Int())
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return compareOrdered(av.Uint(), bv.Uint())
+	}
+	return compareOrdered(av.Float(), bv.Float())
+}
+
+func compareOrdered[T int64 | uint64 | float64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// arrowType returns the Arrow type GreptimeDB returns datatype columns as.
+func arrowType(datatype greptimev1.ColumnDataType) arrow.DataType {
+	switch datatype {
+	case greptimev1.ColumnDataType_BOOLEAN:
+		return arrow.FixedWidthTypes.Boolean
+	case greptimev1.ColumnDataType_INT8:
+		return arrow.PrimitiveTypes.Int8
+	case greptimev1.ColumnDataType_INT16:
+		return arrow.PrimitiveTypes.Int16
+	case greptimev1.ColumnDataType_INT32:
+		return arrow.PrimitiveTypes.Int32
+	case greptimev1.ColumnDataType_INT64:
+		return arrow.PrimitiveTypes.Int64
+	case greptimev1.ColumnDataType_UINT8:
+		return arrow.PrimitiveTypes.Uint8
+	case greptimev1.ColumnDataType_UINT16:
+		return arrow.PrimitiveTypes.Uint16
+	case greptimev1.ColumnDataType_UINT32:
+		return arrow.PrimitiveTypes.Uint32
+	case greptimev1.ColumnDataType_UINT64:
+		return arrow.PrimitiveTypes.Uint64
+	case greptimev1.ColumnDataType_FLOAT32:
+		return arrow.PrimitiveTypes.Float32
+	case greptimev1.ColumnDataType_FLOAT64:
+		return arrow.PrimitiveTypes.Float64
+	case greptimev1.ColumnDataType_BINARY:
+		return arrow.BinaryTypes.Binary
+	case greptimev1.ColumnDataType_STRING:
+		return arrow.BinaryTypes.String
+	case greptimev1.ColumnDataType_DATE:
+		return arrow.PrimitiveTypes.Date32
+	case greptimev1.ColumnDataType_DATETIME:
+		return arrow.PrimitiveTypes.Date64
+	case greptimev1.ColumnDataType_TIMESTAMP_SECOND:
+		return &arrow.TimestampType{Unit: arrow.Second}
+	case greptimev1.ColumnDataType_TIMESTAMP_MILLISECOND:
+		return &arrow.TimestampType{Unit: arrow.Millisecond}
+	case greptimev1.ColumnDataType_TIMESTAMP_MICROSECOND:
+		return &arrow.TimestampType{Unit: arrow.Microsecond}
+	case greptimev1.ColumnDataType_TIMESTAMP_NANOSECOND:
+		return &arrow.TimestampType{Unit: arrow.Nanosecond}
+	case greptimev1.ColumnDataType_TIME_SECOND:
+		return arrow.FixedWidthTypes.Time32s
+	case greptimev1.ColumnDataType_TIME_MILLISECOND:
+		return arrow.FixedWidthTypes.Time32ms
+	case greptimev1.ColumnDataType_TIME_MICROSECOND:
+		return arrow.FixedWidthTypes.Time64us
+	}
+	return arrow.FixedWidthTypes.Time64ns
+}
+
+// appendValue appends a value decoded from a Column to the builder of its
+// Arrow type.
+func appendValue(b array.Builder, v any) {
+	if v == nil {
+		b.AppendNull()
+		return
+	}
+	switch b := b.(type) {
+	case *array.BooleanBuilder:
+		b.Append(v.(bool))
+	case *array.Int8Builder:
+		b.Append(v.(int8))
+	case *array.Int16Builder:
+		b.Append(v.(int16))
+	case *array.Int32Builder:
+		b.Append(v.(int32))
+	case *array.Int64Builder:
+		b.Append(v.(int64))
+	case *array.Uint8Builder:
+		b.Append(v.(uint8))
+	case *array.Uint16Builder:
+		b.Append(v.(uint16))
+	case *array.Uint32Builder:
+		b.Append(v.(uint32))
+	case *array.Uint64Builder:
+		b.Append(v.(uint64))
+	case *array.Float32Builder:
+		b.Append(v.(float32))
+	case *array.Float64Builder:
+		b.Append(v.(float64))
+	case *array.StringBuilder:
+		b.Append(v.(string))
+	case *array.BinaryBuilder:
+		b.Append(v.([]byte))
+	case *array.Date32Builder:
+		b.Append(arrow.Date32FromTime(v.(time.Time)))
+	case *array.Date64Builder:
+		// Date64FromTime truncates to the day, dropping the time of
+		// DATETIME values.
+		b.Append(arrow.Date64(v.(time.Time).UnixMilli()))
+	case *array.TimestampBuilder:
+		unit := b.Type().(*arrow.TimestampType).Unit.Multiplier()
+		b.Append(arrow.Timestamp(ticks(v.(time.Time), unit)))
+	case *array.Time32Builder:
+		unit := b.Type().(*arrow.Time32Type).Unit.Multiplier()
+		b.Append(arrow.Time32(v.(time.Duration) / unit))
+	case *array.Time64Builder:
+		unit := b.Type().(*arrow.Time64Type).Unit.Multiplier()
+		b.Append(arrow.Time64(v.(time.Duration) / unit))
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package greptimetest
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	greptimev1 "github.com/GreptimeTeam/greptime-proto/go/greptime/v1"
+	"github.com/GreptimeTeam/greptime-proto/go/greptime/v1/client"
+)
+
+func TestIsSelect(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want bool
+	}{
+		{"SELECT 1", true},
+		{"  select * from t", true},
+		{"INSERT INTO t VALUES (1)", false},
+		{"'SELECT'", false},
+		{"SELECT 'unterminated", false},
+	}
+	for _, tt := range tests {
+		if got := isSelect(tt.sql); got != tt.want {
+			t.Errorf("isSelect(%q) = %v, want %v", tt.sql, got, tt.want)
+		}
+	}
+}
+
+func TestParseSelectErrors(t *testing.T) {
+	for _, sql := range []string{
+		"SELECT",
+		"SELECT * FROM",
+		"SELECT * cpu",
+		"SELECT host, FROM cpu",
+		"SELECT host AS FROM cpu",
+		"SELECT COUNT(host) FROM cpu",
+		"SELECT * FROM a.b.c.d",
+		"SELECT * FROM cpu WHERE",
+		"SELECT * FROM cpu WHERE usage ~ 1",
+		"SELECT * FROM cpu WHERE usage = host",
+		"SELECT * FROM cpu WHERE host = -'a'",
+		"SELECT * FROM cpu WHERE usage IS 1",
+		"SELECT * FROM cpu ORDER usage",
+		"SELECT * FROM cpu LIMIT -1",
+		"SELECT * FROM cpu LIMIT n",
+		"SELECT * FROM cpu LIMIT 1 OFFSET",
+		"SELECT * FROM cpu extra",
+	} {
+		if stmt, err := parseSelect(sql); err == nil {
+			t.Errorf("parseSelect(%q) = %+v, want an error", sql, stmt)
+		}
+	}
+}
+
+// selectRows runs sql on the table of s it names and decodes the record.
+func selectRows(s *store, sql string) ([][]any, error) {
+	stmt, err := parseSelect(sql)
+	if err != nil {
+		return nil, err
+	}
+	tbl, err := s.table(catalog, schema, stmt.table[len(stmt.table)-1])
+	if err != nil {
+		return nil, err
+	}
+	rec, err := execSelect(tbl, stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rec.Release()
+	return client.RecordRows(rec)
+}
+
+func TestExecSelect(t *testing.T) {
+	s := newCPUStore(t)
+	if _, err := s.insert(catalog, schema, cpuInsert(t,
+		[]any{"a", 1, 0.5}, []any{"b", 2, nil}, []any{"a", 3, 1.5}, []any{"c", 4, 2.5})); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		sql  string
+		want [][]any
+	}{
+		{"SELECT * FROM cpu", [][]any{
+			{"a", ms(1), 0.5, "us"},
+			{"b", ms(2), nil, "us"},
+			{"a", ms(3), 1.5, "us"},
+			{"c", ms(4), 2.5, "us"},
+		}},
+		{"SELECT host, usage AS u FROM public.cpu WHERE usage > 1 ORDER BY usage DESC", [][]any{{"c", 2.5}, {"a", 1.5}}},
+		{"SELECT host FROM cpu WHERE usage IS NULL", [][]any{{"b"}}},
+		{"SELECT host FROM cpu WHERE usage IS NOT NULL AND host <> 'a'", [][]any{{"c"}}},
+		{"SELECT ts FROM cpu WHERE host = 'a' AND ts >= 2", [][]any{{ms(3)}}},
+		{"SELECT host FROM cpu WHERE ts < '1970-01-01 00:00:00.003'", [][]any{{"a"}, {"b"}}},
+		{"SELECT host FROM cpu WHERE ts = '1970-01-01T00:00:00.004Z'", [][]any{{"c"}}},
+		{"SELECT host FROM cpu WHERE usage <= -1", [][]any{}},
+		{"SELECT host, ts FROM cpu ORDER BY host, ts DESC", [][]any{{"a", ms(3)}, {"a", ms(1)}, {"b", ms(2)}, {"c", ms(4)}}},
+		// Nulls sort last.
+		{"SELECT usage FROM cpu ORDER BY usage ASC", [][]any{{0.5}, {1.5}, {2.5}, {nil}}},
+		{"SELECT host FROM cpu LIMIT 2 OFFSET 1", [][]any{{"b"}, {"a"}}},
+		{"SELECT host FROM cpu LIMIT 0", [][]any{}},
+		{"SELECT host FROM cpu LIMIT 1 OFFSET 4", [][]any{}},
+		{"SELECT COUNT(*) FROM cpu WHERE host != 'a'", [][]any{{int64(2)}}},
+	}
+	for _, tt := range tests {
+		got, err := selectRows(s, tt.sql)
+		if err != nil {
+			t.Errorf("%s: %v", tt.sql, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s = %v, want %v", tt.sql, got, tt.want)
+		}
+	}
+}
+
+func TestExecSelectErrors(t *testing.T) {
+	s := newCPUStore(t)
+	if _, err := s.insert(catalog, schema, cpuInsert(t, []any{"a", 1, 0.5})); err != nil {
+		t.Fatal(err)
+	}
+	for _, sql := range []string{
+		"SELECT idc FROM cpu",
+		"SELECT * FROM cpu WHERE idc = 1",
+		"SELECT * FROM cpu ORDER BY idc",
+		"SELECT * FROM cpu WHERE host = 1",
+		"SELECT * FROM cpu WHERE usage = 'high'",
+		"SELECT * FROM cpu WHERE ts = TRUE",
+		"SELECT * FROM cpu WHERE ts > 'yesterday'",
+	} {
+		if rows, err := selectRows(s, sql); err == nil {
+			t.Errorf("%s = %v, want an error", sql, rows)
+		}
+	}
+}
+
+// TestSelectTypes checks the values of every datatype are returned as
+// client.RecordRows decodes them, the types of Column.Decode.
+func TestSelectTypes(t *testing.T) {
+	values := []struct {
+		datatype greptimev1.ColumnDataType
+		v        any
+	}{
+		{greptimev1.ColumnDataType_BOOLEAN, true},
+		{greptimev1.ColumnDataType_INT8, int8(-8)},
+		{greptimev1.ColumnDataType_INT16, int16(-16)},
+		{greptimev1.ColumnDataType_INT32, int32(-32)},
+		{greptimev1.ColumnDataType_INT64, int64(-64)},
+		{greptimev1.ColumnDataType_UINT8, uint8(8)},
+		{greptimev1.ColumnDataType_UINT16, uint16(16)},
+		{greptimev1.ColumnDataType_UINT32, uint32(32)},
+		{greptimev1.ColumnDataType_UINT64, uint64(64)},
+		{greptimev1.ColumnDataType_FLOAT32, float32(0.5)},
+		{greptimev1.ColumnDataType_FLOAT64, 1.5},
+		{greptimev1.ColumnDataType_BINARY, []byte{0, 255}},
+		{greptimev1.ColumnDataType_STRING, "s"},
+		{greptimev1.ColumnDataType_DATE, time.Date(2023, 5, 6, 0, 0, 0, 0, time.UTC)},
+		// DATETIME values keep their time of day.
+		{greptimev1.ColumnDataType_DATETIME, time.Date(2023, 5, 6, 7, 8, 9, 10e6, time.UTC)},
+		{greptimev1.ColumnDataType_TIMESTAMP_SECOND, time.Unix(-1, 0).UTC()},
+		{greptimev1.ColumnDataType_TIMESTAMP_MILLISECOND, ms(1500)},
+		{greptimev1.ColumnDataType_TIMESTAMP_MICROSECOND, time.UnixMicro(1500).UTC()},
+		{greptimev1.ColumnDataType_TIMESTAMP_NANOSECOND, time.Unix(0, 1500).UTC()},
+		{greptimev1.ColumnDataType_TIME_SECOND, time.Hour},
+		{greptimev1.ColumnDataType_TIME_MILLISECOND, time.Second},
+		{greptimev1.ColumnDataType_TIME_MICROSECOND, time.Millisecond},
+		{greptimev1.ColumnDataType_TIME_NANOSECOND, time.Microsecond},
+	}
+	b := greptimev1.NewTable("types").Timestamp("ts", greptimev1.ColumnDataType_TIMESTAMP_MILLISECOND)
+	row := []any{ms(1)}
+	nulls := []any{ms(2)}
+	for _, v := range values {
+		b.Field(v.datatype.String(), v.datatype)
+		row = append(row, v.v)
+		nulls = append(nulls, nil)
+	}
+	expr, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newStore()
+	if err := s.createTable(catalog, schema, expr); err != nil {
+		t.Fatal(err)
+	}
+	tbl, err := s.table(catalog, schema, "types")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tbl.rows = [][]any{row, nulls}
+
+	got, err := selectRows(s, "SELECT * FROM types")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("SELECT * = %d rows, want 2", len(got))
+	}
+	for i, want := range tbl.rows {
+		for j := range want {
+			if !reflect.DeepEqual(got[i][j], want[j]) {
+				t.Errorf("row %d column %s = %#v, want %#v", i, expr.ColumnDefs[j].Name, got[i][j], want[j])
+			}
+		}
+	}
+}
@@ -0,0 +1,253 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package greptimetest provides an in-memory GreptimeDB server for tests.
+//
+// The server keeps tables in memory and serves them over an in-process
+// gRPC connection. It applies inserts, deletes and DDL requests, and
+// answers SELECT statements of a small SQL subset over Arrow Flight:
+//
+//	srv := greptimetest.NewServer()
+//	defer srv.Close()
+//	conn, err := srv.Dial(ctx)
+//	...
+//	c := client.NewFromConn(conn)
+//
+// Like GreptimeDB, it replaces rows having the same primary key and time
+// index, and applies the defaults of the columns missing from inserts and
+// of the columns added to tables, now() and current_timestamp() being the
+// only default functions. Unlike it, tables must be created before being
+// written to. Every alteration bumps the version of a table, starting at
+// 0, and alterations having a non-zero table_version fail unless it is the
+// current one.
+package greptimetest
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+
+	greptimev1 "github.com/GreptimeTeam/greptime-proto/go/greptime/v1"
+	"github.com/apache/arrow/go/v11/arrow"
+	"github.com/apache/arrow/go/v11/arrow/flight"
+	"github.com/apache/arrow/go/v11/arrow/ipc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+// Server is an in-memory GreptimeDatabase server. It is safe for
+// concurrent use.
+type Server struct {
+	greptimev1.UnimplementedGreptimeDatabaseServer
+
+	lis  *bufconn.Listener
+	grpc *grpc.Server
+
+	mu    sync.Mutex
+	store *store
+}
+
+// NewServer starts a server with an empty "greptime.public" database.
+func NewServer() *Server {
+	s := &Server{
+		lis:   bufconn.Listen(1 << 20),
+		grpc:  grpc.NewServer(),
+		store: newStore(),
+	}
+	greptimev1.RegisterGreptimeDatabaseServer(s.grpc, s)
+	flight.RegisterFlightServiceServer(s.grpc, &flightServer{server: s})
+	go s.grpc.Serve(s.lis)
+	return s
+}
+
+// Dial returns a connection to the server.
+func (s *Server) Dial(ctx context.Context, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	opts = append([]grpc.DialOption{
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return s.lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}, opts...)
+	return grpc.DialContext(ctx, "bufnet", opts...)
+}
+
+// Close stops the server, closing its connections.
+func (s *Server) Close() {
+	s.grpc.Stop()
+}
+
+// Table returns the definition of a table, nil if it doesn't exist.
+func (s *Server) Table(catalog, schema, name string) *greptimev1.CreateTableExpr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.store.table(catalog, schema, name)
+	if err != nil {
+		return nil
+	}
+	return proto.Clone(t.expr).(*greptimev1.CreateTableExpr)
+}
+
+// Rows returns the rows of a table as column name to value, in write
+// order. Values have the Go types of Column.Decode, nil for nulls.
+func (s *Server) Rows(catalog, schema, name string) ([]map[string]any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.store.table(catalog, schema, name)
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]map[string]any, len(t.rows))
+	for i, row := range t.rows {
+		rows[i] = make(map[string]any, len(row))
+		for j, def := range t.expr.ColumnDefs {
+			rows[i][def.Name] = row[j]
+		}
+	}
+	return rows, nil
+}
+
+// handle applies a request that doesn't return records.
+func (s *Server) handle(req *greptimev1.GreptimeRequest) (uint32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	catalog, schema := req.GetHeader().Database()
+	switch r := req.GetRequest().(type) {
+	case *greptimev1.GreptimeRequest_Inserts:
+		var affected uint32
+		for _, insert := range r.Inserts.GetInserts() {
+			n, err := s.store.insert(catalog, schema, insert)
+			if err != nil {
+				return affected, err
+			}
+			affected += n
+		}
+		return affected, nil
+	case *greptimev1.GreptimeRequest_Delete:
+		return s.store.delete(catalog, schema, r.Delete)
+	case *greptimev1.GreptimeRequest_Ddl:
+		return s.store.ddl(catalog, schema, r.Ddl)
+	case *greptimev1.GreptimeRequest_Query:
+		if isSelect(r.Query.GetSql()) {
+			return 0, status.Error(codes.InvalidArgument, "SELECT results are only returned over Arrow Flight DoGet")
+		}
+		return 0, status.Error(codes.Unimplemented, "only SELECT queries are supported")
+	}
+	return 0, status.Errorf(codes.InvalidArgument, "unsupported request %T", req.GetRequest())
+}
+
+func affectedRows(n uint32) *greptimev1.GreptimeResponse {
+	return &greptimev1.GreptimeResponse{
+		Response: &greptimev1.GreptimeResponse_AffectedRows{AffectedRows: &greptimev1.AffectedRows{Value: n}},
+	}
+}
+
+// Handle implements GreptimeDatabaseServer.
+func (s *Server) Handle(ctx context.Context, req *greptimev1.GreptimeRequest) (*greptimev1.GreptimeResponse, error) {
+	n, err := s.handle(req)
+	if err != nil {
+		return nil, err
+	}
+	return affectedRows(n), nil
+}
+
+// HandleRequests implements GreptimeDatabaseServer, applying the requests
+// as they arrive and returning the sum of the affected rows.
+func (s *Server) HandleRequests(stream greptimev1.GreptimeDatabase_HandleRequestsServer) error {
+	var affected uint32
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(affectedRows(affected))
+		}
+		if err != nil {
+			return err
+		}
+		n, err := s.handle(req)
+		if err != nil {
+			return err
+		}
+		affected += n
+	}
+}
+
+// flightServer answers GreptimeRequests sent as the tickets of DoGet
+// calls, like the GreptimeDB frontend.
+type flightServer struct {
+	flight.BaseFlightServer
+	server *Server
+}
+
+func (f *flightServer) DoGet(ticket *flight.Ticket, stream flight.FlightService_DoGetServer) error {
+	var req greptimev1.GreptimeRequest
+	if err := proto.Unmarshal(ticket.GetTicket(), &req); err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid ticket: %v", err)
+	}
+
+	sql := req.GetQuery().GetSql()
+	if !isSelect(sql) {
+		n, err := f.server.handle(&req)
+		if err != nil {
+			return err
+		}
+		metadata, err := proto.Marshal(&greptimev1.FlightMetadata{AffectedRows: &greptimev1.AffectedRows{Value: n}})
+		if err != nil {
+			return err
+		}
+		return stream.Send(&flight.FlightData{AppMetadata: metadata})
+	}
+
+	stmt, err := parseSelect(sql)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	rec, err := f.server.query(req.GetHeader(), stmt)
+	if err != nil {
+		return err
+	}
+	defer rec.Release()
+	w := flight.NewRecordWriter(stream, ipc.WithSchema(rec.Schema()))
+	if err := w.Write(rec); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// query runs a SELECT statement on the table it names, in the database of
+// the header unless qualified.
+func (s *Server) query(header *greptimev1.RequestHeader, stmt *selectStmt) (arrow.Record, error) {
+	catalog, schema := header.Database()
+	switch len(stmt.table) {
+	case 2:
+		schema = stmt.table[0]
+	case 3:
+		catalog, schema = stmt.table[0], stmt.table[1]
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.store.table(catalog, schema, stmt.table[len(stmt.table)-1])
+	if err != nil {
+		return nil, err
+	}
+	rec, err := execSelect(t, stmt)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return rec, nil
+}
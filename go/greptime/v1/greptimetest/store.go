@@ -0,0 +1,447 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package greptimetest
+
+import (
+	"fmt"
+	"time"
+
+	greptimev1 "github.com/GreptimeTeam/greptime-proto/go/greptime/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+type schemaKey struct {
+	catalog, schema string
+}
+
+// table is a table of the store: its definition and rows, each row holding
+// one value per column definition, nil for nulls.
+type table struct {
+	expr *greptimev1.CreateTableExpr
+	rows [][]any
+	// keys maps the primary key and time index of a row to its index, to
+	// replace rows written twice.
+	keys map[string]int
+	// version is bumped by every alteration of the table.
+	version uint64
+}
+
+func (t *table) column(name string) int {
+	for i, def := range t.expr.ColumnDefs {
+		if def.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// keyColumns returns the indexes of the primary key columns and of the
+// time index.
+func (t *table) keyColumns() []int {
+	var cols []int
+	for _, name := range t.expr.PrimaryKeys {
+		cols = append(cols, t.column(name))
+	}
+	return append(cols, t.column(t.expr.TimeIndex))
+}
+
+func rowKey(values []any) string {
+	return fmt.Sprintf("%#v", values)
+}
+
+func (t *table) key(row []any) string {
+	cols := t.keyColumns()
+	values := make([]any, len(cols))
+	for i, col := range cols {
+		values[i] = row[col]
+	}
+	return rowKey(values)
+}
+
+func (t *table) reindex() {
+	t.keys = make(map[string]int, len(t.rows))
+	for i, row := range t.rows {
+		t.keys[t.key(row)] = i
+	}
+}
+
+// store holds the databases and tables of a server. It is not safe for
+// concurrent use.
+type store struct {
+	schemas map[schemaKey]map[string]*table
+}
+
+func newStore() *store {
+	return &store{schemas: map[schemaKey]map[string]*table{
+		{greptimev1.DefaultCatalog, greptimev1.DefaultSchema}: {},
+	}}
+}
+
+func (s *store) tables(catalog, schema string) (map[string]*table, error) {
+	tables, ok := s.schemas[schemaKey{catalog, schema}]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "database %s.%s not found", catalog, schema)
+	}
+	return tables, nil
+}
+
+func (s *store) table(catalog, schema, name string) (*table, error) {
+	tables, err := s.tables(catalog, schema)
+	if err != nil {
+		return nil, err
+	}
+	t, ok := tables[name]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "table %s.%s.%s not found", catalog, schema, name)
+	}
+	return t, nil
+}
+
+// qualify returns the catalog and schema of a DDL expression, those of the
+// request when it names none.
+func qualify(catalog, schema, exprCatalog, exprSchema string) (string, string) {
+	if exprCatalog != "" {
+		catalog = exprCatalog
+	}
+	if exprSchema != "" {
+		schema = exprSchema
+	}
+	return catalog, schema
+}
+
+// defaultValue returns the value of a column that isn't written, computed
+// at now for the now() and current_timestamp() functions, nil if the
+// column has no default.
+func defaultValue(def *greptimev1.ColumnDef, now time.Time) (any, error) {
+	constraint, err := def.Default()
+	if err != nil || constraint == nil {
+		return nil, err
+	}
+	if constraint.Function == "" {
+		return constraint.Value, nil
+	}
+	if constraint.Function != greptimev1.DefaultNow && constraint.Function != greptimev1.DefaultCurrentTimestamp {
+		return nil, fmt.Errorf("column %q: unsupported default function %s", def.Name, constraint.Function)
+	}
+	switch def.Datatype {
+	case greptimev1.ColumnDataType_DATE:
+		return now.UTC().Truncate(24 * time.Hour), nil
+	case greptimev1.ColumnDataType_DATETIME, greptimev1.ColumnDataType_TIMESTAMP_MILLISECOND:
+		return now.UTC().Truncate(time.Millisecond), nil
+	case greptimev1.ColumnDataType_TIMESTAMP_SECOND:
+		return now.UTC().Truncate(time.Second), nil
+	case greptimev1.ColumnDataType_TIMESTAMP_MICROSECOND:
+		return now.UTC().Truncate(time.Microsecond), nil
+	case greptimev1.ColumnDataType_TIMESTAMP_NANOSECOND:
+		return now.UTC(), nil
+	}
+	return nil, fmt.Errorf("column %q: default %s of a %s column", def.Name, constraint.Function, def.Datatype)
+}
+
+func (s *store) insert(catalog, schema string, req *greptimev1.InsertRequest) (uint32, error) {
+	t, err := s.table(catalog, schema, req.GetTableName())
+	if err != nil {
+		return 0, err
+	}
+	if err := req.Validate(); err != nil {
+		return 0, status.Error(codes.InvalidArgument, err.Error())
+	}
+	cols := make([]int, len(req.GetColumns()))
+	for i, column := range req.GetColumns() {
+		cols[i] = t.column(column.GetColumnName())
+		if cols[i] < 0 {
+			return 0, status.Errorf(codes.InvalidArgument, "column %q not found in table %q", column.GetColumnName(), req.GetTableName())
+		}
+		if def := t.expr.ColumnDefs[cols[i]]; def.Datatype != column.GetDatatype() {
+			return 0, status.Errorf(codes.InvalidArgument, "column %q of table %q is %s, got %s values",
+				def.Name, req.GetTableName(), def.Datatype, column.GetDatatype())
+		}
+	}
+
+	defaults := make([]any, len(t.expr.ColumnDefs))
+	written := make([]bool, len(t.expr.ColumnDefs))
+	for _, col := range cols {
+		written[col] = true
+	}
+	now := time.Now()
+	for i, def := range t.expr.ColumnDefs {
+		if !written[i] {
+			if defaults[i], err = defaultValue(def, now); err != nil {
+				return 0, status.Error(codes.InvalidArgument, err.Error())
+			}
+		}
+	}
+
+	it, err := req.Rows()
+	if err != nil {
+		return 0, status.Error(codes.InvalidArgument, err.Error())
+	}
+	var rows [][]any
+	for it.Next() {
+		row := make([]any, len(t.expr.ColumnDefs))
+		copy(row, defaults)
+		for i, v := range it.Values() {
+			row[cols[i]] = v
+		}
+		for i, def := range t.expr.ColumnDefs {
+			if row[i] == nil && (!def.IsNullable || def.Name == t.expr.TimeIndex) {
+				return 0, status.Errorf(codes.InvalidArgument, "column %q of table %q is not nullable", def.Name, req.GetTableName())
+			}
+		}
+		rows = append(rows, row)
+	}
+	for _, row := range rows {
+		key := t.key(row)
+		if i, ok := t.keys[key]; ok {
+			t.rows[i] = row
+			continue
+		}
+		t.keys[key] = len(t.rows)
+		t.rows = append(t.rows, row)
+	}
+	return req.GetRowCount(), nil
+}
+
+func (s *store) delete(catalog, schema string, req *greptimev1.DeleteRequest) (uint32, error) {
+	t, err := s.table(catalog, schema, req.GetTableName())
+	if err != nil {
+		return 0, err
+	}
+	if err := req.Validate(); err != nil {
+		return 0, status.Error(codes.InvalidArgument, err.Error())
+	}
+	keyCols := t.keyColumns()
+	cols := make([]int, len(keyCols))
+	for i, col := range keyCols {
+		cols[i] = -1
+		for j, column := range req.GetKeyColumns() {
+			if column.GetColumnName() == t.expr.ColumnDefs[col].Name {
+				cols[i] = j
+			}
+		}
+		if cols[i] < 0 {
+			return 0, status.Errorf(codes.InvalidArgument, "missing key column %q of table %q", t.expr.ColumnDefs[col].Name, req.GetTableName())
+		}
+	}
+
+	it, err := req.Rows()
+	if err != nil {
+		return 0, status.Error(codes.InvalidArgument, err.Error())
+	}
+	deleted := make(map[int]bool)
+	for it.Next() {
+		values := make([]any, len(cols))
+		for i, j := range cols {
+			values[i] = it.Values()[j]
+		}
+		if i, ok := t.keys[rowKey(values)]; ok {
+			deleted[i] = true
+		}
+	}
+	if len(deleted) > 0 {
+		rows := t.rows[:0]
+		for i, row := range t.rows {
+			if !deleted[i] {
+				rows = append(rows, row)
+			}
+		}
+		t.rows = rows
+		t.reindex()
+	}
+	return uint32(len(deleted)), nil
+}
+
+func (s *store) ddl(catalog, schema string, req *greptimev1.DdlRequest) (uint32, error) {
+	switch expr := req.GetExpr().(type) {
+	case *greptimev1.DdlRequest_CreateDatabase:
+		return s.createDatabase(catalog, expr.CreateDatabase)
+	case *greptimev1.DdlRequest_CreateTable:
+		return 0, s.createTable(catalog, schema, expr.CreateTable)
+	case *greptimev1.DdlRequest_Alter:
+		return 0, s.alter(catalog, schema, expr.Alter)
+	case *greptimev1.DdlRequest_DropTable:
+		e := expr.DropTable
+		catalog, schema := qualify(catalog, schema, e.CatalogName, e.SchemaName)
+		if _, err := s.table(catalog, schema, e.TableName); err != nil {
+			return 0, err
+		}
+		delete(s.schemas[schemaKey{catalog, schema}], e.TableName)
+		return 1, nil
+	case *greptimev1.DdlRequest_FlushTable:
+		e := expr.FlushTable
+		catalog, schema := qualify(catalog, schema, e.CatalogName, e.SchemaName)
+		_, err := s.table(catalog, schema, e.TableName)
+		return 0, err
+	case *greptimev1.DdlRequest_CompactTable:
+		e := expr.CompactTable
+		catalog, schema := qualify(catalog, schema, e.CatalogName, e.SchemaName)
+		_, err := s.table(catalog, schema, e.TableName)
+		return 0, err
+	}
+	return 0, status.Errorf(codes.InvalidArgument, "unsupported DDL request %T", req.GetExpr())
+}
+
+func (s *store) createDatabase(catalog string, expr *greptimev1.CreateDatabaseExpr) (uint32, error) {
+	key := schemaKey{catalog, expr.DatabaseName}
+	if _, ok := s.schemas[key]; ok {
+		if expr.CreateIfNotExists {
+			return 1, nil
+		}
+		return 0, status.Errorf(codes.AlreadyExists, "database %s.%s already exists", catalog, expr.DatabaseName)
+	}
+	s.schemas[key] = make(map[string]*table)
+	return 1, nil
+}
+
+func (s *store) createTable(catalog, schema string, expr *greptimev1.CreateTableExpr) error {
+	catalog, schema = qualify(catalog, schema, expr.CatalogName, expr.SchemaName)
+	tables, err := s.tables(catalog, schema)
+	if err != nil {
+		return err
+	}
+	if _, ok := tables[expr.TableName]; ok {
+		if expr.CreateIfNotExists {
+			return nil
+		}
+		return status.Errorf(codes.AlreadyExists, "table %s.%s.%s already exists", catalog, schema, expr.TableName)
+	}
+
+	t := &table{expr: proto.Clone(expr).(*greptimev1.CreateTableExpr), keys: make(map[string]int)}
+	t.expr.CatalogName, t.expr.SchemaName = catalog, schema
+	seen := make(map[string]bool)
+	for _, def := range t.expr.ColumnDefs {
+		if def.Name == "" || seen[def.Name] {
+			return status.Errorf(codes.InvalidArgument, "invalid or duplicate column name %q", def.Name)
+		}
+		seen[def.Name] = true
+	}
+	ts := t.column(t.expr.TimeIndex)
+	if ts < 0 || !t.expr.ColumnDefs[ts].Datatype.IsTimestamp() {
+		return status.Errorf(codes.InvalidArgument, "time index %q is not a timestamp column", t.expr.TimeIndex)
+	}
+	for _, name := range t.expr.PrimaryKeys {
+		if !seen[name] || name == t.expr.TimeIndex {
+			return status.Errorf(codes.InvalidArgument, "invalid primary key column %q", name)
+		}
+	}
+	tables[expr.TableName] = t
+	return nil
+}
+
+func (s *store) alter(catalog, schema string, expr *greptimev1.AlterExpr) error {
+	catalog, schema = qualify(catalog, schema, expr.CatalogName, expr.SchemaName)
+	t, err := s.table(catalog, schema, expr.TableName)
+	if err != nil {
+		return err
+	}
+	if expr.TableVersion != 0 && expr.TableVersion != t.version {
+		return status.Errorf(codes.FailedPrecondition, "table %s.%s.%s is at version %d, not %d",
+			catalog, schema, expr.TableName, t.version, expr.TableVersion)
+	}
+
+	switch kind := expr.GetKind().(type) {
+	case *greptimev1.AlterExpr_AddColumns:
+		adds := kind.AddColumns.GetAddColumns()
+		next := proto.Clone(t.expr).(*greptimev1.CreateTableExpr)
+		var positions []int
+		var values []any
+		now := time.Now()
+		for _, add := range adds {
+			def := add.GetColumnDef()
+			if def.GetName() == "" || (&table{expr: next}).column(def.GetName()) >= 0 {
+				return status.Errorf(codes.AlreadyExists, "invalid or existing column %q", def.GetName())
+			}
+			if !def.GetIsNullable() && len(def.GetDefaultConstraint()) == 0 {
+				return status.Errorf(codes.InvalidArgument, "column %q must be nullable or have a default value", def.GetName())
+			}
+			value, err := defaultValue(def, now)
+			if err != nil {
+				return status.Error(codes.InvalidArgument, err.Error())
+			}
+			values = append(values, value)
+			pos := len(next.ColumnDefs)
+			if loc := add.GetLocation(); loc != nil {
+				switch loc.GetLocationType() {
+				case greptimev1.AddColumn_Location_FIRST:
+					pos = 0
+				case greptimev1.AddColumn_Location_AFTER:
+					after := (&table{expr: next}).column(loc.GetAfterCloumnName())
+					if after < 0 {
+						return status.Errorf(codes.InvalidArgument, "column %q not found", loc.GetAfterCloumnName())
+					}
+					pos = after + 1
+				}
+			}
+			next.ColumnDefs = append(next.ColumnDefs, nil)
+			copy(next.ColumnDefs[pos+1:], next.ColumnDefs[pos:])
+			next.ColumnDefs[pos] = proto.Clone(def).(*greptimev1.ColumnDef)
+			if add.GetIsKey() {
+				next.PrimaryKeys = append(next.PrimaryKeys, def.GetName())
+			}
+			positions = append(positions, pos)
+		}
+		for j, pos := range positions {
+			for i, row := range t.rows {
+				row = append(row, nil)
+				copy(row[pos+1:], row[pos:])
+				row[pos] = values[j]
+				t.rows[i] = row
+			}
+		}
+		t.expr = next
+		t.reindex()
+	case *greptimev1.AlterExpr_DropColumns:
+		for _, drop := range kind.DropColumns.GetDropColumns() {
+			name := drop.GetName()
+			col := t.column(name)
+			if col < 0 {
+				return status.Errorf(codes.NotFound, "column %q not found", name)
+			}
+			if name == t.expr.TimeIndex {
+				return status.Errorf(codes.InvalidArgument, "cannot drop time index column %q", name)
+			}
+			for _, key := range t.expr.PrimaryKeys {
+				if key == name {
+					return status.Errorf(codes.InvalidArgument, "cannot drop primary key column %q", name)
+				}
+			}
+		}
+		for _, drop := range kind.DropColumns.GetDropColumns() {
+			col := t.column(drop.GetName())
+			if col < 0 {
+				continue
+			}
+			t.expr.ColumnDefs = append(t.expr.ColumnDefs[:col], t.expr.ColumnDefs[col+1:]...)
+			for i, row := range t.rows {
+				t.rows[i] = append(row[:col], row[col+1:]...)
+			}
+		}
+	case *greptimev1.AlterExpr_RenameTable:
+		name := kind.RenameTable.GetNewTableName()
+		tables := s.schemas[schemaKey{catalog, schema}]
+		if _, ok := tables[name]; ok {
+			return status.Errorf(codes.AlreadyExists, "table %s.%s.%s already exists", catalog, schema, name)
+		}
+		delete(tables, expr.TableName)
+		t.expr.TableName = name
+		tables[name] = t
+	default:
+		return status.Errorf(codes.InvalidArgument, "unsupported alter kind %T", expr.GetKind())
+	}
+	t.version++
+	return nil
+}
@@ -0,0 +1,321 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package greptimetest
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	greptimev1 "github.com/GreptimeTeam/greptime-proto/go/greptime/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	catalog = greptimev1.DefaultCatalog
+	schema  = greptimev1.DefaultSchema
+)
+
+// cpuTable returns the definition of the table "cpu" of a tag "host", a
+// time index "ts", a field "usage" and a "region" defaulting to "us".
+func cpuTable(t *testing.T) *greptimev1.CreateTableExpr {
+	t.Helper()
+	region, err := greptimev1.DefaultValue(greptimev1.ColumnDataType_STRING, "us")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expr, err := greptimev1.NewTable("cpu").
+		Tag("host", greptimev1.ColumnDataType_STRING).
+		Timestamp("ts", greptimev1.ColumnDataType_TIMESTAMP_MILLISECOND).
+		Field("usage", greptimev1.ColumnDataType_FLOAT64).
+		Column(&greptimev1.ColumnDef{Name: "region", Datatype: greptimev1.ColumnDataType_STRING, DefaultConstraint: region}).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return expr
+}
+
+// newCPUStore returns a store holding cpuTable in greptime.public.
+func newCPUStore(t *testing.T) *store {
+	t.Helper()
+	s := newStore()
+	if err := s.createTable(catalog, schema, cpuTable(t)); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// cpuInsert returns an insert into "cpu" of rows of host, ts in
+// milliseconds and usage, a nil usage being a null.
+func cpuInsert(t *testing.T, rows ...[]any) *greptimev1.InsertRequest {
+	t.Helper()
+	b := greptimev1.NewInsertBuilder("cpu").
+		Tag("host", greptimev1.ColumnDataType_STRING).
+		Timestamp("ts", greptimev1.ColumnDataType_TIMESTAMP_MILLISECOND).
+		Field("usage", greptimev1.ColumnDataType_FLOAT64)
+	for _, row := range rows {
+		if err := b.AddRow(map[string]any{"host": row[0], "ts": time.UnixMilli(int64(row[1].(int))), "usage": row[2]}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func ms(n int64) time.Time {
+	return time.UnixMilli(n).UTC()
+}
+
+func tableRows(t *testing.T, s *store, name string) [][]any {
+	t.Helper()
+	tbl, err := s.table(catalog, schema, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tbl.rows
+}
+
+func TestStoreInsert(t *testing.T) {
+	s := newCPUStore(t)
+	n, err := s.insert(catalog, schema, cpuInsert(t, []any{"a", 1, 0.5}, []any{"b", 1, nil}))
+	if err != nil || n != 2 {
+		t.Fatalf("insert() = %d, %v, want 2", n, err)
+	}
+	// A row of the same host and ts replaces the first.
+	n, err = s.insert(catalog, schema, cpuInsert(t, []any{"a", 1, 1.5}, []any{"a", 2, 2.5}))
+	if err != nil || n != 2 {
+		t.Fatalf("insert() = %d, %v, want 2", n, err)
+	}
+	want := [][]any{
+		{"a", ms(1), 1.5, "us"},
+		{"b", ms(1), nil, "us"},
+		{"a", ms(2), 2.5, "us"},
+	}
+	if got := tableRows(t, s, "cpu"); !reflect.DeepEqual(got, want) {
+		t.Errorf("rows = %v, want %v", got, want)
+	}
+}
+
+func TestStoreInsertErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		req    func(req *greptimev1.InsertRequest)
+		code   codes.Code
+	}{
+		{"unknown database", "nope", func(*greptimev1.InsertRequest) {}, codes.NotFound},
+		{"unknown table", schema, func(req *greptimev1.InsertRequest) { req.TableName = "mem" }, codes.NotFound},
+		{"invalid request", schema, func(req *greptimev1.InsertRequest) { req.RowCount = 2 }, codes.InvalidArgument},
+		{"unknown column", schema, func(req *greptimev1.InsertRequest) { req.Columns[0].ColumnName = "idc" }, codes.InvalidArgument},
+		{"datatype", schema, func(req *greptimev1.InsertRequest) {
+			req.Columns[2].Datatype = greptimev1.ColumnDataType_FLOAT32
+			req.Columns[2].Values = &greptimev1.Column_Values{F32Values: []float32{1}}
+		}, codes.InvalidArgument},
+		{"null time index", schema, func(req *greptimev1.InsertRequest) { req.Columns = req.Columns[:1] }, codes.InvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newCPUStore(t)
+			req := cpuInsert(t, []any{"a", 1, 0.5})
+			tt.req(req)
+			if _, err := s.insert(catalog, tt.schema, req); status.Code(err) != tt.code {
+				t.Errorf("insert() = %v, want %v", err, tt.code)
+			}
+			if rows := tableRows(t, s, "cpu"); len(rows) != 0 {
+				t.Errorf("rows after a failed insert = %v", rows)
+			}
+		})
+	}
+}
+
+func TestStoreDelete(t *testing.T) {
+	s := newCPUStore(t)
+	if _, err := s.insert(catalog, schema, cpuInsert(t, []any{"a", 1, 0.5}, []any{"b", 1, 1.5}, []any{"a", 2, 2.5})); err != nil {
+		t.Fatal(err)
+	}
+	keys := cpuInsert(t, []any{"a", 1, nil}, []any{"c", 1, nil})
+	del := &greptimev1.DeleteRequest{TableName: "cpu", KeyColumns: keys.Columns[:2], RowCount: keys.RowCount}
+	if n, err := s.delete(catalog, schema, del); err != nil || n != 1 {
+		t.Fatalf("delete() = %d, %v, want 1", n, err)
+	}
+	want := [][]any{{"b", ms(1), 1.5, "us"}, {"a", ms(2), 2.5, "us"}}
+	if got := tableRows(t, s, "cpu"); !reflect.DeepEqual(got, want) {
+		t.Errorf("rows = %v, want %v", got, want)
+	}
+	// Rows are still found by key once others are deleted.
+	if _, err := s.insert(catalog, schema, cpuInsert(t, []any{"a", 2, 3.5})); err != nil {
+		t.Fatal(err)
+	}
+	want[1][2] = 3.5
+	if got := tableRows(t, s, "cpu"); !reflect.DeepEqual(got, want) {
+		t.Errorf("rows = %v, want %v", got, want)
+	}
+
+	del.KeyColumns = keys.Columns[1:2]
+	if _, err := s.delete(catalog, schema, del); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("delete() without the host key = %v, want InvalidArgument", err)
+	}
+}
+
+func createTable(expr *greptimev1.CreateTableExpr) *greptimev1.DdlRequest {
+	return &greptimev1.DdlRequest{Expr: &greptimev1.DdlRequest_CreateTable{CreateTable: expr}}
+}
+
+func alter(version uint64, kind any) *greptimev1.DdlRequest {
+	expr := &greptimev1.AlterExpr{TableName: "cpu", TableVersion: version}
+	switch kind := kind.(type) {
+	case *greptimev1.AddColumn:
+		expr.Kind = &greptimev1.AlterExpr_AddColumns{AddColumns: &greptimev1.AddColumns{AddColumns: []*greptimev1.AddColumn{kind}}}
+	case *greptimev1.DropColumn:
+		expr.Kind = &greptimev1.AlterExpr_DropColumns{DropColumns: &greptimev1.DropColumns{DropColumns: []*greptimev1.DropColumn{kind}}}
+	case *greptimev1.RenameTable:
+		expr.Kind = &greptimev1.AlterExpr_RenameTable{RenameTable: kind}
+	}
+	return &greptimev1.DdlRequest{Expr: &greptimev1.DdlRequest_Alter{Alter: expr}}
+}
+
+func nullable(name string) *greptimev1.AddColumn {
+	return &greptimev1.AddColumn{ColumnDef: &greptimev1.ColumnDef{Name: name, Datatype: greptimev1.ColumnDataType_INT64, IsNullable: true}}
+}
+
+// TestStoreDDL applies DDL requests in turn to a store holding cpuTable.
+func TestStoreDDL(t *testing.T) {
+	tableExpr := cpuTable(t)
+	withTable := func(f func(expr *greptimev1.CreateTableExpr)) *greptimev1.DdlRequest {
+		expr := cpuTable(t)
+		f(expr)
+		return createTable(expr)
+	}
+	tests := []struct {
+		name     string
+		req      *greptimev1.DdlRequest
+		affected uint32
+		code     codes.Code
+	}{
+		{"create database", &greptimev1.DdlRequest{Expr: &greptimev1.DdlRequest_CreateDatabase{
+			CreateDatabase: &greptimev1.CreateDatabaseExpr{DatabaseName: "db"}}}, 1, codes.OK},
+		{"create existing database", &greptimev1.DdlRequest{Expr: &greptimev1.DdlRequest_CreateDatabase{
+			CreateDatabase: &greptimev1.CreateDatabaseExpr{DatabaseName: "db"}}}, 0, codes.AlreadyExists},
+		{"create database if not exists", &greptimev1.DdlRequest{Expr: &greptimev1.DdlRequest_CreateDatabase{
+			CreateDatabase: &greptimev1.CreateDatabaseExpr{DatabaseName: "db", CreateIfNotExists: true}}}, 1, codes.OK},
+		{"create table in database", withTable(func(expr *greptimev1.CreateTableExpr) { expr.SchemaName = "db" }), 0, codes.OK},
+		{"create table in unknown database", withTable(func(expr *greptimev1.CreateTableExpr) { expr.SchemaName = "nope" }), 0, codes.NotFound},
+		{"create existing table", createTable(tableExpr), 0, codes.AlreadyExists},
+		{"create table if not exists", withTable(func(expr *greptimev1.CreateTableExpr) { expr.CreateIfNotExists = true }), 0, codes.OK},
+		{"duplicate column", withTable(func(expr *greptimev1.CreateTableExpr) {
+			expr.TableName = "t"
+			expr.ColumnDefs = append(expr.ColumnDefs, expr.ColumnDefs[0])
+		}), 0, codes.InvalidArgument},
+		{"time index not a timestamp", withTable(func(expr *greptimev1.CreateTableExpr) {
+			expr.TableName = "t"
+			expr.TimeIndex = "usage"
+		}), 0, codes.InvalidArgument},
+		{"time index as primary key", withTable(func(expr *greptimev1.CreateTableExpr) {
+			expr.TableName = "t"
+			expr.PrimaryKeys = []string{"ts"}
+		}), 0, codes.InvalidArgument},
+
+		{"add column", alter(0, nullable("idc")), 0, codes.OK},
+		{"add existing column", alter(0, nullable("usage")), 0, codes.AlreadyExists},
+		{"add non-null column without default", alter(0, &greptimev1.AddColumn{
+			ColumnDef: &greptimev1.ColumnDef{Name: "n", Datatype: greptimev1.ColumnDataType_INT64}}), 0, codes.InvalidArgument},
+		{"add column after unknown column", alter(0, &greptimev1.AddColumn{
+			ColumnDef: nullable("n").ColumnDef,
+			Location:  &greptimev1.AddColumn_Location{LocationType: greptimev1.AddColumn_Location_AFTER, AfterCloumnName: "nope"}}), 0, codes.InvalidArgument},
+		{"alter at stale version", alter(5, nullable("n")), 0, codes.FailedPrecondition},
+		{"alter at version", alter(1, nullable("n")), 0, codes.OK},
+		{"drop time index", alter(0, &greptimev1.DropColumn{Name: "ts"}), 0, codes.InvalidArgument},
+		{"drop primary key", alter(0, &greptimev1.DropColumn{Name: "host"}), 0, codes.InvalidArgument},
+		{"drop unknown column", alter(0, &greptimev1.DropColumn{Name: "nope"}), 0, codes.NotFound},
+		{"drop column", alter(0, &greptimev1.DropColumn{Name: "idc"}), 0, codes.OK},
+		{"rename table", alter(0, &greptimev1.RenameTable{NewTableName: "cpu2"}), 0, codes.OK},
+		{"alter renamed table", alter(0, nullable("m")), 0, codes.NotFound},
+		{"flush table", &greptimev1.DdlRequest{Expr: &greptimev1.DdlRequest_FlushTable{
+			FlushTable: &greptimev1.FlushTableExpr{TableName: "cpu2"}}}, 0, codes.OK},
+		{"compact unknown table", &greptimev1.DdlRequest{Expr: &greptimev1.DdlRequest_CompactTable{
+			CompactTable: &greptimev1.CompactTableExpr{TableName: "cpu"}}}, 0, codes.NotFound},
+		{"drop table", &greptimev1.DdlRequest{Expr: &greptimev1.DdlRequest_DropTable{
+			DropTable: &greptimev1.DropTableExpr{TableName: "cpu2"}}}, 1, codes.OK},
+		{"drop qualified table", &greptimev1.DdlRequest{Expr: &greptimev1.DdlRequest_DropTable{
+			DropTable: &greptimev1.DropTableExpr{SchemaName: "db", TableName: "cpu"}}}, 1, codes.OK},
+		{"drop unknown table", &greptimev1.DdlRequest{Expr: &greptimev1.DdlRequest_DropTable{
+			DropTable: &greptimev1.DropTableExpr{TableName: "cpu2"}}}, 0, codes.NotFound},
+		{"unsupported", &greptimev1.DdlRequest{}, 0, codes.InvalidArgument},
+	}
+	s := newCPUStore(t)
+	for _, tt := range tests {
+		n, err := s.ddl(catalog, schema, tt.req)
+		if status.Code(err) != tt.code || n != tt.affected {
+			t.Errorf("%s: ddl() = %d, %v, want %d, %v", tt.name, n, err, tt.affected, tt.code)
+		}
+	}
+	if tables, _ := s.tables(catalog, schema); len(tables) != 0 {
+		t.Errorf("tables left = %v", tables)
+	}
+}
+
+func TestStoreAlterRows(t *testing.T) {
+	s := newCPUStore(t)
+	if _, err := s.insert(catalog, schema, cpuInsert(t, []any{"a", 1, 0.5})); err != nil {
+		t.Fatal(err)
+	}
+	idc, err := greptimev1.DefaultValue(greptimev1.ColumnDataType_STRING, "east")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, req := range []*greptimev1.DdlRequest{
+		alter(0, &greptimev1.AddColumn{
+			ColumnDef: &greptimev1.ColumnDef{Name: "idc", Datatype: greptimev1.ColumnDataType_STRING, DefaultConstraint: idc},
+			IsKey:     true,
+			Location:  &greptimev1.AddColumn_Location{LocationType: greptimev1.AddColumn_Location_FIRST},
+		}),
+		alter(0, &greptimev1.AddColumn{
+			ColumnDef: nullable("n").ColumnDef,
+			Location:  &greptimev1.AddColumn_Location{LocationType: greptimev1.AddColumn_Location_AFTER, AfterCloumnName: "ts"},
+		}),
+		alter(0, &greptimev1.DropColumn{Name: "usage"}),
+	} {
+		if _, err := s.ddl(catalog, schema, req); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tbl, err := s.table(catalog, schema, "cpu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, def := range tbl.expr.ColumnDefs {
+		names = append(names, def.Name)
+	}
+	if want := []string{"idc", "host", "ts", "n", "region"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("columns = %v, want %v", names, want)
+	}
+	if want := []string{"host", "idc"}; !reflect.DeepEqual(tbl.expr.PrimaryKeys, want) {
+		t.Errorf("primary keys = %v, want %v", tbl.expr.PrimaryKeys, want)
+	}
+	if tbl.version != 3 {
+		t.Errorf("version = %d, want 3", tbl.version)
+	}
+	want := [][]any{{"east", "a", ms(1), nil, "us"}}
+	if !reflect.DeepEqual(tbl.rows, want) {
+		t.Errorf("rows = %v, want %v", tbl.rows, want)
+	}
+}
@@ -0,0 +1,342 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// InsertBuilder assembles an InsertRequest row by row. It keeps the values,
+// the null masks and the row count of all columns consistent, so callers
+// never touch Column.Values or Column.NullMask directly.
+//
+// Columns can be declared up front with Tag, Field and Timestamp. Columns
+// that are not declared are created from the first row carrying them: the
+// datatype is inferred from the Go value and the semantic type is FIELD,
+// except for the first time.Time column which becomes the TIMESTAMP column.
+// Rows that lack a column, or carry a nil value for it, are null in that
+// column.
+//
+// An InsertBuilder is not safe for concurrent use.
+type InsertBuilder struct {
+	table  string
+	region uint32
+
+	decls     []columnDecl
+	columns   []*columnBuilder
+	index     map[string]*columnBuilder
+	timestamp *columnBuilder
+	rows      int
+
+	staged     []stagedCell
+	structType reflect.Type
+	err        error
+}
+
+type columnDecl struct {
+	name     string
+	semantic Column_SemanticType
+	datatype ColumnDataType
+}
+
+type columnBuilder struct {
+	column *Column
+	typed  bool
+	nulls  Bitmap
+	// row is the last row (1-based) this column received a value for.
+	row int
+}
+
+type stagedCell struct {
+	col      *columnBuilder
+	name     string
+	null     bool
+	inferred bool
+	datatype ColumnDataType
+	cell     cell
+}
+
+// NewInsertBuilder returns a builder for rows of the given table.
+func NewInsertBuilder(table string) *InsertBuilder {
+	return &InsertBuilder{
+		table: table,
+		index: make(map[string]*columnBuilder),
+	}
+}
+
+// RegionNumber sets the region number of the built request.
+func (b *InsertBuilder) RegionNumber(region uint32) *InsertBuilder {
+	b.region = region
+	return b
+}
+
+// Tag declares a TAG column.
+func (b *InsertBuilder) Tag(name string, datatype ColumnDataType) *InsertBuilder {
+	return b.declare(columnDecl{name, Column_TAG, datatype})
+}
+
+// Field declares a FIELD column.
+func (b *InsertBuilder) Field(name string, datatype ColumnDataType) *InsertBuilder {
+	return b.declare(columnDecl{name, Column_FIELD, datatype})
+}
+
+// Timestamp declares the TIMESTAMP column, datatype must be one of the
+// TIMESTAMP_* types.
+func (b *InsertBuilder) Timestamp(name string, datatype ColumnDataType) *InsertBuilder {
+	return b.declare(columnDecl{name, Column_TIMESTAMP, datatype})
+}
+
+// declare records the declaration so that it survives Build. Errors are
+// kept and reported by the next AddRow or Build.
+func (b *InsertBuilder) declare(d columnDecl) *InsertBuilder {
+	if b.err != nil {
+		return b
+	}
+	if err := b.applyDecl(d); err != nil {
+		b.err = err
+		return b
+	}
+	for i := range b.decls {
+		if b.decls[i].name == d.name {
+			b.decls[i] = d
+			return b
+		}
+	}
+	b.decls = append(b.decls, d)
+	return b
+}
+
+func (b *InsertBuilder) applyDecl(d columnDecl) error {
+	if d.semantic == Column_TIMESTAMP && !d.datatype.IsTimestamp() {
+		return fmt.Errorf("column %q: timestamp column must have a timestamp datatype, got %s", d.name, d.datatype)
+	}
+	col := b.index[d.name]
+	if d.semantic == Column_TIMESTAMP && b.timestamp != nil && b.timestamp != col {
+		return fmt.Errorf("column %q: timestamp column is already %q", d.name, b.timestamp.column.ColumnName)
+	}
+	if col == nil {
+		col = b.addColumn(d.name, d.semantic, d.datatype, true)
+	} else {
+		if col.typed && col.column.Datatype != d.datatype {
+			return fmt.Errorf("column %q: already holds %s values, cannot declare it as %s", d.name, col.column.Datatype, d.datatype)
+		}
+		col.column.SemanticType = d.semantic
+		col.column.Datatype = d.datatype
+		col.typed = true
+	}
+	switch {
+	case d.semantic == Column_TIMESTAMP:
+		b.timestamp = col
+	case b.timestamp == col:
+		b.timestamp = nil
+	}
+	return nil
+}
+
+// addColumn appends a new column, null for all the rows added so far.
+func (b *InsertBuilder) addColumn(name string, semantic Column_SemanticType, datatype ColumnDataType, typed bool) *columnBuilder {
+	col := &columnBuilder{
+		column: &Column{
+			ColumnName:   name,
+			SemanticType: semantic,
+			Datatype:     datatype,
+			Values:       &Column_Values{},
+		},
+		typed: typed,
+	}
+	for row := 0; row < b.rows; row++ {
+		col.nulls.Append(true)
+	}
+	b.columns = append(b.columns, col)
+	b.index[name] = col
+	return col
+}
+
+// AddRow appends one row given as column name to value. Values may be nil
+// or pointers, nil values are stored as nulls. The row is either appended
+// as a whole or, if any value cannot be converted to its column's datatype,
+// not at all.
+func (b *InsertBuilder) AddRow(row map[string]any) error {
+	if b.err != nil {
+		return b.err
+	}
+	b.staged = b.staged[:0]
+	for name, v := range row {
+		if err := b.stage(name, v); err != nil {
+			return err
+		}
+	}
+	// Columns first seen in this row are created in name order.
+	sort.Slice(b.staged, func(i, j int) bool { return b.staged[i].name < b.staged[j].name })
+	b.commit()
+	return nil
+}
+
+// stage converts a value of the row being added. Every value of a row is
+// converted before any is committed, so that a bad value leaves the builder
+// untouched.
+func (b *InsertBuilder) stage(name string, raw any) error {
+	s := stagedCell{col: b.index[name], name: name}
+	v := indirect(raw)
+	switch {
+	case v == nil:
+		s.null = true
+	case s.col != nil && s.col.typed:
+		c, err := toCell(s.col.column.Datatype, v)
+		if err != nil {
+			return fmt.Errorf("column %q: %w", name, err)
+		}
+		s.cell = c
+	default:
+		datatype, ok := inferDatatype(v)
+		if !ok {
+			return fmt.Errorf("column %q: cannot infer datatype of %T", name, v)
+		}
+		c, err := toCell(datatype, v)
+		if err != nil {
+			return fmt.Errorf("column %q: %w", name, err)
+		}
+		s.inferred, s.datatype, s.cell = true, datatype, c
+	}
+	b.staged = append(b.staged, s)
+	return nil
+}
+
+// commit appends the staged values as a new row.
+func (b *InsertBuilder) commit() {
+	row1 := b.rows + 1
+	for _, s := range b.staged {
+		col := s.col
+		if col == nil {
+			semantic := Column_FIELD
+			if s.inferred && s.datatype.IsTimestamp() && b.timestamp == nil {
+				semantic = Column_TIMESTAMP
+			}
+			col = b.addColumn(s.name, semantic, s.datatype, s.inferred)
+			if semantic == Column_TIMESTAMP {
+				b.timestamp = col
+			}
+		} else if s.inferred {
+			col.column.Datatype, col.typed = s.datatype, true
+		}
+		col.row = row1
+		col.nulls.Append(s.null)
+		if !s.null {
+			appendCell(col.column.Values, col.column.Datatype, s.cell)
+		}
+	}
+	for _, col := range b.columns {
+		if col.row != row1 {
+			col.nulls.Append(true)
+		}
+	}
+	b.rows = row1
+}
+
+// AddStruct appends one row from a struct or a pointer to a struct mapped
+// by its `greptime` struct tags, see InsertRequestFromStructs. The columns
+// of the struct are declared the first time a struct type is added.
+func (b *InsertBuilder) AddStruct(v any) error {
+	if b.err != nil {
+		return b.err
+	}
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("AddStruct: expect a struct, got %T", v)
+	}
+	schema, err := b.declareStruct(rv.Type())
+	if err != nil {
+		return err
+	}
+	b.staged = b.staged[:0]
+	for _, f := range schema.fields {
+		var value any
+		if fv, err := rv.FieldByIndexErr(f.index); err == nil {
+			value = fv.Interface()
+		}
+		if err := b.stage(f.name, value); err != nil {
+			return err
+		}
+	}
+	b.commit()
+	return nil
+}
+
+// declareStruct declares the columns of a struct type, unless the builder
+// already did for that type.
+func (b *InsertBuilder) declareStruct(t reflect.Type) (*structSchema, error) {
+	schema, err := structSchemaOf(t)
+	if err != nil {
+		return nil, err
+	}
+	if b.structType == t {
+		return schema, nil
+	}
+	for _, f := range schema.fields {
+		b.declare(columnDecl{f.name, f.semantic, f.datatype})
+	}
+	if b.err != nil {
+		return nil, b.err
+	}
+	b.structType = t
+	return schema, nil
+}
+
+// Len returns the number of rows added since the last Build.
+func (b *InsertBuilder) Len() int {
+	return b.rows
+}
+
+// Build returns the InsertRequest holding all the rows added so far and
+// resets the builder, keeping the declared columns.
+func (b *InsertBuilder) Build() (*InsertRequest, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	req := &InsertRequest{
+		TableName:    b.table,
+		Columns:      make([]*Column, 0, len(b.columns)),
+		RowCount:     uint32(b.rows),
+		RegionNumber: b.region,
+	}
+	for _, col := range b.columns {
+		if !col.typed {
+			return nil, fmt.Errorf("column %q: cannot infer datatype from null values only", col.column.ColumnName)
+		}
+		if col.nulls.Count() > 0 {
+			col.column.NullMask = col.nulls.Bytes()
+		}
+		req.Columns = append(req.Columns, col.column)
+	}
+	b.reset()
+	return req, nil
+}
+
+func (b *InsertBuilder) reset() {
+	b.columns = nil
+	b.index = make(map[string]*columnBuilder)
+	b.timestamp = nil
+	b.rows = 0
+	for _, d := range b.decls {
+		// The declarations have been applied once, they can't fail on an
+		// empty builder.
+		_ = b.applyDecl(d)
+	}
+}
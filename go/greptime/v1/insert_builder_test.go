@@ -0,0 +1,227 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func TestInsertBuilder(t *testing.T) {
+	ts := time.UnixMilli(1686000000000)
+	tests := []struct {
+		name  string
+		build func(b *InsertBuilder)
+		rows  []map[string]any
+		want  *InsertRequest
+	}{
+		{
+			// The example of column.proto.
+			name: "null mask",
+			build: func(b *InsertBuilder) {
+				b.Tag("foo", ColumnDataType_INT32)
+			},
+			rows: []map[string]any{
+				{"foo": 1}, {"foo": 2}, {"foo": 3}, {"foo": 4}, {"foo": 5},
+				{"foo": nil}, {"foo": 7}, {"foo": 8}, {"foo": 9}, {},
+			},
+			want: &InsertRequest{
+				TableName: "t",
+				RowCount:  10,
+				Columns: []*Column{{
+					ColumnName:   "foo",
+					SemanticType: Column_TAG,
+					Datatype:     ColumnDataType_INT32,
+					Values:       &Column_Values{I32Values: []int32{1, 2, 3, 4, 5, 7, 8, 9}},
+					NullMask:     []byte{0b00100000, 0b00000010},
+				}},
+			},
+		},
+		{
+			name: "inferred columns",
+			rows: []map[string]any{
+				{"ts": ts, "host": "a", "cpu": 0.5},
+				{"ts": ts.Add(time.Second), "host": "b"},
+			},
+			want: &InsertRequest{
+				TableName: "t",
+				RowCount:  2,
+				Columns: []*Column{
+					{
+						ColumnName:   "cpu",
+						SemanticType: Column_FIELD,
+						Datatype:     ColumnDataType_FLOAT64,
+						Values:       &Column_Values{F64Values: []float64{0.5}},
+						NullMask:     []byte{0b10},
+					},
+					{
+						ColumnName:   "host",
+						SemanticType: Column_FIELD,
+						Datatype:     ColumnDataType_STRING,
+						Values:       &Column_Values{StringValues: []string{"a", "b"}},
+					},
+					{
+						ColumnName:   "ts",
+						SemanticType: Column_TIMESTAMP,
+						Datatype:     ColumnDataType_TIMESTAMP_MILLISECOND,
+						Values:       &Column_Values{TsMillisecondValues: []int64{1686000000000, 1686000001000}},
+					},
+				},
+			},
+		},
+		{
+			name: "late column",
+			build: func(b *InsertBuilder) {
+				b.Timestamp("ts", ColumnDataType_TIMESTAMP_SECOND).RegionNumber(3)
+			},
+			rows: []map[string]any{
+				{"ts": ts},
+				{"ts": ts},
+				{"ts": &ts, "n": int8(-1)},
+			},
+			want: &InsertRequest{
+				TableName:    "t",
+				RowCount:     3,
+				RegionNumber: 3,
+				Columns: []*Column{
+					{
+						ColumnName:   "ts",
+						SemanticType: Column_TIMESTAMP,
+						Datatype:     ColumnDataType_TIMESTAMP_SECOND,
+						Values:       &Column_Values{TsSecondValues: []int64{1686000000, 1686000000, 1686000000}},
+					},
+					{
+						ColumnName:   "n",
+						SemanticType: Column_FIELD,
+						Datatype:     ColumnDataType_INT8,
+						Values:       &Column_Values{I8Values: []int32{-1}},
+						NullMask:     []byte{0b011},
+					},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewInsertBuilder("t")
+			if tt.build != nil {
+				tt.build(b)
+			}
+			for _, row := range tt.rows {
+				if err := b.AddRow(row); err != nil {
+					t.Fatalf("AddRow(%v): %v", row, err)
+				}
+			}
+			got, err := b.Build()
+			if err != nil {
+				t.Fatalf("Build: %v", err)
+			}
+			if !proto.Equal(got, tt.want) {
+				t.Errorf("Build() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInsertBuilderBadRow(t *testing.T) {
+	b := NewInsertBuilder("t").Field("n", ColumnDataType_UINT8)
+	if err := b.AddRow(map[string]any{"n": 1, "m": "a"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range []map[string]any{
+		{"n": 256, "m": "b"},
+		{"n": "x"},
+		{"n": 2, "c": struct{}{}},
+	} {
+		if err := b.AddRow(row); err == nil {
+			t.Errorf("AddRow(%v) succeeded", row)
+		}
+	}
+	got, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &InsertRequest{
+		TableName: "t",
+		RowCount:  1,
+		Columns: []*Column{
+			{
+				ColumnName:   "n",
+				SemanticType: Column_FIELD,
+				Datatype:     ColumnDataType_UINT8,
+				Values:       &Column_Values{U8Values: []uint32{1}},
+			},
+			{
+				ColumnName:   "m",
+				SemanticType: Column_FIELD,
+				Datatype:     ColumnDataType_STRING,
+				Values:       &Column_Values{StringValues: []string{"a"}},
+			},
+		},
+	}
+	if !proto.Equal(got, want) {
+		t.Errorf("Build() = %v, want %v", got, want)
+	}
+}
+
+func TestInsertBuilderReset(t *testing.T) {
+	b := NewInsertBuilder("t").Tag("host", ColumnDataType_STRING)
+	if err := b.AddRow(map[string]any{"host": "a", "v": 1.0}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Build(); err != nil {
+		t.Fatal(err)
+	}
+	if b.Len() != 0 {
+		t.Fatalf("Len() = %d after Build, want 0", b.Len())
+	}
+	// The declared column survives Build, the inferred one doesn't.
+	if err := b.AddRow(map[string]any{"host": nil}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &InsertRequest{
+		TableName: "t",
+		RowCount:  1,
+		Columns: []*Column{{
+			ColumnName:   "host",
+			SemanticType: Column_TAG,
+			Datatype:     ColumnDataType_STRING,
+			Values:       &Column_Values{},
+			NullMask:     []byte{1},
+		}},
+	}
+	if !proto.Equal(got, want) {
+		t.Errorf("Build() = %v, want %v", got, want)
+	}
+}
+
+func TestInsertBuilderErrors(t *testing.T) {
+	if _, err := NewInsertBuilder("t").Timestamp("ts", ColumnDataType_INT64).Build(); err == nil {
+		t.Error("Build succeeded with a non-timestamp TIMESTAMP column")
+	}
+	b := NewInsertBuilder("t")
+	if err := b.AddRow(map[string]any{"v": nil}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Build(); err == nil {
+		t.Error("Build succeeded with a column of nulls only")
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"fmt"
+)
+
+// appendValues appends the values of src that hold datatype to dst.
+func appendValues(dst, src *Column_Values, datatype ColumnDataType) {
+	switch datatype {
+	case ColumnDataType_BOOLEAN:
+		dst.BoolValues = append(dst.BoolValues, src.GetBoolValues()...)
+	case ColumnDataType_INT8:
+		dst.I8Values = append(dst.I8Values, src.GetI8Values()...)
+	case ColumnDataType_INT16:
+		dst.I16Values = append(dst.I16Values, src.GetI16Values()...)
+	case ColumnDataType_INT32:
+		dst.I32Values = append(dst.I32Values, src.GetI32Values()...)
+	case ColumnDataType_INT64:
+		dst.I64Values = append(dst.I64Values, src.GetI64Values()...)
+	case ColumnDataType_UINT8:
+		dst.U8Values = append(dst.U8Values, src.GetU8Values()...)
+	case ColumnDataType_UINT16:
+		dst.U16Values = append(dst.U16Values, src.GetU16Values()...)
+	case ColumnDataType_UINT32:
+		dst.U32Values = append(dst.U32Values, src.GetU32Values()...)
+	case ColumnDataType_UINT64:
+		dst.U64Values = append(dst.U64Values, src.GetU64Values()...)
+	case ColumnDataType_FLOAT32:
+		dst.F32Values = append(dst.F32Values, src.GetF32Values()...)
+	case ColumnDataType_FLOAT64:
+		dst.F64Values = append(dst.F64Values, src.GetF64Values()...)
+	case ColumnDataType_BINARY:
+		dst.BinaryValues = append(dst.BinaryValues, src.GetBinaryValues()...)
+	case ColumnDataType_STRING:
+		dst.StringValues = append(dst.StringValues, src.GetStringValues()...)
+	case ColumnDataType_DATE:
+		dst.DateValues = append(dst.DateValues, src.GetDateValues()...)
+	case ColumnDataType_DATETIME:
+		dst.DatetimeValues = append(dst.DatetimeValues, src.GetDatetimeValues()...)
+	case ColumnDataType_TIMESTAMP_SECOND:
+		dst.TsSecondValues = append(dst.TsSecondValues, src.GetTsSecondValues()...)
+	case ColumnDataType_TIMESTAMP_MILLISECOND:
+		dst.TsMillisecondValues = append(dst.TsMillisecondValues, src.GetTsMillisecondValues()...)
+	case ColumnDataType_TIMESTAMP_MICROSECOND:
+		dst.TsMicrosecondValues = append(dst.TsMicrosecondValues, src.GetTsMicrosecondValues()...)
+	case ColumnDataType_TIMESTAMP_NANOSECOND:
+		dst.TsNanosecondValues = append(dst.TsNanosecondValues, src.GetTsNanosecondValues()...)
+	case ColumnDataType_TIME_SECOND:
+		dst.TimeSecondValues = append(dst.TimeSecondValues, src.GetTimeSecondValues()...)
+	case ColumnDataType_TIME_MILLISECOND:
+		dst.TimeMillisecondValues = append(dst.TimeMillisecondValues, src.GetTimeMillisecondValues()...)
+	case ColumnDataType_TIME_MICROSECOND:
+		dst.TimeMicrosecondValues = append(dst.TimeMicrosecondValues, src.GetTimeMicrosecondValues()...)
+	case ColumnDataType_TIME_NANOSECOND:
+		dst.TimeNanosecondValues = append(dst.TimeNanosecondValues, src.GetTimeNanosecondValues()...)
+	}
+}
+
+type mergedColumn struct {
+	column *Column
+	nulls  Bitmap
+}
+
+// MergeInsertRequests concatenates the rows of requests for the same table
+// and region into one request. The columns of the result are the union of
+// the columns of the requests in order of appearance; rows of a request
+// lacking a column are null in it. A column must have the same datatype and
+// semantic type in every request.
+//
+// The requests must be valid, see InsertRequest.Validate. They are not
+// modified and the result shares no storage with them except for binary
+// values.
+func MergeInsertRequests(reqs ...*InsertRequest) (*InsertRequest, error) {
+	if len(reqs) == 0 {
+		return nil, fmt.Errorf("no request to merge")
+	}
+	merged := &InsertRequest{
+		TableName:    reqs[0].GetTableName(),
+		RegionNumber: reqs[0].GetRegionNumber(),
+	}
+	var columns []*mergedColumn
+	index := make(map[string]*mergedColumn)
+	rows := 0
+	for _, req := range reqs {
+		if req.GetTableName() != merged.TableName || req.GetRegionNumber() != merged.RegionNumber {
+			return nil, fmt.Errorf("cannot merge rows of table %q region %d into table %q region %d",
+				req.GetTableName(), req.GetRegionNumber(), merged.TableName, merged.RegionNumber)
+		}
+		n := int(req.GetRowCount())
+		for _, src := range req.GetColumns() {
+			name := src.GetColumnName()
+			dst := index[name]
+			if dst == nil {
+				dst = &mergedColumn{column: &Column{
+					ColumnName:   name,
+					SemanticType: src.GetSemanticType(),
+					Datatype:     src.GetDatatype(),
+					Values:       &Column_Values{},
+				}}
+				for i := 0; i < rows; i++ {
+					dst.nulls.Append(true)
+				}
+				columns = append(columns, dst)
+				index[name] = dst
+			} else if dst.column.Datatype != src.GetDatatype() || dst.column.SemanticType != src.GetSemanticType() {
+				return nil, fmt.Errorf("column %q: cannot merge %s %s values into %s %s column", name,
+					src.GetSemanticType(), src.GetDatatype(), dst.column.SemanticType, dst.column.Datatype)
+			}
+			nulls, err := BitmapFromBytes(src.GetNullMask(), n)
+			if err != nil {
+				return nil, fmt.Errorf("column %q: null mask: %w", name, err)
+			}
+			for i := 0; i < n; i++ {
+				dst.nulls.Append(nulls.Test(i))
+			}
+			appendValues(dst.column.Values, src.GetValues(), src.GetDatatype())
+		}
+		rows += n
+		for _, dst := range columns {
+			for dst.nulls.Len() < rows {
+				dst.nulls.Append(true)
+			}
+		}
+	}
+	merged.RowCount = uint32(rows)
+	merged.Columns = make([]*Column, len(columns))
+	for i, c := range columns {
+		if c.nulls.Count() > 0 {
+			c.column.NullMask = c.nulls.Bytes()
+		}
+		merged.Columns[i] = c.column
+	}
+	return merged, nil
+}
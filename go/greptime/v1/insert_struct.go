@@ -0,0 +1,255 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// structSchema is the column layout of a struct type, derived once from its
+// `greptime` struct tags.
+type structSchema struct {
+	fields    []structField
+	timestamp int
+}
+
+type structField struct {
+	index    []int
+	name     string
+	semantic Column_SemanticType
+	datatype ColumnDataType
+}
+
+// structSchemas caches *structSchema by reflect.Type.
+var structSchemas sync.Map
+
+// structSchemaOf returns the cached schema of struct type t, see
+// InsertRequestFromStructs for the tag syntax.
+func structSchemaOf(t reflect.Type) (*structSchema, error) {
+	if s, ok := structSchemas.Load(t); ok {
+		return s.(*structSchema), nil
+	}
+	s := &structSchema{timestamp: -1}
+	implicit := -1
+	if err := s.collect(t, nil, &implicit); err != nil {
+		return nil, fmt.Errorf("%s: %w", t, err)
+	}
+	if s.timestamp < 0 && implicit >= 0 {
+		s.fields[implicit].semantic = Column_TIMESTAMP
+		s.timestamp = implicit
+	}
+	seen := make(map[string]bool, len(s.fields))
+	for _, f := range s.fields {
+		if seen[f.name] {
+			return nil, fmt.Errorf("%s: duplicate column %q", t, f.name)
+		}
+		seen[f.name] = true
+	}
+	actual, _ := structSchemas.LoadOrStore(t, s)
+	return actual.(*structSchema), nil
+}
+
+func (s *structSchema) collect(t reflect.Type, parent []int, implicit *int) error {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, hasTag := sf.Tag.Lookup("greptime")
+		if tag == "-" || !sf.IsExported() && !sf.Anonymous {
+			continue
+		}
+		index := append(append([]int(nil), parent...), i)
+		ft := sf.Type
+		for ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if sf.Anonymous && !hasTag && ft.Kind() == reflect.Struct && ft != timeType {
+			if err := s.collect(ft, index, implicit); err != nil {
+				return err
+			}
+			continue
+		}
+		if !sf.IsExported() {
+			continue
+		}
+
+		f := structField{index: index, semantic: Column_FIELD}
+		datatype, ok := datatypeOf(ft)
+		parts := strings.Split(tag, ",")
+		f.name = parts[0]
+		if f.name == "" {
+			f.name = snakeCase(sf.Name)
+		}
+		explicit := false
+		precision := ""
+		for _, opt := range parts[1:] {
+			key, value, _ := strings.Cut(strings.TrimSpace(opt), "=")
+			switch key {
+			case "tag":
+				f.semantic, explicit = Column_TAG, true
+			case "field":
+				f.semantic, explicit = Column_FIELD, true
+			case "timestamp":
+				f.semantic, explicit = Column_TIMESTAMP, true
+			case "precision":
+				precision = value
+			case "type":
+				v, known := ColumnDataType_value[strings.ToUpper(value)]
+				if !known {
+					return fmt.Errorf("field %s: unknown type %q", sf.Name, value)
+				}
+				datatype, ok = ColumnDataType(v), true
+			default:
+				return fmt.Errorf("field %s: unknown tag option %q", sf.Name, opt)
+			}
+		}
+		if !ok {
+			return fmt.Errorf("field %s: unsupported type %s", sf.Name, sf.Type)
+		}
+		if precision != "" {
+			if datatype, ok = timestampDatatype(precision); !ok {
+				return fmt.Errorf("field %s: unknown precision %q", sf.Name, precision)
+			}
+		}
+		f.datatype = datatype
+		if f.semantic == Column_TIMESTAMP {
+			if s.timestamp >= 0 {
+				return fmt.Errorf("field %s: timestamp column is already %q", sf.Name, s.fields[s.timestamp].name)
+			}
+			if !datatype.IsTimestamp() {
+				return fmt.Errorf("field %s: timestamp column must have a timestamp datatype, got %s", sf.Name, datatype)
+			}
+			s.timestamp = len(s.fields)
+		} else if !explicit && ft == timeType && *implicit < 0 {
+			*implicit = len(s.fields)
+		}
+		s.fields = append(s.fields, f)
+	}
+	return nil
+}
+
+// timestampDatatype maps a precision like "ms" to its TIMESTAMP_* type.
+func timestampDatatype(precision string) (ColumnDataType, bool) {
+	switch precision {
+	case "s":
+		return ColumnDataType_TIMESTAMP_SECOND, true
+	case "ms":
+		return ColumnDataType_TIMESTAMP_MILLISECOND, true
+	case "us":
+		return ColumnDataType_TIMESTAMP_MICROSECOND, true
+	case "ns":
+		return ColumnDataType_TIMESTAMP_NANOSECOND, true
+	}
+	return 0, false
+}
+
+// snakeCase converts a Go identifier like "CPUUsage" to "cpu_usage".
+func snakeCase(s string) string {
+	runes := []rune(s)
+	var sb strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(runes[i-1]) ||
+				(i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1]))) {
+				sb.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+func structTypeOf[T any]() (reflect.Type, error) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("expect a struct type, got %s", t)
+	}
+	return t, nil
+}
+
+// InsertRequestFromStructs maps rows of a struct type to an InsertRequest
+// of the given table, one column per mapped field.
+//
+// A field is mapped by its `greptime` struct tag:
+//
+//	Host  string    `greptime:"host,tag"`
+//	Usage float64   `greptime:"usage"`
+//	Load  *float32  `greptime:"load,field,type=float64"`
+//	TS    time.Time `greptime:"ts,timestamp,precision=ms"`
+//	Debug string    `greptime:"-"`
+//
+// The first element is the column name, the snake_case field name if
+// empty. Then "tag", "field" or "timestamp" set the semantic type, FIELD by
+// default; "precision" (s, ms, us or ns) sets the unit of a timestamp
+// column, and "type" overrides the datatype inferred from the Go type with
+// a ColumnDataType name. Untagged exported fields are FIELD columns, except
+// the first time.Time field, which becomes the TIMESTAMP column if no field
+// is tagged "timestamp". Fields of embedded structs are flattened, pointer
+// fields are nullable.
+//
+// The reflection metadata of T is computed once and cached, only reading
+// the field values is paid per row.
+func InsertRequestFromStructs[T any](table string, rows []T) (*InsertRequest, error) {
+	t, err := structTypeOf[T]()
+	if err != nil {
+		return nil, err
+	}
+	b := NewInsertBuilder(table)
+	if _, err := b.declareStruct(t); err != nil {
+		return nil, err
+	}
+	for i := range rows {
+		if err := b.AddStruct(&rows[i]); err != nil {
+			return nil, fmt.Errorf("row %d: %w", i, err)
+		}
+	}
+	return b.Build()
+}
+
+// CreateTableExprFromStruct returns the CreateTableExpr of a table holding
+// rows of struct type T, built with NewTable: one column per mapped field,
+// the TIMESTAMP field as the time index and the TAG fields as the primary
+// keys, in field order. All columns but the time index are nullable.
+func CreateTableExprFromStruct[T any](table string) (*CreateTableExpr, error) {
+	t, err := structTypeOf[T]()
+	if err != nil {
+		return nil, err
+	}
+	schema, err := structSchemaOf(t)
+	if err != nil {
+		return nil, err
+	}
+	if schema.timestamp < 0 {
+		return nil, fmt.Errorf("%s: no timestamp field for the time index", t)
+	}
+	b := NewTable(table)
+	for _, f := range schema.fields {
+		switch f.semantic {
+		case Column_TAG:
+			b.Tag(f.name, f.datatype)
+		case Column_TIMESTAMP:
+			b.Timestamp(f.name, f.datatype)
+		default:
+			b.Field(f.name, f.datatype)
+		}
+	}
+	return b.Build()
+}
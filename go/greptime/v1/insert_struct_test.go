@@ -0,0 +1,262 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func TestSnakeCase(t *testing.T) {
+	tests := []struct{ name, want string }{
+		{"Host", "host"},
+		{"host", "host"},
+		{"CPUUsage", "cpu_usage"},
+		{"UsageCPU", "usage_cpu"},
+		{"UserID", "user_id"},
+		{"HTTPServer", "http_server"},
+		{"TS", "ts"},
+		{"MemoryFree", "memory_free"},
+		{"A", "a"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := snakeCase(tt.name); got != tt.want {
+			t.Errorf("snakeCase(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+type structBase struct {
+	Region string `greptime:"region,tag"`
+}
+
+type StructLabels struct {
+	DC string `greptime:",tag"`
+}
+
+type structMetric struct {
+	structBase
+	*StructLabels
+	Host       string `greptime:"host,tag"`
+	CPUUsage   float64
+	Load       *float32  `greptime:"load,field,type=float64"`
+	Created    time.Time `greptime:"created,field"`
+	TS         time.Time `greptime:"ts,timestamp,precision=s"`
+	Debug      string    `greptime:"-"`
+	Count      int32     `greptime:"count,type=int64"`
+	unexported int
+}
+
+type structImplicitTimestamp struct {
+	Value float64
+	At    time.Time
+	Next  time.Time
+}
+
+func TestStructSchema(t *testing.T) {
+	type column struct {
+		name     string
+		semantic Column_SemanticType
+		datatype ColumnDataType
+	}
+	tests := []struct {
+		name string
+		typ  reflect.Type
+		want []column
+	}{
+		{
+			name: "tags",
+			typ:  reflect.TypeOf(structMetric{}),
+			want: []column{
+				{"region", Column_TAG, ColumnDataType_STRING},
+				{"dc", Column_TAG, ColumnDataType_STRING},
+				{"host", Column_TAG, ColumnDataType_STRING},
+				{"cpu_usage", Column_FIELD, ColumnDataType_FLOAT64},
+				{"load", Column_FIELD, ColumnDataType_FLOAT64},
+				{"created", Column_FIELD, ColumnDataType_TIMESTAMP_MILLISECOND},
+				{"ts", Column_TIMESTAMP, ColumnDataType_TIMESTAMP_SECOND},
+				{"count", Column_FIELD, ColumnDataType_INT64},
+			},
+		},
+		{
+			name: "implicit timestamp",
+			typ:  reflect.TypeOf(structImplicitTimestamp{}),
+			want: []column{
+				{"value", Column_FIELD, ColumnDataType_FLOAT64},
+				{"at", Column_TIMESTAMP, ColumnDataType_TIMESTAMP_MILLISECOND},
+				{"next", Column_FIELD, ColumnDataType_TIMESTAMP_MILLISECOND},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := structSchemaOf(tt.typ)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]column, len(s.fields))
+			for i, f := range s.fields {
+				got[i] = column{f.name, f.semantic, f.datatype}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("columns = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStructSchemaErrors(t *testing.T) {
+	for _, typ := range []reflect.Type{
+		reflect.TypeOf(struct {
+			A int `greptime:"x"`
+			B int `greptime:"x"`
+		}{}),
+		reflect.TypeOf(struct {
+			A time.Time `greptime:",timestamp"`
+			B time.Time `greptime:",timestamp"`
+		}{}),
+		reflect.TypeOf(struct {
+			A int64 `greptime:",timestamp"`
+		}{}),
+		reflect.TypeOf(struct {
+			A int `greptime:",primary"`
+		}{}),
+		reflect.TypeOf(struct {
+			A int `greptime:",type=int128"`
+		}{}),
+		reflect.TypeOf(struct {
+			A time.Time `greptime:",precision=m"`
+		}{}),
+		reflect.TypeOf(struct{ A chan int }{}),
+		reflect.TypeOf(struct{ A []string }{}),
+	} {
+		if s, err := structSchemaOf(typ); err == nil {
+			t.Errorf("structSchemaOf(%s) = %+v, want an error", typ, s.fields)
+		}
+	}
+}
+
+func TestStructSchemaCache(t *testing.T) {
+	typ := reflect.TypeOf(structImplicitTimestamp{})
+	schemas := make([]*structSchema, 8)
+	var wg sync.WaitGroup
+	for i := range schemas {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			schemas[i], _ = structSchemaOf(typ)
+		}(i)
+	}
+	wg.Wait()
+	cached, ok := structSchemas.Load(typ)
+	if !ok {
+		t.Fatal("schema not cached")
+	}
+	for i, s := range schemas {
+		if s != cached.(*structSchema) {
+			t.Errorf("call %d returned schema %p, want the cached %p", i, s, cached)
+		}
+	}
+}
+
+func TestInsertRequestFromStructs(t *testing.T) {
+	load := float32(0.5)
+	rows := []structMetric{
+		{
+			structBase:   structBase{Region: "r"},
+			StructLabels: &StructLabels{DC: "dc1"},
+			Host:         "a",
+			CPUUsage:     1.5,
+			Load:         &load,
+			Created:      time.UnixMilli(1500),
+			TS:           time.Unix(10, 0),
+			Debug:        "ignored",
+			Count:        3,
+		},
+		{Host: "b", CPUUsage: 2, TS: time.Unix(20, 0)},
+	}
+	got, err := InsertRequestFromStructs("metrics", rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &InsertRequest{
+		TableName: "metrics",
+		RowCount:  2,
+		Columns: []*Column{
+			{ColumnName: "region", SemanticType: Column_TAG, Datatype: ColumnDataType_STRING, Values: &Column_Values{StringValues: []string{"r", ""}}},
+			// The nil embedded pointer makes dc null.
+			{ColumnName: "dc", SemanticType: Column_TAG, Datatype: ColumnDataType_STRING, Values: &Column_Values{StringValues: []string{"dc1"}}, NullMask: []byte{0b10}},
+			{ColumnName: "host", SemanticType: Column_TAG, Datatype: ColumnDataType_STRING, Values: &Column_Values{StringValues: []string{"a", "b"}}},
+			{ColumnName: "cpu_usage", SemanticType: Column_FIELD, Datatype: ColumnDataType_FLOAT64, Values: &Column_Values{F64Values: []float64{1.5, 2}}},
+			{ColumnName: "load", SemanticType: Column_FIELD, Datatype: ColumnDataType_FLOAT64, Values: &Column_Values{F64Values: []float64{0.5}}, NullMask: []byte{0b10}},
+			{ColumnName: "created", SemanticType: Column_FIELD, Datatype: ColumnDataType_TIMESTAMP_MILLISECOND, Values: &Column_Values{TsMillisecondValues: []int64{1500, time.Time{}.UnixMilli()}}},
+			{ColumnName: "ts", SemanticType: Column_TIMESTAMP, Datatype: ColumnDataType_TIMESTAMP_SECOND, Values: &Column_Values{TsSecondValues: []int64{10, 20}}},
+			{ColumnName: "count", SemanticType: Column_FIELD, Datatype: ColumnDataType_INT64, Values: &Column_Values{I64Values: []int64{3, 0}}},
+		},
+	}
+	if !proto.Equal(got, want) {
+		t.Errorf("InsertRequestFromStructs() = %v, want %v", got, want)
+	}
+
+	ptrs, err := InsertRequestFromStructs("metrics", []*structMetric{&rows[0], &rows[1]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(ptrs, want) {
+		t.Errorf("InsertRequestFromStructs() of pointers = %v, want %v", ptrs, want)
+	}
+	if got, err := InsertRequestFromStructs("t", []int{1}); err == nil {
+		t.Errorf("InsertRequestFromStructs() of ints = %v, want an error", got)
+	}
+}
+
+func TestCreateTableExprFromStruct(t *testing.T) {
+	got, err := CreateTableExprFromStruct[*structMetric]("metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := NewTable("metrics").
+		Tag("region", ColumnDataType_STRING).
+		Tag("dc", ColumnDataType_STRING).
+		Tag("host", ColumnDataType_STRING).
+		Field("cpu_usage", ColumnDataType_FLOAT64).
+		Field("load", ColumnDataType_FLOAT64).
+		Field("created", ColumnDataType_TIMESTAMP_MILLISECOND).
+		Timestamp("ts", ColumnDataType_TIMESTAMP_SECOND).
+		Field("count", ColumnDataType_INT64).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(got, want) {
+		t.Errorf("CreateTableExprFromStruct() = %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(got.PrimaryKeys, []string{"region", "dc", "host"}) || got.TimeIndex != "ts" {
+		t.Errorf("primary keys %v and time index %q", got.PrimaryKeys, got.TimeIndex)
+	}
+
+	type noTimestamp struct{ Value float64 }
+	if got, err := CreateTableExprFromStruct[noTimestamp]("t"); err == nil {
+		t.Errorf("CreateTableExprFromStruct() without timestamp = %v, want an error", got)
+	}
+	if got, err := CreateTableExprFromStruct[string]("t"); err == nil {
+		t.Errorf("CreateTableExprFromStruct() of a string = %v, want an error", got)
+	}
+}
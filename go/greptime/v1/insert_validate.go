@@ -0,0 +1,218 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Errors wrapped by ColumnError, to be tested with errors.Is.
+var (
+	ErrEmptyColumnName     = errors.New("empty column name")
+	ErrDuplicateColumn     = errors.New("duplicate column name")
+	ErrUnknownDatatype     = errors.New("unknown datatype")
+	ErrRowCount            = errors.New("row count mismatch")
+	ErrNullMask            = errors.New("malformed null mask")
+	ErrValuesField         = errors.New("values in the wrong field for the datatype")
+	ErrTimestampDatatype   = errors.New("timestamp column without a timestamp datatype")
+	ErrMultipleTimestamps  = errors.New("more than one timestamp column")
+	ErrNullTimestampColumn = errors.New("null in the timestamp column")
+)
+
+// valuesFields maps a ColumnDataType to the number of the Column_Values
+// field that holds it.
+var valuesFields = [...]protoreflect.FieldNumber{
+	ColumnDataType_BOOLEAN:               11,
+	ColumnDataType_INT8:                  1,
+	ColumnDataType_INT16:                 2,
+	ColumnDataType_INT32:                 3,
+	ColumnDataType_INT64:                 4,
+	ColumnDataType_UINT8:                 5,
+	ColumnDataType_UINT16:                6,
+	ColumnDataType_UINT32:                7,
+	ColumnDataType_UINT64:                8,
+	ColumnDataType_FLOAT32:               9,
+	ColumnDataType_FLOAT64:               10,
+	ColumnDataType_BINARY:                12,
+	ColumnDataType_STRING:                13,
+	ColumnDataType_DATE:                  14,
+	ColumnDataType_DATETIME:              15,
+	ColumnDataType_TIMESTAMP_SECOND:      16,
+	ColumnDataType_TIMESTAMP_MILLISECOND: 17,
+	ColumnDataType_TIMESTAMP_MICROSECOND: 18,
+	ColumnDataType_TIMESTAMP_NANOSECOND:  19,
+	ColumnDataType_TIME_SECOND:           20,
+	ColumnDataType_TIME_MILLISECOND:      21,
+	ColumnDataType_TIME_MICROSECOND:      22,
+	ColumnDataType_TIME_NANOSECOND:       23,
+}
+
+// ColumnError is an invariant violated by one column of a request.
+type ColumnError struct {
+	// Index is the position of the column in the request.
+	Index int
+	// Name is the name of the column.
+	Name string
+	// Err is one of the Err* errors of this package.
+	Err error
+	// Detail describes the violation.
+	Detail string
+}
+
+func (e *ColumnError) Error() string {
+	if e.Detail == "" {
+		return fmt.Sprintf("column %d (%q): %v", e.Index, e.Name, e.Err)
+	}
+	return fmt.Sprintf("column %d (%q): %v: %s", e.Index, e.Name, e.Err, e.Detail)
+}
+
+func (e *ColumnError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationError lists every ColumnError found in a request.
+type ValidationError struct {
+	Table  string
+	Errors []*ColumnError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("invalid request for table %q: %s", e.Table, strings.Join(msgs, "; "))
+}
+
+// Is reports whether any of the column errors matches target.
+func (e *ValidationError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the invariants of the request the server relies on: every
+// column has a unique non-empty name and a known datatype, stores exactly
+// RowCount values and nulls in the Column_Values field of its datatype, and
+// has a null mask of either zero or ceil(RowCount/8) bytes with no bit set
+// past RowCount. At most one column is the TIMESTAMP column, with a
+// timestamp datatype and no nulls.
+//
+// The returned error is a *ValidationError listing every violation.
+func (x *InsertRequest) Validate() error {
+	return validateColumns(x.GetTableName(), x.GetColumns(), x.GetRowCount())
+}
+
+// Validate checks the key columns of the request like
+// InsertRequest.Validate does.
+func (x *DeleteRequest) Validate() error {
+	return validateColumns(x.GetTableName(), x.GetKeyColumns(), x.GetRowCount())
+}
+
+// Validate validates every request, returning the first error.
+func (x *InsertRequests) Validate() error {
+	for i, req := range x.GetInserts() {
+		if err := req.Validate(); err != nil {
+			return fmt.Errorf("insert %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func validateColumns(table string, columns []*Column, rowCount uint32) error {
+	verr := &ValidationError{Table: table}
+	report := func(i int, err error, format string, args ...any) {
+		verr.Errors = append(verr.Errors, &ColumnError{
+			Index:  i,
+			Name:   columns[i].GetColumnName(),
+			Err:    err,
+			Detail: fmt.Sprintf(format, args...),
+		})
+	}
+
+	names := make(map[string]int, len(columns))
+	timestamp := -1
+	for i, column := range columns {
+		name := column.GetColumnName()
+		if name == "" {
+			report(i, ErrEmptyColumnName, "")
+		} else if j, ok := names[name]; ok {
+			report(i, ErrDuplicateColumn, "already defined by column %d", j)
+		} else {
+			names[name] = i
+		}
+
+		datatype := column.GetDatatype()
+		if _, ok := ColumnDataType_name[int32(datatype)]; !ok {
+			report(i, ErrUnknownDatatype, "%d", datatype)
+			continue
+		}
+
+		nulls, ok := validateNullMask(column.GetNullMask(), int(rowCount))
+		if !ok {
+			report(i, ErrNullMask, "%d bytes with %d rows", len(column.GetNullMask()), rowCount)
+		}
+		if n := valueCount(column.GetValues(), datatype); ok && n+nulls != int(rowCount) {
+			report(i, ErrRowCount, "%d values and %d nulls for %d rows", n, nulls, rowCount)
+		}
+		if column.GetValues() != nil {
+			column.GetValues().ProtoReflect().Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+				if fd.Number() != valuesFields[datatype] {
+					report(i, ErrValuesField, "%s in a %s column", fd.Name(), datatype)
+				}
+				return true
+			})
+		}
+
+		if column.GetSemanticType() != Column_TIMESTAMP {
+			continue
+		}
+		if timestamp >= 0 {
+			report(i, ErrMultipleTimestamps, "timestamp column is already %q", columns[timestamp].GetColumnName())
+		} else {
+			timestamp = i
+		}
+		if !datatype.IsTimestamp() {
+			report(i, ErrTimestampDatatype, "%s", datatype)
+		}
+		if ok && nulls > 0 {
+			report(i, ErrNullTimestampColumn, "%d nulls", nulls)
+		}
+	}
+	if len(verr.Errors) > 0 {
+		return verr
+	}
+	return nil
+}
+
+// validateNullMask returns the number of nulls in mask, and false if its
+// length doesn't match rowCount or a bit past rowCount is set.
+func validateNullMask(mask []byte, rowCount int) (int, bool) {
+	if len(mask) != 0 && len(mask) != (rowCount+7)/8 {
+		return 0, false
+	}
+	bitmap, err := BitmapFromBytes(mask, rowCount)
+	if err != nil {
+		return 0, false
+	}
+	return bitmap.Count(), true
+}
@@ -0,0 +1,167 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestValuesFields checks valuesFields against the fields valueCount reads.
+func TestValuesFields(t *testing.T) {
+	for number := range ColumnDataType_name {
+		datatype := ColumnDataType(number)
+		values := &Column_Values{}
+		m := values.ProtoReflect()
+		fd := m.Descriptor().Fields().ByNumber(valuesFields[datatype])
+		if fd == nil {
+			t.Errorf("%s: no Column_Values field %d", datatype, valuesFields[datatype])
+			continue
+		}
+		list := m.Mutable(fd).List()
+		list.Append(list.NewElement())
+		if n := valueCount(values, datatype); n != 1 {
+			t.Errorf("%s: valueCount of a value in %s = %d, want 1", datatype, fd.Name(), n)
+		}
+	}
+}
+
+func TestInsertRequestValidate(t *testing.T) {
+	ts := func(name string, values ...int64) *Column {
+		return &Column{
+			ColumnName:   name,
+			SemanticType: Column_TIMESTAMP,
+			Datatype:     ColumnDataType_TIMESTAMP_MILLISECOND,
+			Values:       &Column_Values{TsMillisecondValues: values},
+		}
+	}
+	tests := []struct {
+		name    string
+		columns []*Column
+		rows    uint32
+		// want lists the errors expected for each column index.
+		want map[int][]error
+	}{
+		{
+			name: "valid",
+			columns: []*Column{
+				ts("ts", 1, 2),
+				{ColumnName: "v", Datatype: ColumnDataType_INT8, Values: &Column_Values{I8Values: []int32{1}}, NullMask: []byte{0b10}},
+			},
+			rows: 2,
+		},
+		{
+			name: "names",
+			columns: []*Column{
+				ts("ts", 1),
+				{Datatype: ColumnDataType_BOOLEAN, Values: &Column_Values{BoolValues: []bool{true}}},
+				{ColumnName: "ts", Datatype: ColumnDataType_BOOLEAN, Values: &Column_Values{BoolValues: []bool{true}}},
+			},
+			rows: 1,
+			want: map[int][]error{1: {ErrEmptyColumnName}, 2: {ErrDuplicateColumn}},
+		},
+		{
+			name: "datatype",
+			columns: []*Column{
+				{ColumnName: "v", Datatype: 100},
+			},
+			rows: 1,
+			want: map[int][]error{0: {ErrUnknownDatatype}},
+		},
+		{
+			name: "row count",
+			columns: []*Column{
+				ts("ts", 1, 2, 3),
+				{ColumnName: "v", Datatype: ColumnDataType_STRING, Values: &Column_Values{StringValues: []string{"a"}}},
+			},
+			rows: 2,
+			want: map[int][]error{0: {ErrRowCount}, 1: {ErrRowCount}},
+		},
+		{
+			name: "null mask",
+			columns: []*Column{
+				{ColumnName: "a", Datatype: ColumnDataType_STRING, Values: &Column_Values{StringValues: []string{"a"}}, NullMask: []byte{0b10, 0}},
+				{ColumnName: "b", Datatype: ColumnDataType_STRING, Values: &Column_Values{StringValues: []string{"a"}}, NullMask: []byte{0b100}},
+			},
+			rows: 2,
+			want: map[int][]error{0: {ErrNullMask}, 1: {ErrNullMask}},
+		},
+		{
+			name: "values field",
+			columns: []*Column{
+				{ColumnName: "v", Datatype: ColumnDataType_INT64, Values: &Column_Values{I64Values: []int64{1}, I32Values: []int32{1}}},
+			},
+			rows: 1,
+			want: map[int][]error{0: {ErrValuesField}},
+		},
+		{
+			name: "timestamps",
+			columns: []*Column{
+				ts("ts", 1),
+				ts("ts2", 1),
+				{ColumnName: "ts3", SemanticType: Column_TIMESTAMP, Datatype: ColumnDataType_INT64, Values: &Column_Values{I64Values: []int64{1}}},
+			},
+			rows: 1,
+			want: map[int][]error{1: {ErrMultipleTimestamps}, 2: {ErrMultipleTimestamps, ErrTimestampDatatype}},
+		},
+		{
+			name: "null timestamp",
+			columns: []*Column{
+				func() *Column { c := ts("ts", 1); c.NullMask = []byte{0b10}; return c }(),
+			},
+			rows: 2,
+			want: map[int][]error{0: {ErrNullTimestampColumn}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := (&InsertRequest{TableName: "t", Columns: tt.columns, RowCount: tt.rows}).Validate()
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("Validate() = %v, want a *ValidationError", err)
+			}
+			got := make(map[int][]error)
+			for _, cerr := range verr.Errors {
+				if cerr.Name != tt.columns[cerr.Index].GetColumnName() {
+					t.Errorf("error %v names column %q", cerr, cerr.Name)
+				}
+				got[cerr.Index] = append(got[cerr.Index], cerr.Err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Validate() = %v, want errors for columns %v", err, tt.want)
+			}
+			for i, want := range tt.want {
+				if len(got[i]) != len(want) {
+					t.Errorf("column %d: errors %v, want %v", i, got[i], want)
+					continue
+				}
+				for j := range want {
+					if got[i][j] != want[j] {
+						t.Errorf("column %d: errors %v, want %v", i, got[i], want)
+					}
+					if !errors.Is(err, want[j]) {
+						t.Errorf("errors.Is(%v, %v) = false", err, want[j])
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxPromPoints is the most points a range query may evaluate per series,
+// as in Prometheus.
+const MaxPromPoints = 11000
+
+// ErrTooManyPoints is returned for range queries evaluating more than
+// MaxPromPoints points per series.
+var ErrTooManyPoints = errors.New("range query exceeds the maximum number of points")
+
+// FormatPromTime formats t as the server parses the times of PromQL
+// queries: in seconds since the epoch, with a fraction for sub-second
+// times, like "1435781451.781".
+func FormatPromTime(t time.Time) string {
+	sec, nsec := t.Unix(), int64(t.Nanosecond())
+	switch {
+	case sec < 0 && nsec > 0:
+		// Before the epoch, the fraction counts from the next second.
+		return "-" + formatSeconds(-sec-1, time.Second.Nanoseconds()-nsec)
+	case sec < 0:
+		return "-" + formatSeconds(-sec, 0)
+	}
+	return formatSeconds(sec, nsec)
+}
+
+// FormatPromDuration formats d as the server parses the steps of range
+// queries: in seconds, with a fraction for sub-second durations, like "15"
+// or "0.5".
+func FormatPromDuration(d time.Duration) string {
+	if d < 0 {
+		// Negating d itself would overflow for the smallest Duration.
+		return "-" + formatSeconds(-int64(d/time.Second), -int64(d%time.Second))
+	}
+	return formatSeconds(int64(d/time.Second), int64(d%time.Second))
+}
+
+// formatSeconds formats sec+nsec/1e9, both non-negative, in decimal.
+func formatSeconds(sec, nsec int64) string {
+	s := strconv.FormatInt(sec, 10)
+	if nsec > 0 {
+		s += "." + strings.TrimRight(fmt.Sprintf("%09d", nsec), "0")
+	}
+	return s
+}
+
+// NewPromInstantQuery returns an instant query evaluated at t.
+func NewPromInstantQuery(query string, t time.Time) *PromInstantQuery {
+	return &PromInstantQuery{Query: query, Time: FormatPromTime(t)}
+}
+
+// NewPromRangeQuery returns a range query evaluated from start to end every
+// step. It fails if end is before start, if step isn't positive, and with
+// ErrTooManyPoints for more than MaxPromPoints points, which
+// SplitPromRangeQuery splits in several queries.
+func NewPromRangeQuery(query string, start, end time.Time, step time.Duration) (*PromRangeQuery, error) {
+	points, err := promPoints(start, end, step)
+	if err != nil {
+		return nil, err
+	}
+	if points > MaxPromPoints {
+		return nil, fmt.Errorf("%w: %d points from %s to %s every %s, at most %d",
+			ErrTooManyPoints, points, start, end, step, MaxPromPoints)
+	}
+	return newPromRangeQuery(query, start, end, step), nil
+}
+
+func newPromRangeQuery(query string, start, end time.Time, step time.Duration) *PromRangeQuery {
+	return &PromRangeQuery{
+		Query: query,
+		Start: FormatPromTime(start),
+		End:   FormatPromTime(end),
+		Step:  FormatPromDuration(step),
+	}
+}
+
+// promPoints returns the number of points a range query evaluates.
+func promPoints(start, end time.Time, step time.Duration) (int64, error) {
+	if step <= 0 {
+		return 0, fmt.Errorf("range query step %s isn't positive", step)
+	}
+	if end.Before(start) {
+		return 0, fmt.Errorf("range query end %s is before its start %s", end, start)
+	}
+	return int64(end.Sub(start)/step) + 1, nil
+}
+
+// SplitPromRangeQuery returns the range queries evaluating the points of a
+// range query from start to end every step, maxPoints at most each, or
+// MaxPromPoints if maxPoints isn't positive or exceeds it. The queries
+// follow each other without overlapping, the points of each being those of
+// the whole range.
+func SplitPromRangeQuery(query string, start, end time.Time, step time.Duration, maxPoints int) ([]*PromRangeQuery, error) {
+	if maxPoints <= 0 || maxPoints > MaxPromPoints {
+		maxPoints = MaxPromPoints
+	}
+	points, err := promPoints(start, end, step)
+	if err != nil {
+		return nil, err
+	}
+	if step > math.MaxInt64/time.Duration(maxPoints) {
+		// The span of maxPoints steps overflows a Duration, and so exceeds
+		// any range.
+		return []*PromRangeQuery{newPromRangeQuery(query, start, end, step)}, nil
+	}
+	queries := make([]*PromRangeQuery, 0, (points+int64(maxPoints)-1)/int64(maxPoints))
+	span := time.Duration(maxPoints) * step
+	for from := start; !from.After(end); from = from.Add(span) {
+		to := from.Add(span - step)
+		if to.After(end) {
+			to = end
+		}
+		queries = append(queries, newPromRangeQuery(query, from, to, step))
+	}
+	return queries, nil
+}
+
+// Request returns the PromqlRequest of the query.
+func (x *PromInstantQuery) Request() *PromqlRequest {
+	return &PromqlRequest{Promql: &PromqlRequest_InstantQuery{InstantQuery: x}}
+}
+
+// Request returns the PromqlRequest of the query.
+func (x *PromRangeQuery) Request() *PromqlRequest {
+	return &PromqlRequest{Promql: &PromqlRequest_RangeQuery{RangeQuery: x}}
+}
@@ -0,0 +1,126 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestFormatPromTime(t *testing.T) {
+	tests := []struct {
+		t    time.Time
+		want string
+	}{
+		{time.Unix(0, 0), "0"},
+		{time.Unix(1435781451, 781e6), "1435781451.781"},
+		{time.Unix(5, 1e8), "5.1"},
+		{time.Unix(0, 1), "0.000000001"},
+		{time.Unix(-1, 0), "-1"},
+		{time.Unix(-2, 5e8), "-1.5"},
+		{time.Unix(0, -1), "-0.000000001"},
+		{time.Unix(-1435781451, -781e6), "-1435781451.781"},
+	}
+	for _, tt := range tests {
+		if got := FormatPromTime(tt.t); got != tt.want {
+			t.Errorf("FormatPromTime(%d.%09d) = %s, want %s", tt.t.Unix(), tt.t.Nanosecond(), got, tt.want)
+		}
+	}
+}
+
+func TestFormatPromDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "0"},
+		{15 * time.Second, "15"},
+		{500 * time.Millisecond, "0.5"},
+		{1500 * time.Millisecond, "1.5"},
+		{time.Nanosecond, "0.000000001"},
+		{-250 * time.Millisecond, "-0.25"},
+		{math.MaxInt64, "9223372036.854775807"},
+		{math.MinInt64, "-9223372036.854775808"},
+	}
+	for _, tt := range tests {
+		if got := FormatPromDuration(tt.d); got != tt.want {
+			t.Errorf("FormatPromDuration(%s) = %s, want %s", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestNewPromRangeQuery(t *testing.T) {
+	start := time.Unix(0, 0)
+	q, err := NewPromRangeQuery("up", start, start.Add((MaxPromPoints-1)*time.Second), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Start != "0" || q.End != "10999" || q.Step != "1" {
+		t.Errorf("NewPromRangeQuery() = %v", q)
+	}
+	if _, err := NewPromRangeQuery("up", start, start.Add(MaxPromPoints*time.Second), time.Second); !errors.Is(err, ErrTooManyPoints) {
+		t.Errorf("NewPromRangeQuery() of %d points: %v, want ErrTooManyPoints", MaxPromPoints+1, err)
+	}
+}
+
+func TestSplitPromRangeQuery(t *testing.T) {
+	start := time.Unix(0, 0)
+	seconds := func(s float64) time.Time { return start.Add(time.Duration(s * float64(time.Second))) }
+	tests := []struct {
+		name      string
+		end       time.Time
+		step      time.Duration
+		maxPoints int
+		// want are the start and end of the queries.
+		want [][2]string
+	}{
+		{name: "single point", end: start, step: time.Second, maxPoints: 3, want: [][2]string{{"0", "0"}}},
+		{name: "max points", end: seconds(2), step: time.Second, maxPoints: 3, want: [][2]string{{"0", "2"}}},
+		{name: "one more point", end: seconds(3), step: time.Second, maxPoints: 3, want: [][2]string{{"0", "2"}, {"3", "3"}}},
+		{name: "twice max points", end: seconds(5), step: time.Second, maxPoints: 3, want: [][2]string{{"0", "2"}, {"3", "5"}}},
+		{name: "end between points", end: seconds(5.5), step: time.Second, maxPoints: 3, want: [][2]string{{"0", "2"}, {"3", "5"}}},
+		{name: "sub-second step", end: seconds(1), step: 250 * time.Millisecond, maxPoints: 2, want: [][2]string{{"0", "0.25"}, {"0.5", "0.75"}, {"1", "1"}}},
+		{name: "default max points", end: seconds(MaxPromPoints), step: time.Second, want: [][2]string{{"0", "10999"}, {"11000", "11000"}}},
+		{name: "max points above limit", end: seconds(MaxPromPoints - 1), step: time.Second, maxPoints: 2 * MaxPromPoints, want: [][2]string{{"0", "10999"}}},
+		{name: "span overflow", end: seconds(1e9), step: math.MaxInt64 / 2, maxPoints: 3, want: [][2]string{{"0", "1000000000"}}},
+		{name: "largest span", end: seconds(1), step: math.MaxInt64, maxPoints: 1, want: [][2]string{{"0", "0"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queries, err := SplitPromRangeQuery("up", start, tt.end, tt.step, tt.maxPoints)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(queries) != len(tt.want) {
+				t.Fatalf("%d queries %v, want %d", len(queries), queries, len(tt.want))
+			}
+			step := FormatPromDuration(tt.step)
+			for i, q := range queries {
+				if q.Query != "up" || q.Start != tt.want[i][0] || q.End != tt.want[i][1] || q.Step != step {
+					t.Errorf("query %d = %v, want %s to %s every %s", i, q, tt.want[i][0], tt.want[i][1], step)
+				}
+			}
+		})
+	}
+
+	if _, err := SplitPromRangeQuery("up", start, start, 0, 0); err == nil {
+		t.Error("SplitPromRangeQuery() of a zero step succeeded")
+	}
+	if _, err := SplitPromRangeQuery("up", start, start.Add(-time.Second), time.Second, 0); err == nil {
+		t.Error("SplitPromRangeQuery() ending before its start succeeded")
+	}
+}
@@ -0,0 +1,228 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	greptimev1 "github.com/GreptimeTeam/greptime-proto/go/greptime/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// APIOptions configures the handler of NewAPIHandler.
+type APIOptions struct {
+	// Header returns the header of the PromqlRequest of an HTTP request,
+	// authenticating it and selecting its database. An error refuses the
+	// request with 401 Unauthorized. DefaultAPIHeader by default.
+	Header func(r *http.Request) (*greptimev1.RequestHeader, error)
+	// Now is the evaluation time of the instant queries without time,
+	// time.Now by default.
+	Now func() time.Time
+}
+
+// DefaultAPIHeader maps an HTTP request as the HTTP API of GreptimeDB does:
+// the "db" parameter selects the database, and basic authentication
+// credentials are passed on.
+func DefaultAPIHeader(r *http.Request) (*greptimev1.RequestHeader, error) {
+	header := &greptimev1.RequestHeader{Dbname: r.Form.Get("db")}
+	if username, password, ok := r.BasicAuth(); ok {
+		header.Authorization = &greptimev1.AuthHeader{
+			AuthScheme: &greptimev1.AuthHeader_Basic{Basic: &greptimev1.Basic{Username: username, Password: password}},
+		}
+	}
+	return header, nil
+}
+
+// NewAPIHandler returns a handler of the /api/v1/query and
+// /api/v1/query_range endpoints of the Prometheus HTTP API, which forwards
+// the queries to client and answers with the bodies of the responses.
+//
+// The parameters are passed on as is, the server parsing times and steps
+// as Prometheus does. Errors are answered in the format of the API, with
+// the status codes of Prometheus.
+func NewAPIHandler(client greptimev1.PrometheusGatewayClient, opts APIOptions) http.Handler {
+	if opts.Header == nil {
+		opts.Header = DefaultAPIHeader
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	h := &apiHandler{client: client, opts: opts}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/query", h.query)
+	mux.HandleFunc("/api/v1/query_range", h.queryRange)
+	return mux
+}
+
+type apiHandler struct {
+	client greptimev1.PrometheusGatewayClient
+	opts   APIOptions
+}
+
+// The error types of the Prometheus HTTP API.
+const (
+	errorBadData      = "bad_data"
+	errorExecution    = "execution"
+	errorCanceled     = "canceled"
+	errorTimeout      = "timeout"
+	errorInternal     = "internal"
+	errorNotFound     = "not_found"
+	errorUnavailable  = "unavailable"
+	errorUnauthorized = "unauthorized"
+)
+
+// errorCodes are the status codes Prometheus answers errors with.
+var errorCodes = map[string]int{
+	errorBadData:      http.StatusBadRequest,
+	errorExecution:    http.StatusUnprocessableEntity,
+	errorCanceled:     http.StatusServiceUnavailable,
+	errorTimeout:      http.StatusServiceUnavailable,
+	errorInternal:     http.StatusInternalServerError,
+	errorNotFound:     http.StatusNotFound,
+	errorUnavailable:  http.StatusServiceUnavailable,
+	errorUnauthorized: http.StatusUnauthorized,
+}
+
+func (h *apiHandler) query(w http.ResponseWriter, r *http.Request) {
+	if !h.parse(w, r, "query") {
+		return
+	}
+	t := r.Form.Get("time")
+	if t == "" {
+		t = greptimev1.FormatPromTime(h.opts.Now())
+	}
+	h.handle(w, r, (&greptimev1.PromInstantQuery{Query: r.Form.Get("query"), Time: t}).Request())
+}
+
+func (h *apiHandler) queryRange(w http.ResponseWriter, r *http.Request) {
+	if !h.parse(w, r, "query", "start", "end", "step") {
+		return
+	}
+	h.handle(w, r, (&greptimev1.PromRangeQuery{
+		Query: r.Form.Get("query"),
+		Start: r.Form.Get("start"),
+		End:   r.Form.Get("end"),
+		Step:  r.Form.Get("step"),
+	}).Request())
+}
+
+// parse parses the parameters of r, in the URL or a POSTed form, and
+// checks the required ones are set.
+func (h *apiHandler) parse(w http.ResponseWriter, r *http.Request, required ...string) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		apiError(w, http.StatusMethodNotAllowed, errorBadData, fmt.Sprintf("method %s not allowed", r.Method))
+		return false
+	}
+	if err := r.ParseForm(); err != nil {
+		apiError(w, http.StatusBadRequest, errorBadData, err.Error())
+		return false
+	}
+	for _, name := range required {
+		if r.Form.Get(name) == "" {
+			apiError(w, http.StatusBadRequest, errorBadData, fmt.Sprintf("missing parameter %q", name))
+			return false
+		}
+	}
+	return true
+}
+
+// handle forwards req with the header and timeout of r.
+func (h *apiHandler) handle(w http.ResponseWriter, r *http.Request, req *greptimev1.PromqlRequest) {
+	header, err := h.opts.Header(r)
+	if err != nil {
+		apiError(w, http.StatusUnauthorized, errorUnauthorized, err.Error())
+		return
+	}
+	req.Header = header
+
+	ctx := r.Context()
+	if timeout := r.Form.Get("timeout"); timeout != "" {
+		d, err := parseTimeout(timeout)
+		if err != nil {
+			apiError(w, http.StatusBadRequest, errorBadData, err.Error())
+			return
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d)
+		defer cancel()
+	}
+
+	resp, err := h.client.Handle(ctx, req)
+	if err != nil {
+		errorType := grpcErrorType(status.Code(err))
+		apiError(w, errorCodes[errorType], errorType, status.Convert(err).Message())
+		return
+	}
+	code := http.StatusOK
+	var body struct {
+		Status    string `json:"status"`
+		ErrorType string `json:"errorType"`
+	}
+	if json.Unmarshal(resp.GetBody(), &body) == nil && body.Status == "error" {
+		if code = errorCodes[body.ErrorType]; code == 0 {
+			code = http.StatusUnprocessableEntity
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_, _ = w.Write(resp.GetBody())
+}
+
+// parseTimeout parses a timeout in seconds or as a Go duration. Timeouts
+// in seconds must be finite and fit a time.Duration.
+func parseTimeout(s string) (time.Duration, error) {
+	if seconds, err := strconv.ParseFloat(s, 64); err == nil && seconds > 0 && seconds <= math.MaxInt64/float64(time.Second) {
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	if d, err := time.ParseDuration(s); err == nil && d > 0 {
+		return d, nil
+	}
+	return 0, fmt.Errorf("invalid timeout %q", s)
+}
+
+// grpcErrorType returns the API error type of a status code.
+func grpcErrorType(code codes.Code) string {
+	switch code {
+	case codes.InvalidArgument:
+		return errorBadData
+	case codes.Unauthenticated, codes.PermissionDenied:
+		return errorUnauthorized
+	case codes.NotFound:
+		return errorNotFound
+	case codes.DeadlineExceeded:
+		return errorTimeout
+	case codes.Canceled:
+		return errorCanceled
+	case codes.Unavailable:
+		return errorUnavailable
+	}
+	return errorInternal
+}
+
+// apiError answers an error in the format of the Prometheus HTTP API.
+func apiError(w http.ResponseWriter, code int, errorType, message string) {
+	body, _ := json.Marshal(map[string]string{"status": "error", "errorType": errorType, "error": message})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_, _ = w.Write(body)
+}
@@ -0,0 +1,194 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	greptimev1 "github.com/GreptimeTeam/greptime-proto/go/greptime/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// gateway answers PromQL requests with body or err, recording the last
+// request and whether its context had a deadline.
+type gateway struct {
+	body     string
+	err      error
+	req      *greptimev1.PromqlRequest
+	deadline bool
+}
+
+func (g *gateway) Handle(ctx context.Context, req *greptimev1.PromqlRequest, _ ...grpc.CallOption) (*greptimev1.PromqlResponse, error) {
+	g.req = req
+	_, g.deadline = ctx.Deadline()
+	if g.err != nil {
+		return nil, g.err
+	}
+	return &greptimev1.PromqlResponse{Body: []byte(g.body)}, nil
+}
+
+const successBody = `{"status":"success","data":{"resultType":"vector","result":[]}}`
+
+func TestAPIHandler(t *testing.T) {
+	basic := func(username, password string) *greptimev1.AuthHeader {
+		return &greptimev1.AuthHeader{AuthScheme: &greptimev1.AuthHeader_Basic{Basic: &greptimev1.Basic{Username: username, Password: password}}}
+	}
+	tests := []struct {
+		name     string
+		request  func() *http.Request
+		want     *greptimev1.PromqlRequest
+		deadline bool
+	}{
+		{
+			name: "instant",
+			request: func() *http.Request {
+				r := httptest.NewRequest(http.MethodGet, "/api/v1/query?query=up&time=1435781451.781&db=c-s", nil)
+				r.SetBasicAuth("u", "p")
+				return r
+			},
+			want: &greptimev1.PromqlRequest{
+				Header: &greptimev1.RequestHeader{Dbname: "c-s", Authorization: basic("u", "p")},
+				Promql: &greptimev1.PromqlRequest_InstantQuery{InstantQuery: &greptimev1.PromInstantQuery{Query: "up", Time: "1435781451.781"}},
+			},
+		},
+		{
+			name: "instant now",
+			request: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, "/api/v1/query?query=up", nil)
+			},
+			want: &greptimev1.PromqlRequest{
+				Header: &greptimev1.RequestHeader{},
+				Promql: &greptimev1.PromqlRequest_InstantQuery{InstantQuery: &greptimev1.PromInstantQuery{Query: "up", Time: "1.5"}},
+			},
+		},
+		{
+			name: "range form",
+			request: func() *http.Request {
+				form := url.Values{"query": {"rate(x[5m])"}, "start": {"2023-06-01T00:00:00Z"}, "end": {"1685577600"}, "step": {"15s"}, "timeout": {"0.5"}}
+				r := httptest.NewRequest(http.MethodPost, "/api/v1/query_range?db=d", strings.NewReader(form.Encode()))
+				r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+				return r
+			},
+			want: &greptimev1.PromqlRequest{
+				Header: &greptimev1.RequestHeader{Dbname: "d"},
+				Promql: &greptimev1.PromqlRequest_RangeQuery{RangeQuery: &greptimev1.PromRangeQuery{
+					Query: "rate(x[5m])", Start: "2023-06-01T00:00:00Z", End: "1685577600", Step: "15s",
+				}},
+			},
+			deadline: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &gateway{body: successBody}
+			h := NewAPIHandler(g, APIOptions{Now: func() time.Time { return time.UnixMilli(1500) }})
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, tt.request())
+			if w.Code != http.StatusOK || w.Body.String() != successBody {
+				t.Fatalf("response %d %s, want %d %s", w.Code, w.Body, http.StatusOK, successBody)
+			}
+			if got := w.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", got)
+			}
+			if !proto.Equal(g.req, tt.want) {
+				t.Errorf("request %v, want %v", g.req, tt.want)
+			}
+			if g.deadline != tt.deadline {
+				t.Errorf("deadline set: %v, want %v", g.deadline, tt.deadline)
+			}
+		})
+	}
+}
+
+func TestAPIHandlerErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		target  string
+		gateway *gateway
+		header  func(*http.Request) (*greptimev1.RequestHeader, error)
+		code    int
+		// errorType is the type of the error answered, empty for the
+		// bodies of the gateway.
+		errorType string
+	}{
+		{name: "method", method: http.MethodPut, target: "/api/v1/query?query=up", code: http.StatusMethodNotAllowed, errorType: "bad_data"},
+		{name: "no query", target: "/api/v1/query", code: http.StatusBadRequest, errorType: "bad_data"},
+		{name: "no step", target: "/api/v1/query_range?query=up&start=0&end=1", code: http.StatusBadRequest, errorType: "bad_data"},
+		{name: "invalid form", target: "/api/v1/query?query=%zz", code: http.StatusBadRequest, errorType: "bad_data"},
+		{name: "timeout", target: "/api/v1/query?query=up&timeout=-1", code: http.StatusBadRequest, errorType: "bad_data"},
+		{name: "huge timeout", target: "/api/v1/query?query=up&timeout=1e300", code: http.StatusBadRequest, errorType: "bad_data"},
+		{name: "infinite timeout", target: "/api/v1/query?query=up&timeout=Inf", code: http.StatusBadRequest, errorType: "bad_data"},
+		{name: "NaN timeout", target: "/api/v1/query?query=up&timeout=NaN", code: http.StatusBadRequest, errorType: "bad_data"},
+		{
+			name:   "unauthorized",
+			target: "/api/v1/query?query=up",
+			header: func(*http.Request) (*greptimev1.RequestHeader, error) {
+				return nil, errors.New("no credentials")
+			},
+			code:      http.StatusUnauthorized,
+			errorType: "unauthorized",
+		},
+		{name: "invalid argument", target: "/api/v1/query?query=up", gateway: &gateway{err: status.Error(codes.InvalidArgument, "parse error")}, code: http.StatusBadRequest, errorType: "bad_data"},
+		{name: "unauthenticated", target: "/api/v1/query?query=up", gateway: &gateway{err: status.Error(codes.Unauthenticated, "")}, code: http.StatusUnauthorized, errorType: "unauthorized"},
+		{name: "deadline", target: "/api/v1/query?query=up", gateway: &gateway{err: status.Error(codes.DeadlineExceeded, "")}, code: http.StatusServiceUnavailable, errorType: "timeout"},
+		{name: "unavailable", target: "/api/v1/query?query=up", gateway: &gateway{err: status.Error(codes.Unavailable, "")}, code: http.StatusServiceUnavailable, errorType: "unavailable"},
+		{name: "internal", target: "/api/v1/query?query=up", gateway: &gateway{err: errors.New("broken")}, code: http.StatusInternalServerError, errorType: "internal"},
+		{name: "bad data body", target: "/api/v1/query?query=up", gateway: &gateway{body: `{"status":"error","errorType":"bad_data","error":"e"}`}, code: http.StatusBadRequest},
+		{name: "execution body", target: "/api/v1/query?query=up", gateway: &gateway{body: `{"status":"error","errorType":"execution","error":"e"}`}, code: http.StatusUnprocessableEntity},
+		{name: "unknown error body", target: "/api/v1/query?query=up", gateway: &gateway{body: `{"status":"error","errorType":"other","error":"e"}`}, code: http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := tt.gateway
+			if g == nil {
+				g = &gateway{body: successBody}
+			}
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			w := httptest.NewRecorder()
+			NewAPIHandler(g, APIOptions{Header: tt.header}).ServeHTTP(w, httptest.NewRequest(method, tt.target, nil))
+			if w.Code != tt.code {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.code, w.Body)
+			}
+			if tt.errorType == "" {
+				if w.Body.String() != g.body {
+					t.Errorf("body %s, want that of the gateway %s", w.Body, g.body)
+				}
+				return
+			}
+			resp, err := ParseQueryResponse(w.Body.Bytes())
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) || apiErr.Type != tt.errorType {
+				t.Errorf("body %s, want an error of type %s", w.Body, tt.errorType)
+			}
+			if resp != nil && resp.Status != "error" {
+				t.Errorf("status %q, want error", resp.Status)
+			}
+		})
+	}
+}
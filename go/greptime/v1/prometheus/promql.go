@@ -0,0 +1,270 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	greptimev1 "github.com/GreptimeTeam/greptime-proto/go/greptime/v1"
+	"github.com/GreptimeTeam/greptime-proto/go/prometheus/remote"
+)
+
+// The types of PromQL results.
+const (
+	ResultVector = "vector"
+	ResultMatrix = "matrix"
+	ResultScalar = "scalar"
+	ResultString = "string"
+)
+
+// QueryResponse is the decoded body of a PromqlResponse, in the format of
+// the query endpoints of the Prometheus HTTP API. Only the field of
+// ResultType is set.
+type QueryResponse struct {
+	// Status is "success" or "error".
+	Status    string
+	ErrorType string
+	Error     string
+	Warnings  []string
+
+	ResultType string
+	Vector     []VectorSample
+	Matrix     []MatrixSeries
+	Scalar     *Point
+	String     *StringPoint
+}
+
+// Point is a sample of a result, its timestamp in milliseconds.
+type Point struct {
+	Timestamp int64
+	Value     float64
+}
+
+// StringPoint is a string result, its timestamp in milliseconds.
+type StringPoint struct {
+	Timestamp int64
+	Value     string
+}
+
+// VectorSample is a sample of an instant vector.
+type VectorSample struct {
+	Metric map[string]string `json:"metric"`
+	Point  Point             `json:"value"`
+}
+
+// MatrixSeries is a series of a range vector.
+type MatrixSeries struct {
+	Metric map[string]string `json:"metric"`
+	Points []Point           `json:"values"`
+}
+
+// APIError is the error of a response with the "error" status.
+type APIError struct {
+	Type    string
+	Message string
+}
+
+func (e *APIError) Error() string {
+	if e.Type == "" {
+		return e.Message
+	}
+	return e.Type + ": " + e.Message
+}
+
+// DecodePromqlResponse decodes the body of resp. See ParseQueryResponse.
+func DecodePromqlResponse(resp *greptimev1.PromqlResponse) (*QueryResponse, error) {
+	return ParseQueryResponse(resp.GetBody())
+}
+
+// ParseQueryResponse decodes a response of the Prometheus HTTP API. The
+// response of an error status is returned with an *APIError.
+func ParseQueryResponse(body []byte) (*QueryResponse, error) {
+	var raw struct {
+		Status    string   `json:"status"`
+		ErrorType string   `json:"errorType"`
+		Error     string   `json:"error"`
+		Warnings  []string `json:"warnings"`
+		Data      struct {
+			ResultType string          `json:"resultType"`
+			Result     json.RawMessage `json:"result"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, fmt.Errorf("invalid PromQL response: %w", err)
+	}
+	resp := &QueryResponse{
+		Status:     raw.Status,
+		ErrorType:  raw.ErrorType,
+		Error:      raw.Error,
+		Warnings:   raw.Warnings,
+		ResultType: raw.Data.ResultType,
+	}
+	if raw.Status == "error" {
+		return resp, &APIError{Type: raw.ErrorType, Message: raw.Error}
+	}
+	if raw.Status != "success" {
+		return nil, fmt.Errorf("invalid PromQL response status %q", raw.Status)
+	}
+
+	var result any
+	switch raw.Data.ResultType {
+	case ResultVector:
+		result = &resp.Vector
+	case ResultMatrix:
+		result = &resp.Matrix
+	case ResultScalar:
+		result = &resp.Scalar
+	case ResultString:
+		result = &resp.String
+	default:
+		return nil, fmt.Errorf("unsupported PromQL result type %q", raw.Data.ResultType)
+	}
+	if err := json.Unmarshal(raw.Data.Result, result); err != nil {
+		return nil, fmt.Errorf("invalid PromQL %s result: %w", raw.Data.ResultType, err)
+	}
+	return resp, nil
+}
+
+// UnmarshalJSON decodes a [<seconds>, "<value>"] pair.
+func (p *Point) UnmarshalJSON(b []byte) error {
+	var value string
+	t, err := unmarshalPair(b, &value)
+	if err != nil {
+		return err
+	}
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fmt.Errorf("invalid sample value %q", value)
+	}
+	p.Timestamp, p.Value = t, v
+	return nil
+}
+
+// UnmarshalJSON decodes a [<seconds>, "<value>"] pair.
+func (p *StringPoint) UnmarshalJSON(b []byte) error {
+	t, err := unmarshalPair(b, &p.Value)
+	p.Timestamp = t
+	return err
+}
+
+// unmarshalPair decodes a [<seconds>, "<value>"] pair, returning the
+// timestamp in milliseconds.
+func unmarshalPair(b []byte, value *string) (int64, error) {
+	var pair []json.RawMessage
+	if err := json.Unmarshal(b, &pair); err != nil || len(pair) != 2 {
+		return 0, fmt.Errorf("invalid sample %s", b)
+	}
+	var seconds float64
+	if err := json.Unmarshal(pair[0], &seconds); err != nil {
+		return 0, fmt.Errorf("invalid sample timestamp %s", pair[0])
+	}
+	if err := json.Unmarshal(pair[1], value); err != nil {
+		return 0, fmt.Errorf("invalid sample value %s", pair[1])
+	}
+	return int64(math.Round(seconds * 1000)), nil
+}
+
+// TimeSeries converts a matrix or vector result to remote storage series,
+// with sorted labels and a sample per point.
+func (r *QueryResponse) TimeSeries() ([]*remote.TimeSeries, error) {
+	var series []*remote.TimeSeries
+	switch r.ResultType {
+	case ResultMatrix:
+		series = make([]*remote.TimeSeries, len(r.Matrix))
+		for i, s := range r.Matrix {
+			samples := make([]*remote.Sample, len(s.Points))
+			for j, p := range s.Points {
+				samples[j] = &remote.Sample{Timestamp: p.Timestamp, Value: p.Value}
+			}
+			series[i] = &remote.TimeSeries{Labels: labelsOf(s.Metric), Samples: samples}
+		}
+	case ResultVector:
+		series = make([]*remote.TimeSeries, len(r.Vector))
+		for i, s := range r.Vector {
+			series[i] = &remote.TimeSeries{
+				Labels:  labelsOf(s.Metric),
+				Samples: []*remote.Sample{{Timestamp: s.Point.Timestamp, Value: s.Point.Value}},
+			}
+		}
+	default:
+		return nil, fmt.Errorf("cannot convert a PromQL %s result to series", r.ResultType)
+	}
+	return series, nil
+}
+
+// labelsOf returns the labels of a metric, sorted by name.
+func labelsOf(metric map[string]string) []*remote.Label {
+	labels := make([]*remote.Label, 0, len(metric))
+	for name, value := range metric {
+		labels = append(labels, &remote.Label{Name: name, Value: value})
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+	return labels
+}
+
+// StitchResponses joins the matrix results of consecutive range queries,
+// like those of greptimev1.SplitPromRangeQuery, in a single one. The points
+// of a series are appended in order, those not after the last one being
+// dropped, and warnings are deduplicated. Series keep the order they first
+// appear in.
+func StitchResponses(resps ...*QueryResponse) (*QueryResponse, error) {
+	stitched := &QueryResponse{Status: "success", ResultType: ResultMatrix}
+	byKey := make(map[string]int)
+	warnings := make(map[string]bool)
+	for _, resp := range resps {
+		if resp.ResultType != ResultMatrix {
+			return nil, fmt.Errorf("cannot stitch a PromQL %s result", resp.ResultType)
+		}
+		for _, w := range resp.Warnings {
+			if !warnings[w] {
+				warnings[w] = true
+				stitched.Warnings = append(stitched.Warnings, w)
+			}
+		}
+		for _, s := range resp.Matrix {
+			key := metricKey(s.Metric)
+			i, ok := byKey[key]
+			if !ok {
+				byKey[key] = len(stitched.Matrix)
+				stitched.Matrix = append(stitched.Matrix, MatrixSeries{Metric: s.Metric, Points: append([]Point(nil), s.Points...)})
+				continue
+			}
+			series := &stitched.Matrix[i]
+			for _, p := range s.Points {
+				if n := len(series.Points); n == 0 || p.Timestamp > series.Points[n-1].Timestamp {
+					series.Points = append(series.Points, p)
+				}
+			}
+		}
+	}
+	return stitched, nil
+}
+
+// metricKey identifies the label set of a metric.
+func metricKey(metric map[string]string) string {
+	var key strings.Builder
+	for _, label := range labelsOf(metric) {
+		key.WriteString(label.Name)
+		key.WriteByte(0xff)
+		key.WriteString(label.Value)
+		key.WriteByte(0xff)
+	}
+	return key.String()
+}
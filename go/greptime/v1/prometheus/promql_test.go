@@ -0,0 +1,211 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/GreptimeTeam/greptime-proto/go/prometheus/remote"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestParseQueryResponse(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want *QueryResponse
+	}{
+		{
+			name: "vector",
+			body: `{"status":"success","data":{"resultType":"vector","result":[{"metric":{"__name__":"up","job":"a"},"value":[1435781451.781,"1"]}]}}`,
+			want: &QueryResponse{
+				Status:     "success",
+				ResultType: ResultVector,
+				Vector:     []VectorSample{{Metric: map[string]string{"__name__": "up", "job": "a"}, Point: Point{1435781451781, 1}}},
+			},
+		},
+		{
+			name: "matrix",
+			body: `{"status":"success","warnings":["w"],"data":{"resultType":"matrix","result":[{"metric":{"job":"a"},"values":[[-1.5,"+Inf"],[0,"-2.5e3"]]}]}}`,
+			want: &QueryResponse{
+				Status:     "success",
+				Warnings:   []string{"w"},
+				ResultType: ResultMatrix,
+				Matrix:     []MatrixSeries{{Metric: map[string]string{"job": "a"}, Points: []Point{{-1500, math.Inf(1)}, {0, -2500}}}},
+			},
+		},
+		{
+			name: "empty matrix",
+			body: `{"status":"success","data":{"resultType":"matrix","result":[]}}`,
+			want: &QueryResponse{Status: "success", ResultType: ResultMatrix, Matrix: []MatrixSeries{}},
+		},
+		{
+			name: "scalar",
+			body: `{"status":"success","data":{"resultType":"scalar","result":[1.001,"3"]}}`,
+			want: &QueryResponse{Status: "success", ResultType: ResultScalar, Scalar: &Point{1001, 3}},
+		},
+		{
+			name: "string",
+			body: `{"status":"success","data":{"resultType":"string","result":[2,"s"]}}`,
+			want: &QueryResponse{Status: "success", ResultType: ResultString, String: &StringPoint{2000, "s"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseQueryResponse([]byte(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseQueryResponse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	got, err := ParseQueryResponse([]byte(`{"status":"success","data":{"resultType":"scalar","result":[0,"NaN"]}}`))
+	if err != nil || !math.IsNaN(got.Scalar.Value) {
+		t.Errorf("ParseQueryResponse() of NaN = %+v, %v", got.Scalar, err)
+	}
+}
+
+func TestParseQueryResponseErrors(t *testing.T) {
+	body := `{"status":"error","errorType":"bad_data","error":"parse error"}`
+	resp, err := ParseQueryResponse([]byte(body))
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Type != "bad_data" || apiErr.Message != "parse error" {
+		t.Errorf("ParseQueryResponse(%s) error = %v, want an APIError", body, err)
+	}
+	if resp == nil || resp.Status != "error" || resp.ErrorType != "bad_data" {
+		t.Errorf("ParseQueryResponse(%s) = %+v, want the error response", body, resp)
+	}
+
+	for _, body := range []string{
+		``,
+		`{"status":"pending"}`,
+		`{"status":"success","data":{"resultType":"streams","result":[]}}`,
+		`{"status":"success","data":{"resultType":"scalar","result":[1,"x"]}}`,
+		`{"status":"success","data":{"resultType":"scalar","result":[1,2]}}`,
+		`{"status":"success","data":{"resultType":"scalar","result":["1","2"]}}`,
+		`{"status":"success","data":{"resultType":"scalar","result":[1]}}`,
+		`{"status":"success","data":{"resultType":"vector","result":{}}}`,
+	} {
+		if got, err := ParseQueryResponse([]byte(body)); err == nil {
+			t.Errorf("ParseQueryResponse(%s) = %+v, want an error", body, got)
+		}
+	}
+}
+
+func TestQueryResponseTimeSeries(t *testing.T) {
+	metric := map[string]string{"job": "a", "__name__": "up", "instance": "i"}
+	sorted := labels("__name__", "up", "instance", "i", "job", "a")
+	tests := []struct {
+		name string
+		resp *QueryResponse
+		want []*remote.TimeSeries
+	}{
+		{
+			name: "matrix",
+			resp: &QueryResponse{ResultType: ResultMatrix, Matrix: []MatrixSeries{
+				{Metric: metric, Points: []Point{{1, 1}, {2, 2}}},
+				{Metric: map[string]string{}, Points: []Point{}},
+			}},
+			want: []*remote.TimeSeries{
+				{Labels: sorted, Samples: []*remote.Sample{{Timestamp: 1, Value: 1}, {Timestamp: 2, Value: 2}}},
+				{},
+			},
+		},
+		{
+			name: "vector",
+			resp: &QueryResponse{ResultType: ResultVector, Vector: []VectorSample{{Metric: metric, Point: Point{3, 0.5}}}},
+			want: []*remote.TimeSeries{{Labels: sorted, Samples: []*remote.Sample{{Timestamp: 3, Value: 0.5}}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.resp.TimeSeries()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("%d series, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if !proto.Equal(got[i], tt.want[i]) {
+					t.Errorf("series %d = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+	if got, err := (&QueryResponse{ResultType: ResultScalar, Scalar: &Point{}}).TimeSeries(); err == nil {
+		t.Errorf("TimeSeries() of a scalar = %v, want an error", got)
+	}
+}
+
+func TestStitchResponses(t *testing.T) {
+	a, b := map[string]string{"job": "a"}, map[string]string{"job": "b"}
+	resps := []*QueryResponse{
+		{
+			Status:     "success",
+			Warnings:   []string{"w1"},
+			ResultType: ResultMatrix,
+			Matrix:     []MatrixSeries{{Metric: a, Points: []Point{{0, 0}, {10, 1}}}},
+		},
+		{
+			Status:     "success",
+			Warnings:   []string{"w1", "w2"},
+			ResultType: ResultMatrix,
+			Matrix: []MatrixSeries{
+				// The split ranges share their bounds.
+				{Metric: b, Points: []Point{{10, 5}, {20, 6}}},
+				{Metric: map[string]string{"job": "a"}, Points: []Point{{10, 1}, {20, 2}}},
+			},
+		},
+		{Status: "success", ResultType: ResultMatrix},
+		{
+			Status:     "success",
+			ResultType: ResultMatrix,
+			Matrix:     []MatrixSeries{{Metric: a, Points: []Point{{30, 3}}}},
+		},
+	}
+	got, err := StitchResponses(resps...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &QueryResponse{
+		Status:     "success",
+		Warnings:   []string{"w1", "w2"},
+		ResultType: ResultMatrix,
+		Matrix: []MatrixSeries{
+			{Metric: a, Points: []Point{{0, 0}, {10, 1}, {20, 2}, {30, 3}}},
+			{Metric: b, Points: []Point{{10, 5}, {20, 6}}},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("StitchResponses() = %+v, want %+v", got, want)
+	}
+	if len(resps[0].Matrix[0].Points) != 2 {
+		t.Errorf("StitchResponses appended to the points of a response: %v", resps[0].Matrix[0].Points)
+	}
+
+	if got, err := StitchResponses(resps[0], &QueryResponse{ResultType: ResultVector}); err == nil {
+		t.Errorf("StitchResponses() of a vector = %+v, want an error", got)
+	}
+	if got, err := StitchResponses(); err != nil || len(got.Matrix) != 0 {
+		t.Errorf("StitchResponses() = %+v, %v, want an empty matrix", got, err)
+	}
+}
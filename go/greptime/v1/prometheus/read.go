@@ -0,0 +1,331 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	greptimev1 "github.com/GreptimeTeam/greptime-proto/go/greptime/v1"
+	"github.com/GreptimeTeam/greptime-proto/go/prometheus/remote"
+)
+
+// Matcher is a compiled LabelMatcher. A missing label matches like an
+// empty one, and regular expressions match whole values, as in Prometheus.
+type Matcher struct {
+	Type  remote.LabelMatcher_Type
+	Name  string
+	Value string
+	re    *regexp.Regexp
+}
+
+// NewMatcher compiles m. Invalid regular expressions and types fail with
+// an error wrapping remote.ErrInvalidRequest.
+func NewMatcher(m *remote.LabelMatcher) (*Matcher, error) {
+	matcher := &Matcher{Type: m.GetType(), Name: m.GetName(), Value: m.GetValue()}
+	switch matcher.Type {
+	case remote.LabelMatcher_EQ, remote.LabelMatcher_NEQ:
+	case remote.LabelMatcher_RE, remote.LabelMatcher_NRE:
+		re, err := regexp.Compile("^(?s:" + matcher.Value + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("%w: matcher %s: %v", remote.ErrInvalidRequest, matcher, err)
+		}
+		matcher.re = re
+	default:
+		return nil, fmt.Errorf("%w: unknown matcher type %d", remote.ErrInvalidRequest, matcher.Type)
+	}
+	return matcher, nil
+}
+
+// Matches reports whether a label value, empty if the label is missing,
+// matches.
+func (m *Matcher) Matches(value string) bool {
+	switch m.Type {
+	case remote.LabelMatcher_EQ:
+		return value == m.Value
+	case remote.LabelMatcher_NEQ:
+		return value != m.Value
+	case remote.LabelMatcher_RE:
+		return m.re.MatchString(value)
+	case remote.LabelMatcher_NRE:
+		return !m.re.MatchString(value)
+	}
+	return false
+}
+
+func (m *Matcher) String() string {
+	op := map[remote.LabelMatcher_Type]string{
+		remote.LabelMatcher_EQ:  "=",
+		remote.LabelMatcher_NEQ: "!=",
+		remote.LabelMatcher_RE:  "=~",
+		remote.LabelMatcher_NRE: "!~",
+	}[m.Type]
+	return fmt.Sprintf("%s%s%q", m.Name, op, m.Value)
+}
+
+// Source is the columnar storage a Reader answers from, holding a table
+// per metric shaped like the InsertRequests of ToInsertRequests: a STRING
+// tag per label, a time index and a ValueColumn.
+type Source interface {
+	// Metrics returns the names of the tables of metrics. It is called for
+	// the queries not selecting a metric name by equality.
+	Metrics(ctx context.Context) ([]string, error)
+	// Scan returns the rows of the table of metric, at least those in the
+	// time range of query and matching its matchers, nothing if there is
+	// no such table. The Reader filters the rows itself, so sources may
+	// ignore the query.
+	Scan(ctx context.Context, metric string, query *remote.Query) ([]*greptimev1.InsertRequest, error)
+}
+
+// Reader answers remote read queries from a Source. It is a remote.Reader,
+// to serve with remote.NewReadHandler, which streams its results as XOR
+// chunks to the clients accepting them.
+type Reader struct {
+	source Source
+}
+
+// NewReader returns a reader of source.
+func NewReader(source Source) *Reader {
+	return &Reader{source: source}
+}
+
+// Read returns the series matching query with their samples in the query
+// range, narrowed to the range of its hints if set. Series are sorted by
+// labels, and samples by timestamp.
+func (r *Reader) Read(ctx context.Context, query *remote.Query) (*remote.QueryResult, error) {
+	matchers := make([]*Matcher, len(query.GetMatchers()))
+	for i, m := range query.GetMatchers() {
+		matcher, err := NewMatcher(m)
+		if err != nil {
+			return nil, err
+		}
+		matchers[i] = matcher
+	}
+	start, end := query.GetStartTimestampMs(), query.GetEndTimestampMs()
+	if hints := query.GetHints(); hints != nil {
+		if hints.GetStartMs() > start {
+			start = hints.GetStartMs()
+		}
+		if hints.GetEndMs() > 0 && hints.GetEndMs() < end {
+			end = hints.GetEndMs()
+		}
+	}
+
+	metrics, err := r.metrics(ctx, matchers)
+	if err != nil {
+		return nil, err
+	}
+	result := &remote.QueryResult{}
+	for _, metric := range metrics {
+		inserts, err := r.source.Scan(ctx, metric, query)
+		if err != nil {
+			return nil, err
+		}
+		s := &seriesSet{byKey: make(map[string]*remote.TimeSeries)}
+		for _, insert := range inserts {
+			if err := s.add(metric, insert, matchers, start, end); err != nil {
+				return nil, fmt.Errorf("table %q: %w", metric, err)
+			}
+		}
+		s.sort()
+		result.Timeseries = append(result.Timeseries, s.series...)
+	}
+	sort.Slice(result.Timeseries, func(i, j int) bool {
+		return remote.CompareLabels(result.Timeseries[i].Labels, result.Timeseries[j].Labels) < 0
+	})
+	return result, nil
+}
+
+// metrics returns the metrics whose name matches the name matchers.
+func (r *Reader) metrics(ctx context.Context, matchers []*Matcher) ([]string, error) {
+	var metrics []string
+	for _, m := range matchers {
+		if m.Name == MetricNameLabel && m.Type == remote.LabelMatcher_EQ {
+			metrics = []string{m.Value}
+			break
+		}
+	}
+	if metrics == nil {
+		var err error
+		if metrics, err = r.source.Metrics(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	var matching []string
+	for _, metric := range metrics {
+		ok := true
+		for _, m := range matchers {
+			if m.Name == MetricNameLabel && !m.Matches(metric) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			matching = append(matching, metric)
+		}
+	}
+	return matching, nil
+}
+
+// seriesSet groups the rows of a metric by label set.
+type seriesSet struct {
+	byKey  map[string]*remote.TimeSeries
+	series []*remote.TimeSeries
+}
+
+// labelColumn is a source of the labels of rows, the tag column of the
+// label or, for the metric name, nil.
+type labelColumn struct {
+	name   string
+	reader *greptimev1.ColumnReader
+}
+
+// add adds the rows of insert matching matchers with timestamps in [start,
+// end]. Rows with a null timestamp or value are skipped, and labels with a
+// null or empty value left out.
+func (s *seriesSet) add(metric string, insert *greptimev1.InsertRequest, matchers []*Matcher, start, end int64) error {
+	rows := int(insert.GetRowCount())
+	labelColumns := []labelColumn{{name: MetricNameLabel}}
+	var timestamps, values *greptimev1.ColumnReader
+	for _, column := range insert.GetColumns() {
+		semantic, name := column.GetSemanticType(), column.GetColumnName()
+		if semantic != greptimev1.Column_TAG && semantic != greptimev1.Column_TIMESTAMP && name != ValueColumn {
+			continue
+		}
+		r, err := greptimev1.NewColumnReader(column, rows)
+		if err != nil {
+			return err
+		}
+		switch {
+		case semantic == greptimev1.Column_TAG:
+			labelColumns = append(labelColumns, labelColumn{name: name, reader: r})
+		case semantic == greptimev1.Column_TIMESTAMP:
+			timestamps = r
+		default:
+			values = r
+		}
+	}
+	if timestamps == nil || values == nil {
+		return fmt.Errorf("no time index or %s column", ValueColumn)
+	}
+	// Label sets are sorted by name.
+	sort.Slice(labelColumns, func(i, j int) bool { return labelColumns[i].name < labelColumns[j].name })
+
+	labels := make([]*remote.Label, 0, len(labelColumns))
+	var key strings.Builder
+	for row := 0; row < rows; row++ {
+		timestamps.Next()
+		values.Next()
+		labels = labels[:0]
+		for _, c := range labelColumns {
+			if c.reader == nil {
+				labels = append(labels, &remote.Label{Name: c.name, Value: metric})
+				continue
+			}
+			c.reader.Next()
+			// Like nulls, empty values are missing labels in Prometheus.
+			if v := c.reader.Value(); v != nil {
+				if value := fmt.Sprint(v); value != "" {
+					labels = append(labels, &remote.Label{Name: c.name, Value: value})
+				}
+			}
+		}
+		ts, ok := timestamps.Value().(time.Time)
+		if !ok {
+			continue
+		}
+		t := ts.UnixMilli()
+		if t < start || t > end {
+			continue
+		}
+		v, ok := sampleValue(values.Value())
+		if !ok || !matches(labels, matchers) {
+			continue
+		}
+
+		key.Reset()
+		for _, label := range labels {
+			key.WriteString(label.Name)
+			key.WriteByte(0xff)
+			key.WriteString(label.Value)
+			key.WriteByte(0xff)
+		}
+		series := s.byKey[key.String()]
+		if series == nil {
+			series = &remote.TimeSeries{Labels: append([]*remote.Label(nil), labels...)}
+			s.byKey[key.String()] = series
+			s.series = append(s.series, series)
+		}
+		series.Samples = append(series.Samples, &remote.Sample{Timestamp: t, Value: v})
+	}
+	return nil
+}
+
+// sort sorts the samples of every series by timestamp.
+func (s *seriesSet) sort() {
+	for _, series := range s.series {
+		samples := series.Samples
+		sort.SliceStable(samples, func(i, j int) bool { return samples[i].Timestamp < samples[j].Timestamp })
+	}
+}
+
+// sampleValue converts the value of a numeric column to a sample value.
+func sampleValue(v any) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// matches reports whether the label set matches every matcher.
+func matches(labels []*remote.Label, matchers []*Matcher) bool {
+	for _, m := range matchers {
+		value := ""
+		for _, label := range labels {
+			if label.Name == m.Name {
+				value = label.Value
+				break
+			}
+		}
+		if !m.Matches(value) {
+			return false
+		}
+	}
+	return true
+}
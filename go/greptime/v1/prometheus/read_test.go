@@ -0,0 +1,209 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	greptimev1 "github.com/GreptimeTeam/greptime-proto/go/greptime/v1"
+	"github.com/GreptimeTeam/greptime-proto/go/prometheus/remote"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestMatcher(t *testing.T) {
+	tests := []struct {
+		typ   remote.LabelMatcher_Type
+		value string
+		in    []string
+		out   []string
+	}{
+		{remote.LabelMatcher_EQ, "a", []string{"a"}, []string{"", "ab"}},
+		{remote.LabelMatcher_EQ, "", []string{""}, []string{"a"}},
+		{remote.LabelMatcher_NEQ, "a", []string{"", "ab"}, []string{"a"}},
+		{remote.LabelMatcher_RE, "a", []string{"a"}, []string{"", "ab", "ba"}},
+		{remote.LabelMatcher_RE, "a|b", []string{"a", "b"}, []string{"ab", "ba"}},
+		{remote.LabelMatcher_RE, "a.*", []string{"a", "ab"}, []string{"", "ba"}},
+		{remote.LabelMatcher_RE, ".*", []string{"", "a"}, nil},
+		// . matches newlines, as in Prometheus.
+		{remote.LabelMatcher_RE, "a.b", []string{"a\nb"}, []string{"ab"}},
+		{remote.LabelMatcher_RE, ".+", []string{"\n"}, []string{""}},
+		{remote.LabelMatcher_NRE, "a|b", []string{"", "ab"}, []string{"a", "b"}},
+		{remote.LabelMatcher_NRE, ".+", []string{""}, []string{"a"}},
+	}
+	for _, tt := range tests {
+		m, err := NewMatcher(&remote.LabelMatcher{Type: tt.typ, Name: "l", Value: tt.value})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range tt.in {
+			if !m.Matches(v) {
+				t.Errorf("%s does not match %q", m, v)
+			}
+		}
+		for _, v := range tt.out {
+			if m.Matches(v) {
+				t.Errorf("%s matches %q", m, v)
+			}
+		}
+	}
+	for _, lm := range []*remote.LabelMatcher{
+		{Type: remote.LabelMatcher_RE, Name: "l", Value: "("},
+		{Type: 7, Name: "l"},
+	} {
+		if _, err := NewMatcher(lm); !errors.Is(err, remote.ErrInvalidRequest) {
+			t.Errorf("NewMatcher(%v) error = %v, want ErrInvalidRequest", lm, err)
+		}
+	}
+}
+
+// tableSource serves the tables of inserts, counting the Metrics calls.
+type tableSource struct {
+	tables map[string][]*greptimev1.InsertRequest
+	listed int
+}
+
+func (s *tableSource) Metrics(context.Context) ([]string, error) {
+	s.listed++
+	metrics := make([]string, 0, len(s.tables))
+	for metric := range s.tables {
+		metrics = append(metrics, metric)
+	}
+	return metrics, nil
+}
+
+func (s *tableSource) Scan(_ context.Context, metric string, _ *remote.Query) ([]*greptimev1.InsertRequest, error) {
+	return s.tables[metric], nil
+}
+
+// newTableSource returns a source of the tables series are written to.
+func newTableSource(t *testing.T, series ...*remote.TimeSeries) *tableSource {
+	t.Helper()
+	inserts, err := ToInsertRequests(&remote.WriteRequest{Timeseries: series}, WriteOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &tableSource{tables: make(map[string][]*greptimev1.InsertRequest)}
+	for _, insert := range inserts.GetInserts() {
+		s.tables[insert.TableName] = append(s.tables[insert.TableName], insert)
+	}
+	return s
+}
+
+func samples(timestampValues ...float64) []*remote.Sample {
+	s := make([]*remote.Sample, 0, len(timestampValues)/2)
+	for i := 0; i < len(timestampValues); i += 2 {
+		s = append(s, &remote.Sample{Timestamp: int64(timestampValues[i]), Value: timestampValues[i+1]})
+	}
+	return s
+}
+
+func TestReaderRead(t *testing.T) {
+	source := newTableSource(t,
+		&remote.TimeSeries{Labels: labels("__name__", "up", "job", "a", "instance", "x"), Samples: samples(1, 1, 2, 2, 3, 3)},
+		&remote.TimeSeries{Labels: labels("__name__", "up", "job", "b"), Samples: samples(3, 30, 1, 10)},
+		&remote.TimeSeries{Labels: labels("__name__", "up", "job", "c", "instance", ""), Samples: samples(2, 20)},
+		&remote.TimeSeries{Labels: labels("__name__", "cpu", "job", "a"), Samples: samples(2, 0.5)},
+	)
+	upA := &remote.TimeSeries{Labels: labels("__name__", "up", "instance", "x", "job", "a"), Samples: samples(1, 1, 2, 2, 3, 3)}
+	upB := &remote.TimeSeries{Labels: labels("__name__", "up", "job", "b"), Samples: samples(1, 10, 3, 30)}
+	upC := &remote.TimeSeries{Labels: labels("__name__", "up", "job", "c"), Samples: samples(2, 20)}
+	cpu := &remote.TimeSeries{Labels: labels("__name__", "cpu", "job", "a"), Samples: samples(2, 0.5)}
+
+	matcher := func(typ remote.LabelMatcher_Type, name, value string) *remote.LabelMatcher {
+		return &remote.LabelMatcher{Type: typ, Name: name, Value: value}
+	}
+	upMatcher := matcher(remote.LabelMatcher_EQ, MetricNameLabel, "up")
+	tests := []struct {
+		name  string
+		query *remote.Query
+		want  []*remote.TimeSeries
+		// listed is whether the query lists the metrics.
+		listed bool
+	}{
+		{
+			name:  "metric",
+			query: &remote.Query{StartTimestampMs: 0, EndTimestampMs: 10, Matchers: []*remote.LabelMatcher{upMatcher}},
+			want:  []*remote.TimeSeries{upA, upB, upC},
+		},
+		{
+			name:  "range",
+			query: &remote.Query{StartTimestampMs: 2, EndTimestampMs: 2, Matchers: []*remote.LabelMatcher{upMatcher}},
+			want: []*remote.TimeSeries{
+				{Labels: upA.Labels, Samples: samples(2, 2)},
+				{Labels: upC.Labels, Samples: samples(2, 20)},
+			},
+		},
+		{
+			name: "hints",
+			query: &remote.Query{
+				StartTimestampMs: 0, EndTimestampMs: 10,
+				Matchers: []*remote.LabelMatcher{upMatcher},
+				Hints:    &remote.ReadHints{StartMs: 3, EndMs: 5},
+			},
+			want: []*remote.TimeSeries{
+				{Labels: upA.Labels, Samples: samples(3, 3)},
+				{Labels: upB.Labels, Samples: samples(3, 30)},
+			},
+		},
+		{
+			name:  "missing and empty labels",
+			query: &remote.Query{EndTimestampMs: 10, Matchers: []*remote.LabelMatcher{upMatcher, matcher(remote.LabelMatcher_EQ, "instance", "")}},
+			want:  []*remote.TimeSeries{upB, upC},
+		},
+		{
+			name:   "all metrics",
+			query:  &remote.Query{EndTimestampMs: 10, Matchers: []*remote.LabelMatcher{matcher(remote.LabelMatcher_RE, "job", "a")}},
+			want:   []*remote.TimeSeries{cpu, upA},
+			listed: true,
+		},
+		{
+			name:   "metric regexp",
+			query:  &remote.Query{EndTimestampMs: 10, Matchers: []*remote.LabelMatcher{matcher(remote.LabelMatcher_RE, MetricNameLabel, "c.*")}},
+			want:   []*remote.TimeSeries{cpu},
+			listed: true,
+		},
+		{
+			name:  "negative regexp",
+			query: &remote.Query{EndTimestampMs: 10, Matchers: []*remote.LabelMatcher{upMatcher, matcher(remote.LabelMatcher_NRE, "job", "a|b")}},
+			want:  []*remote.TimeSeries{upC},
+		},
+		{
+			name:  "unknown metric",
+			query: &remote.Query{EndTimestampMs: 10, Matchers: []*remote.LabelMatcher{matcher(remote.LabelMatcher_EQ, MetricNameLabel, "down")}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source.listed = 0
+			got, err := NewReader(source).Read(context.Background(), tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := (&remote.QueryResult{Timeseries: tt.want}); !proto.Equal(got, want) {
+				t.Errorf("Read() = %v, want %v", got, want)
+			}
+			if listed := source.listed > 0; listed != tt.listed {
+				t.Errorf("listed metrics: %v, want %v", listed, tt.listed)
+			}
+		})
+	}
+
+	query := &remote.Query{Matchers: []*remote.LabelMatcher{matcher(remote.LabelMatcher_RE, "job", "(")}}
+	if _, err := NewReader(source).Read(context.Background(), query); !errors.Is(err, remote.ErrInvalidRequest) {
+		t.Errorf("Read() with an invalid regexp: %v, want ErrInvalidRequest", err)
+	}
+}
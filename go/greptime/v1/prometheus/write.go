@@ -0,0 +1,309 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package prometheus converts between Prometheus remote storage messages
+// and GreptimeDB requests. Like GreptimeDB, it stores every metric in its
+// own table, named after the metric, with a TAG column per label, the
+// sample timestamps in TimestampColumn and the sample values in
+// ValueColumn.
+package prometheus
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	greptimev1 "github.com/GreptimeTeam/greptime-proto/go/greptime/v1"
+	"github.com/GreptimeTeam/greptime-proto/go/prometheus/remote"
+)
+
+const (
+	// MetricNameLabel is the label holding the name of a metric.
+	MetricNameLabel = "__name__"
+	// TimestampColumn is the TIMESTAMP_MILLISECOND time index of the
+	// tables of metrics.
+	TimestampColumn = "greptime_timestamp"
+	// ValueColumn is the FLOAT64 field of the tables of metrics.
+	ValueColumn = "greptime_value"
+)
+
+// The columns of the metadata table.
+const (
+	MetadataFamilyColumn = "metric_family_name"
+	MetadataTypeColumn   = "type"
+	MetadataHelpColumn   = "help"
+	MetadataUnitColumn   = "unit"
+)
+
+// WriteOptions configures ToInsertRequests. The zero value drops exemplars
+// and metadata.
+type WriteOptions struct {
+	// ExemplarSuffix, if set, writes the exemplars of a metric to the table
+	// named after the metric with the suffix, like "_exemplars". Exemplars
+	// are stored like samples, their labels becoming STRING fields.
+	ExemplarSuffix string
+	// MetadataTable, if set, writes the metadata of metric families to that
+	// table, one row per family: MetadataFamilyColumn as tag,
+	// MetadataTypeColumn, MetadataHelpColumn and MetadataUnitColumn as
+	// STRING fields, and the write time as TimestampColumn.
+	MetadataTable string
+	// Now returns the write time, time.Now if nil.
+	Now func() time.Time
+}
+
+// stringColumn is a STRING column being built, with nulls for the rows
+// before it was first set and the rows it was skipped for.
+type stringColumn struct {
+	semantic greptimev1.Column_SemanticType
+	values   []string
+	nulls    greptimev1.Bitmap
+	rows     int
+}
+
+// fill appends n times value from row on, after nulls for the rows since
+// the last fill.
+func (c *stringColumn) fill(row int, value string, n int) {
+	for ; c.rows < row; c.rows++ {
+		c.nulls.Set(c.rows)
+	}
+	for i := 0; i < n; i++ {
+		c.values = append(c.values, value)
+	}
+	c.rows += n
+}
+
+// tableBuilder accumulates the rows of a table column by column.
+type tableBuilder struct {
+	name string
+	// rows is the expected number of rows, zero if unknown.
+	rows       int
+	columns    map[string]*stringColumn
+	timestamps []int64
+	values     []float64
+}
+
+// addLabels sets labels on the n rows that will be appended next. The
+// metric name is skipped.
+func (t *tableBuilder) addLabels(labels []*remote.Label, semantic greptimev1.Column_SemanticType, n int) error {
+	row := len(t.timestamps)
+	for _, label := range labels {
+		name := label.GetName()
+		switch name {
+		case MetricNameLabel:
+			continue
+		case "", TimestampColumn, ValueColumn:
+			return fmt.Errorf("metric %q: invalid label name %q", t.name, name)
+		}
+		c := t.columns[name]
+		if c == nil {
+			size := t.rows - row
+			if size < 0 {
+				size = 0
+			}
+			c = &stringColumn{semantic: semantic, values: make([]string, 0, size)}
+			t.columns[name] = c
+		}
+		if c.rows > row {
+			return fmt.Errorf("metric %q: duplicate label %q", t.name, name)
+		}
+		if c.semantic != semantic {
+			return fmt.Errorf("metric %q: label %q of both series and exemplars", t.name, name)
+		}
+		c.fill(row, label.GetValue(), n)
+	}
+	return nil
+}
+
+func (t *tableBuilder) build() *greptimev1.InsertRequest {
+	rows := len(t.timestamps)
+	names := make([]string, 0, len(t.columns))
+	for name := range t.columns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	columns := make([]*greptimev1.Column, 0, len(names)+2)
+	for _, name := range names {
+		c := t.columns[name]
+		c.fill(rows, "", 0)
+		column := &greptimev1.Column{
+			ColumnName:   name,
+			SemanticType: c.semantic,
+			Datatype:     greptimev1.ColumnDataType_STRING,
+			Values:       &greptimev1.Column_Values{StringValues: c.values},
+		}
+		if n := c.nulls.Len(); n > 0 {
+			if n < rows {
+				// Grow the mask to the rows, the last one not being null.
+				c.nulls.Clear(rows - 1)
+			}
+			column.NullMask = c.nulls.Bytes()
+		}
+		columns = append(columns, column)
+	}
+	columns = append(columns,
+		&greptimev1.Column{
+			ColumnName:   TimestampColumn,
+			SemanticType: greptimev1.Column_TIMESTAMP,
+			Datatype:     greptimev1.ColumnDataType_TIMESTAMP_MILLISECOND,
+			Values:       &greptimev1.Column_Values{TsMillisecondValues: t.timestamps},
+		},
+		&greptimev1.Column{
+			ColumnName:   ValueColumn,
+			SemanticType: greptimev1.Column_FIELD,
+			Datatype:     greptimev1.ColumnDataType_FLOAT64,
+			Values:       &greptimev1.Column_Values{F64Values: t.values},
+		},
+	)
+	return &greptimev1.InsertRequest{TableName: t.name, Columns: columns, RowCount: uint32(rows)}
+}
+
+// tables are the tables being built, in the order of their first rows.
+type tables struct {
+	byName map[string]*tableBuilder
+	order  []*tableBuilder
+}
+
+func (ts *tables) table(name string) *tableBuilder {
+	t := ts.byName[name]
+	if t == nil {
+		t = &tableBuilder{name: name, columns: make(map[string]*stringColumn)}
+		ts.byName[name] = t
+		ts.order = append(ts.order, t)
+	}
+	return t
+}
+
+// MetricName returns the value of the MetricNameLabel of labels, empty if
+// it is missing.
+func MetricName(labels []*remote.Label) string {
+	for _, label := range labels {
+		if label.GetName() == MetricNameLabel {
+			return label.GetValue()
+		}
+	}
+	return ""
+}
+
+// ToInsertRequests converts a remote write request to one InsertRequest
+// per metric, the series of a metric becoming the rows of its table. Label
+// columns are filled with nulls for the series lacking the label, and
+// sorted by name before TimestampColumn and ValueColumn.
+//
+// It fails for series without metric name, and for labels named like
+// TimestampColumn or ValueColumn or repeated within a series.
+func ToInsertRequests(req *remote.WriteRequest, opts WriteOptions) (*greptimev1.InsertRequests, error) {
+	// Size the tables first, so that large writes don't spend their time
+	// growing the columns.
+	ts := &tables{byName: make(map[string]*tableBuilder)}
+	names := make([]string, len(req.GetTimeseries()))
+	for i, series := range req.GetTimeseries() {
+		names[i] = MetricName(series.GetLabels())
+		if names[i] == "" {
+			return nil, fmt.Errorf("series %v has no metric name", series.GetLabels())
+		}
+		if n := len(series.GetSamples()); n > 0 {
+			ts.table(names[i]).rows += n
+		}
+	}
+	for _, t := range ts.order {
+		t.timestamps = make([]int64, 0, t.rows)
+		t.values = make([]float64, 0, t.rows)
+	}
+
+	for i, series := range req.GetTimeseries() {
+		name := names[i]
+		if samples := series.GetSamples(); len(samples) > 0 {
+			t := ts.table(name)
+			if err := t.addLabels(series.GetLabels(), greptimev1.Column_TAG, len(samples)); err != nil {
+				return nil, err
+			}
+			for _, sample := range samples {
+				t.timestamps = append(t.timestamps, sample.GetTimestamp())
+				t.values = append(t.values, sample.GetValue())
+			}
+		}
+		if opts.ExemplarSuffix == "" {
+			continue
+		}
+		for _, exemplar := range series.GetExemplars() {
+			t := ts.table(name + opts.ExemplarSuffix)
+			if err := t.addLabels(series.GetLabels(), greptimev1.Column_TAG, 1); err != nil {
+				return nil, err
+			}
+			if err := t.addLabels(exemplar.GetLabels(), greptimev1.Column_FIELD, 1); err != nil {
+				return nil, err
+			}
+			t.timestamps = append(t.timestamps, exemplar.GetTimestamp())
+			t.values = append(t.values, exemplar.GetValue())
+		}
+	}
+
+	inserts := make([]*greptimev1.InsertRequest, 0, len(ts.order)+1)
+	for _, t := range ts.order {
+		inserts = append(inserts, t.build())
+	}
+	if opts.MetadataTable != "" && len(req.GetMetadata()) > 0 {
+		inserts = append(inserts, metadataInsert(req.GetMetadata(), opts))
+	}
+	return &greptimev1.InsertRequests{Inserts: inserts}, nil
+}
+
+// metadataInsert returns the rows of the metadata table.
+func metadataInsert(metadata []*remote.MetricMetadata, opts WriteOptions) *greptimev1.InsertRequest {
+	now := time.Now
+	if opts.Now != nil {
+		now = opts.Now
+	}
+	ts := now().UnixMilli()
+	n := len(metadata)
+	families := make([]string, n)
+	types := make([]string, n)
+	helps := make([]string, n)
+	units := make([]string, n)
+	timestamps := make([]int64, n)
+	for i, m := range metadata {
+		families[i] = m.GetMetricFamilyName()
+		types[i] = m.GetType().String()
+		helps[i] = m.GetHelp()
+		units[i] = m.GetUnit()
+		timestamps[i] = ts
+	}
+	field := func(name string, values []string) *greptimev1.Column {
+		return &greptimev1.Column{
+			ColumnName:   name,
+			SemanticType: greptimev1.Column_FIELD,
+			Datatype:     greptimev1.ColumnDataType_STRING,
+			Values:       &greptimev1.Column_Values{StringValues: values},
+		}
+	}
+	family := field(MetadataFamilyColumn, families)
+	family.SemanticType = greptimev1.Column_TAG
+	return &greptimev1.InsertRequest{
+		TableName: opts.MetadataTable,
+		Columns: []*greptimev1.Column{
+			family,
+			field(MetadataTypeColumn, types),
+			field(MetadataHelpColumn, helps),
+			field(MetadataUnitColumn, units),
+			{
+				ColumnName:   TimestampColumn,
+				SemanticType: greptimev1.Column_TIMESTAMP,
+				Datatype:     greptimev1.ColumnDataType_TIMESTAMP_MILLISECOND,
+				Values:       &greptimev1.Column_Values{TsMillisecondValues: timestamps},
+			},
+		},
+		RowCount: uint32(n),
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"testing"
+	"time"
+
+	greptimev1 "github.com/GreptimeTeam/greptime-proto/go/greptime/v1"
+	"github.com/GreptimeTeam/greptime-proto/go/prometheus/remote"
+	"google.golang.org/protobuf/proto"
+)
+
+// labels returns the labels of alternating names and values.
+func labels(nameValues ...string) []*remote.Label {
+	ls := make([]*remote.Label, 0, len(nameValues)/2)
+	for i := 0; i < len(nameValues); i += 2 {
+		ls = append(ls, &remote.Label{Name: nameValues[i], Value: nameValues[i+1]})
+	}
+	return ls
+}
+
+func stringValues(name string, semantic greptimev1.Column_SemanticType, nullMask []byte, values ...string) *greptimev1.Column {
+	return &greptimev1.Column{
+		ColumnName:   name,
+		SemanticType: semantic,
+		Datatype:     greptimev1.ColumnDataType_STRING,
+		Values:       &greptimev1.Column_Values{StringValues: values},
+		NullMask:     nullMask,
+	}
+}
+
+func timestampColumn(timestamps ...int64) *greptimev1.Column {
+	return &greptimev1.Column{
+		ColumnName:   TimestampColumn,
+		SemanticType: greptimev1.Column_TIMESTAMP,
+		Datatype:     greptimev1.ColumnDataType_TIMESTAMP_MILLISECOND,
+		Values:       &greptimev1.Column_Values{TsMillisecondValues: timestamps},
+	}
+}
+
+func valueColumn(values ...float64) *greptimev1.Column {
+	return &greptimev1.Column{
+		ColumnName:   ValueColumn,
+		SemanticType: greptimev1.Column_FIELD,
+		Datatype:     greptimev1.ColumnDataType_FLOAT64,
+		Values:       &greptimev1.Column_Values{F64Values: values},
+	}
+}
+
+func TestToInsertRequests(t *testing.T) {
+	tests := []struct {
+		name string
+		req  *remote.WriteRequest
+		opts WriteOptions
+		want []*greptimev1.InsertRequest
+	}{
+		{
+			name: "series",
+			req: &remote.WriteRequest{Timeseries: []*remote.TimeSeries{
+				{Labels: labels("__name__", "up", "job", "a"), Samples: []*remote.Sample{{Value: 1, Timestamp: 1}, {Value: 0, Timestamp: 2}}},
+				{Labels: labels("__name__", "cpu", "job", "b"), Samples: []*remote.Sample{{Value: 0.5, Timestamp: 1}}},
+				{Labels: labels("instance", "i", "__name__", "up"), Samples: []*remote.Sample{{Value: 1, Timestamp: 3}}},
+				{Labels: labels("__name__", "idle")},
+			}},
+			want: []*greptimev1.InsertRequest{
+				{
+					TableName: "up",
+					Columns: []*greptimev1.Column{
+						// Rows 0 and 1 lack the instance, row 2 the job.
+						stringValues("instance", greptimev1.Column_TAG, []byte{0b011}, "i"),
+						stringValues("job", greptimev1.Column_TAG, []byte{0b100}, "a", "a"),
+						timestampColumn(1, 2, 3),
+						valueColumn(1, 0, 1),
+					},
+					RowCount: 3,
+				},
+				{
+					TableName: "cpu",
+					Columns: []*greptimev1.Column{
+						stringValues("job", greptimev1.Column_TAG, nil, "b"),
+						timestampColumn(1),
+						valueColumn(0.5),
+					},
+					RowCount: 1,
+				},
+			},
+		},
+		{
+			name: "exemplars dropped",
+			req: &remote.WriteRequest{Timeseries: []*remote.TimeSeries{
+				{Labels: labels("__name__", "up"), Exemplars: []*remote.Exemplar{{Labels: labels("trace_id", "t"), Value: 2, Timestamp: 5}}},
+			}},
+			want: []*greptimev1.InsertRequest{},
+		},
+		{
+			name: "exemplars",
+			req: &remote.WriteRequest{Timeseries: []*remote.TimeSeries{
+				{Labels: labels("__name__", "up", "job", "a"), Exemplars: []*remote.Exemplar{
+					{Labels: labels("trace_id", "t"), Value: 2, Timestamp: 5},
+					{Value: 3, Timestamp: 6},
+				}},
+			}},
+			opts: WriteOptions{ExemplarSuffix: "_exemplars"},
+			want: []*greptimev1.InsertRequest{{
+				TableName: "up_exemplars",
+				Columns: []*greptimev1.Column{
+					stringValues("job", greptimev1.Column_TAG, nil, "a", "a"),
+					stringValues("trace_id", greptimev1.Column_FIELD, []byte{0b10}, "t"),
+					timestampColumn(5, 6),
+					valueColumn(2, 3),
+				},
+				RowCount: 2,
+			}},
+		},
+		{
+			name: "metadata",
+			req: &remote.WriteRequest{Metadata: []*remote.MetricMetadata{
+				{Type: remote.MetricMetadata_COUNTER, MetricFamilyName: "http_requests", Help: "Requests.", Unit: "requests"},
+				{Type: remote.MetricMetadata_GAUGE, MetricFamilyName: "up"},
+			}},
+			opts: WriteOptions{MetadataTable: "metadata", Now: func() time.Time { return time.UnixMilli(1000) }},
+			want: []*greptimev1.InsertRequest{{
+				TableName: "metadata",
+				Columns: []*greptimev1.Column{
+					stringValues(MetadataFamilyColumn, greptimev1.Column_TAG, nil, "http_requests", "up"),
+					stringValues(MetadataTypeColumn, greptimev1.Column_FIELD, nil, "COUNTER", "GAUGE"),
+					stringValues(MetadataHelpColumn, greptimev1.Column_FIELD, nil, "Requests.", ""),
+					stringValues(MetadataUnitColumn, greptimev1.Column_FIELD, nil, "requests", ""),
+					timestampColumn(1000, 1000),
+				},
+				RowCount: 2,
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ToInsertRequests(tt.req, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := (&greptimev1.InsertRequests{Inserts: tt.want}); !proto.Equal(got, want) {
+				t.Errorf("ToInsertRequests() = %v, want %v", got, want)
+			}
+			for _, insert := range got.GetInserts() {
+				if err := insert.Validate(); err != nil {
+					t.Errorf("invalid insert of %s: %v", insert.TableName, err)
+				}
+			}
+		})
+	}
+}
+
+func TestToInsertRequestsErrors(t *testing.T) {
+	sample := []*remote.Sample{{Value: 1, Timestamp: 1}}
+	exemplar := []*remote.Exemplar{{Value: 1, Timestamp: 1}}
+	tests := []struct {
+		name   string
+		series []*remote.TimeSeries
+	}{
+		{name: "no metric name", series: []*remote.TimeSeries{{Labels: labels("job", "a"), Samples: sample}}},
+		{name: "empty label name", series: []*remote.TimeSeries{{Labels: labels("__name__", "up", "", "a"), Samples: sample}}},
+		{name: "timestamp label", series: []*remote.TimeSeries{{Labels: labels("__name__", "up", TimestampColumn, "a"), Samples: sample}}},
+		{name: "value label", series: []*remote.TimeSeries{{Labels: labels("__name__", "up", ValueColumn, "a"), Samples: sample}}},
+		{name: "duplicate label", series: []*remote.TimeSeries{{Labels: labels("__name__", "up", "job", "a", "job", "b"), Samples: sample}}},
+		{
+			name: "series and exemplar label",
+			series: []*remote.TimeSeries{
+				{Labels: labels("__name__", "up"), Exemplars: []*remote.Exemplar{{Labels: labels("job", "a"), Value: 1, Timestamp: 1}}},
+				{Labels: labels("__name__", "up", "job", "b"), Exemplars: exemplar},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &remote.WriteRequest{Timeseries: tt.series}
+			if got, err := ToInsertRequests(req, WriteOptions{ExemplarSuffix: "_exemplars"}); err == nil {
+				t.Errorf("ToInsertRequests() = %v, want an error", got)
+			}
+		})
+	}
+}
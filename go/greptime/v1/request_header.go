@@ -0,0 +1,44 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import "strings"
+
+// The catalog and schema of GreptimeDB requests that select none.
+const (
+	DefaultCatalog = "greptime"
+	DefaultSchema  = "public"
+)
+
+// Database returns the catalog and schema the header selects. A dbname,
+// either "<schema>" or "<catalog>-<schema>", takes precedence over the
+// catalog and schema fields, and DefaultCatalog and DefaultSchema stand
+// for the ones left empty. A nil header selects the default database.
+func (x *RequestHeader) Database() (catalog, schema string) {
+	catalog, schema = x.GetCatalog(), x.GetSchema()
+	if dbname := x.GetDbname(); dbname != "" {
+		catalog, schema = "", dbname
+		if i := strings.IndexByte(dbname, '-'); i >= 0 {
+			catalog, schema = dbname[:i], dbname[i+1:]
+		}
+	}
+	if catalog == "" {
+		catalog = DefaultCatalog
+	}
+	if schema == "" {
+		schema = DefaultSchema
+	}
+	return catalog, schema
+}
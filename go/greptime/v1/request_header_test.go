@@ -0,0 +1,40 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import "testing"
+
+func TestRequestHeaderDatabase(t *testing.T) {
+	tests := []struct {
+		name                    string
+		header                  *RequestHeader
+		wantCatalog, wantSchema string
+	}{
+		{name: "nil", wantCatalog: "greptime", wantSchema: "public"},
+		{name: "fields", header: &RequestHeader{Catalog: "c", Schema: "s"}, wantCatalog: "c", wantSchema: "s"},
+		{name: "schema", header: &RequestHeader{Schema: "s"}, wantCatalog: "greptime", wantSchema: "s"},
+		{name: "dbname", header: &RequestHeader{Catalog: "c", Schema: "s", Dbname: "db"}, wantCatalog: "greptime", wantSchema: "db"},
+		{name: "qualified dbname", header: &RequestHeader{Dbname: "c-my-db"}, wantCatalog: "c", wantSchema: "my-db"},
+		{name: "empty catalog", header: &RequestHeader{Dbname: "-db"}, wantCatalog: "greptime", wantSchema: "db"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			catalog, schema := tt.header.Database()
+			if catalog != tt.wantCatalog || schema != tt.wantSchema {
+				t.Errorf("Database() = %s, %s, want %s, %s", catalog, schema, tt.wantCatalog, tt.wantSchema)
+			}
+		})
+	}
+}
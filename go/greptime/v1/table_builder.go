@@ -0,0 +1,221 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// DefaultEngine is the table engine of the tables built by a TableBuilder
+// that names none.
+const DefaultEngine = "mito"
+
+// TableBuilder assembles a CreateTableExpr, keeping its column definitions,
+// time index and primary keys consistent:
+//
+//	expr, err := NewTable("cpu").
+//		Tag("host", ColumnDataType_STRING).
+//		Field("usage", ColumnDataType_FLOAT64).
+//		Timestamp("ts", ColumnDataType_TIMESTAMP_MILLISECOND).
+//		Option("ttl", "7d").
+//		Build()
+//
+// The expression is checked by Build, so columns and keys may be declared
+// in any order.
+type TableBuilder struct {
+	expr *CreateTableExpr
+	err  error
+}
+
+// NewTable returns a builder for a table of the DefaultEngine with a single
+// region numbered 0.
+func NewTable(name string) *TableBuilder {
+	return &TableBuilder{expr: &CreateTableExpr{
+		TableName:     name,
+		Engine:        DefaultEngine,
+		RegionNumbers: []uint32{0},
+	}}
+}
+
+// Catalog sets the catalog of the table, the one of the request header if
+// empty.
+func (b *TableBuilder) Catalog(catalog string) *TableBuilder {
+	b.expr.CatalogName = catalog
+	return b
+}
+
+// Schema sets the schema of the table, the one of the request header if
+// empty.
+func (b *TableBuilder) Schema(schema string) *TableBuilder {
+	b.expr.SchemaName = schema
+	return b
+}
+
+// Desc sets the description of the table.
+func (b *TableBuilder) Desc(desc string) *TableBuilder {
+	b.expr.Desc = desc
+	return b
+}
+
+// IfNotExists makes creating the table a no-op if it already exists.
+func (b *TableBuilder) IfNotExists() *TableBuilder {
+	b.expr.CreateIfNotExists = true
+	return b
+}
+
+// Engine sets the table engine.
+func (b *TableBuilder) Engine(engine string) *TableBuilder {
+	b.expr.Engine = engine
+	return b
+}
+
+// RegionNumbers sets the numbers of the regions of the table.
+func (b *TableBuilder) RegionNumbers(regions ...uint32) *TableBuilder {
+	b.expr.RegionNumbers = regions
+	return b
+}
+
+// Option sets a table option, like "ttl" or "write_buffer_size".
+func (b *TableBuilder) Option(key, value string) *TableBuilder {
+	if b.expr.TableOptions == nil {
+		b.expr.TableOptions = make(map[string]string)
+	}
+	b.expr.TableOptions[key] = value
+	return b
+}
+
+// Options sets the typed table options, failing Build if they are
+// invalid. See TableOptions.Map. A number of regions sets the region
+// numbers of the table, from 0 to Regions-1.
+func (b *TableBuilder) Options(opts TableOptions) *TableBuilder {
+	options, err := opts.Map()
+	if err != nil {
+		if b.err == nil {
+			b.err = fmt.Errorf("table %q: %w", b.expr.TableName, err)
+		}
+		return b
+	}
+	for key, value := range options {
+		b.Option(key, value)
+	}
+	if opts.Regions > 0 {
+		regions := make([]uint32, opts.Regions)
+		for i := range regions {
+			regions[i] = uint32(i)
+		}
+		b.RegionNumbers(regions...)
+	}
+	return b
+}
+
+// Column adds a column definition.
+func (b *TableBuilder) Column(def *ColumnDef) *TableBuilder {
+	b.expr.ColumnDefs = append(b.expr.ColumnDefs, def)
+	return b
+}
+
+// PrimaryKey appends columns to the primary key.
+func (b *TableBuilder) PrimaryKey(names ...string) *TableBuilder {
+	b.expr.PrimaryKeys = append(b.expr.PrimaryKeys, names...)
+	return b
+}
+
+// TimeIndex sets the time index column.
+func (b *TableBuilder) TimeIndex(name string) *TableBuilder {
+	b.expr.TimeIndex = name
+	return b
+}
+
+// Tag adds a nullable column to the primary key.
+func (b *TableBuilder) Tag(name string, datatype ColumnDataType) *TableBuilder {
+	return b.Column(&ColumnDef{Name: name, Datatype: datatype, IsNullable: true}).PrimaryKey(name)
+}
+
+// Field adds a nullable column.
+func (b *TableBuilder) Field(name string, datatype ColumnDataType) *TableBuilder {
+	return b.Column(&ColumnDef{Name: name, Datatype: datatype, IsNullable: true})
+}
+
+// Timestamp adds the time index column, datatype must be one of the
+// TIMESTAMP_* types. A table has a single time index, so Build fails if
+// another column is already the time index.
+func (b *TableBuilder) Timestamp(name string, datatype ColumnDataType) *TableBuilder {
+	if ts := b.expr.TimeIndex; ts != "" && ts != name && b.err == nil {
+		b.err = fmt.Errorf("table %q: column %q: %w, the time index is %q", b.expr.TableName, name, ErrMultipleTimestamps, ts)
+	}
+	return b.Column(&ColumnDef{Name: name, Datatype: datatype}).TimeIndex(name)
+}
+
+// Build checks the table and returns a copy of its expression. Column
+// names must be unique and non-empty, the time index must be a non-null
+// timestamp column, and primary keys must be distinct columns other than
+// the time index.
+func (b *TableBuilder) Build() (*CreateTableExpr, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if err := b.expr.check(); err != nil {
+		return nil, err
+	}
+	return proto.Clone(b.expr).(*CreateTableExpr), nil
+}
+
+func (x *CreateTableExpr) check() error {
+	if x.TableName == "" {
+		return fmt.Errorf("empty table name")
+	}
+	columns := make(map[string]*ColumnDef, len(x.ColumnDefs))
+	for i, def := range x.ColumnDefs {
+		if def.GetName() == "" {
+			return fmt.Errorf("table %q: column %d: %w", x.TableName, i, ErrEmptyColumnName)
+		}
+		if _, ok := columns[def.Name]; ok {
+			return fmt.Errorf("table %q: column %q: %w", x.TableName, def.Name, ErrDuplicateColumn)
+		}
+		if _, ok := ColumnDataType_name[int32(def.Datatype)]; !ok {
+			return fmt.Errorf("table %q: column %q: %w %d", x.TableName, def.Name, ErrUnknownDatatype, def.Datatype)
+		}
+		columns[def.Name] = def
+	}
+
+	if x.TimeIndex == "" {
+		return fmt.Errorf("table %q: no time index", x.TableName)
+	}
+	ts := columns[x.TimeIndex]
+	switch {
+	case ts == nil:
+		return fmt.Errorf("table %q: time index %q is not a column", x.TableName, x.TimeIndex)
+	case !ts.Datatype.IsTimestamp():
+		return fmt.Errorf("table %q: time index %q: %w, got %s", x.TableName, x.TimeIndex, ErrTimestampDatatype, ts.Datatype)
+	case ts.IsNullable:
+		return fmt.Errorf("table %q: time index %q is nullable", x.TableName, x.TimeIndex)
+	}
+
+	keys := make(map[string]bool, len(x.PrimaryKeys))
+	for _, key := range x.PrimaryKeys {
+		switch {
+		case columns[key] == nil:
+			return fmt.Errorf("table %q: primary key %q is not a column", x.TableName, key)
+		case key == x.TimeIndex:
+			return fmt.Errorf("table %q: primary key %q is the time index", x.TableName, key)
+		case keys[key]:
+			return fmt.Errorf("table %q: primary key %q: %w", x.TableName, key, ErrDuplicateColumn)
+		}
+		keys[key] = true
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func TestTableBuilder(t *testing.T) {
+	b := NewTable("cpu").
+		Catalog("c").
+		Schema("s").
+		Desc("cpu usage").
+		IfNotExists().
+		Field("usage", ColumnDataType_FLOAT64).
+		Timestamp("ts", ColumnDataType_TIMESTAMP_MILLISECOND).
+		Tag("host", ColumnDataType_STRING).
+		Option("ttl", "7d")
+	expr, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &CreateTableExpr{
+		CatalogName: "c",
+		SchemaName:  "s",
+		TableName:   "cpu",
+		Desc:        "cpu usage",
+		ColumnDefs: []*ColumnDef{
+			{Name: "usage", Datatype: ColumnDataType_FLOAT64, IsNullable: true},
+			{Name: "ts", Datatype: ColumnDataType_TIMESTAMP_MILLISECOND},
+			{Name: "host", Datatype: ColumnDataType_STRING, IsNullable: true},
+		},
+		TimeIndex:         "ts",
+		PrimaryKeys:       []string{"host"},
+		CreateIfNotExists: true,
+		TableOptions:      map[string]string{"ttl": "7d"},
+		RegionNumbers:     []uint32{0},
+		Engine:            DefaultEngine,
+	}
+	if !proto.Equal(expr, want) {
+		t.Errorf("Build() = %v, want %v", expr, want)
+	}
+
+	// Build returns a copy.
+	expr.ColumnDefs[0].Name = "renamed"
+	if again, err := b.Build(); err != nil || again.ColumnDefs[0].Name != "usage" {
+		t.Errorf("Build() after changing a built expression = %v, %v", again, err)
+	}
+}
+
+func TestTableBuilderErrors(t *testing.T) {
+	ts := func(name string) *TableBuilder {
+		return NewTable(name).Timestamp("ts", ColumnDataType_TIMESTAMP_MILLISECOND)
+	}
+	tests := []struct {
+		name string
+		b    *TableBuilder
+		// err, if set, is wrapped by the error.
+		err error
+	}{
+		{"empty table name", ts(""), nil},
+
+		{"no time index", NewTable("t").Field("v", ColumnDataType_FLOAT64), nil},
+		{"second time index", ts("t").Timestamp("ts2", ColumnDataType_TIMESTAMP_SECOND), ErrMultipleTimestamps},
+		{"time index not a column", NewTable("t").Field("v", ColumnDataType_FLOAT64).TimeIndex("ts"), nil},
+		{"time index not a timestamp", NewTable("t").Timestamp("ts", ColumnDataType_INT64), ErrTimestampDatatype},
+		{"time index of a datetime", NewTable("t").Timestamp("ts", ColumnDataType_DATETIME), ErrTimestampDatatype},
+		{"nullable time index", NewTable("t").Field("ts", ColumnDataType_TIMESTAMP_SECOND).TimeIndex("ts"), nil},
+
+		{"unknown key column", ts("t").PrimaryKey("host"), nil},
+		{"time index key", ts("t").PrimaryKey("ts"), nil},
+		{"duplicate key", ts("t").Tag("host", ColumnDataType_STRING).PrimaryKey("host"), ErrDuplicateColumn},
+
+		{"duplicate column", ts("t").Field("v", ColumnDataType_FLOAT64).Tag("v", ColumnDataType_STRING), ErrDuplicateColumn},
+		{"duplicate time index column", ts("t").Field("ts", ColumnDataType_FLOAT64), ErrDuplicateColumn},
+		{"empty column name", ts("t").Field("", ColumnDataType_FLOAT64), ErrEmptyColumnName},
+		{"unknown datatype", ts("t").Field("v", 100), ErrUnknownDatatype},
+
+		{"negative option", ts("t").Options(TableOptions{TTL: -time.Hour}), nil},
+		{"compaction options of another type", ts("t").Options(TableOptions{
+			Compaction: CompactionOptions{Type: "lcs", MaxActiveWindowFiles: 4},
+		}), nil},
+		{"extra option of a typed key", ts("t").Options(TableOptions{
+			TTL:   time.Hour,
+			Extra: map[string]string{OptionTTL: "2h"},
+		}), nil},
+		{"fractional compaction time window", ts("t").Options(TableOptions{CompactionTimeWindow: 1500 * time.Millisecond}), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := tt.b.Build()
+			if err == nil {
+				t.Fatalf("Build() = %v, want an error", expr)
+			}
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Errorf("Build() = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+// TestTableBuilderFirstError checks Build reports the first invalid
+// options, even if later ones are valid.
+func TestTableBuilderFirstError(t *testing.T) {
+	_, err := NewTable("t").
+		Timestamp("ts", ColumnDataType_TIMESTAMP_MILLISECOND).
+		Options(TableOptions{TTL: -time.Hour}).
+		Options(TableOptions{Regions: -1}).
+		Options(TableOptions{TTL: time.Hour}).
+		Build()
+	if want := `table "t": table option ttl is negative`; err == nil || err.Error() != want {
+		t.Errorf("Build() = %v, want %s", err, want)
+	}
+}
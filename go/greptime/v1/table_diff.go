@@ -0,0 +1,168 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrIncompatibleSchema is returned by DiffTables for changes that no
+// AlterExpr expresses.
+var ErrIncompatibleSchema = errors.New("schema change not expressible as alter expressions")
+
+// DiffTables returns the AlterExprs migrating table from to table to, in
+// the order they must be applied: a RenameTable if the names differ, a
+// DropColumns for the columns of from missing in to, and an AddColumns
+// for the columns of to missing in from, each located after the column
+// preceding it in to. There are no AlterExprs if the tables are the same.
+//
+// version is the current version of table from. Each AlterExpr bumps the
+// version of the table, so the i-th one has table_version version+i as
+// precondition.
+//
+// The other changes fail with ErrIncompatibleSchema: of the time index, of
+// the datatype, nullability or default of a column, of the primary key
+// apart from appending new columns to it in their column order, of the
+// order of the columns kept, or of the catalog, schema, engine, regions
+// or options. Added columns must be nullable or have a default.
+func DiffTables(from, to *CreateTableExpr, version uint64) ([]*AlterExpr, error) {
+	if err := from.check(); err != nil {
+		return nil, err
+	}
+	if err := to.check(); err != nil {
+		return nil, err
+	}
+	incompatible := func(format string, args ...any) error {
+		return fmt.Errorf("table %q: %s: %w", from.TableName, fmt.Sprintf(format, args...), ErrIncompatibleSchema)
+	}
+	switch {
+	case from.CatalogName != to.CatalogName || from.SchemaName != to.SchemaName:
+		return nil, incompatible("moved to %s.%s", to.CatalogName, to.SchemaName)
+	case from.Engine != to.Engine:
+		return nil, incompatible("engine changed to %q", to.Engine)
+	case !reflect.DeepEqual(from.RegionNumbers, to.RegionNumbers):
+		return nil, incompatible("regions changed to %v", to.RegionNumbers)
+	case len(from.TableOptions)+len(to.TableOptions) > 0 && !reflect.DeepEqual(from.TableOptions, to.TableOptions):
+		return nil, incompatible("options changed to %v", to.TableOptions)
+	case from.TimeIndex != to.TimeIndex:
+		return nil, incompatible("time index changed to %q", to.TimeIndex)
+	}
+
+	fromDefs := make(map[string]*ColumnDef, len(from.ColumnDefs))
+	for _, def := range from.ColumnDefs {
+		fromDefs[def.Name] = def
+	}
+	toDefs := make(map[string]*ColumnDef, len(to.ColumnDefs))
+	for _, def := range to.ColumnDefs {
+		toDefs[def.Name] = def
+		if old := fromDefs[def.Name]; old != nil && (old.Datatype != def.Datatype ||
+			old.IsNullable != def.IsNullable || !bytes.Equal(old.DefaultConstraint, def.DefaultConstraint)) {
+			return nil, incompatible("column %q changed", def.Name)
+		}
+	}
+	for i, key := range from.PrimaryKeys {
+		if i >= len(to.PrimaryKeys) || to.PrimaryKeys[i] != key {
+			return nil, incompatible("primary key changed to %v", to.PrimaryKeys)
+		}
+	}
+	for _, key := range to.PrimaryKeys[len(from.PrimaryKeys):] {
+		if fromDefs[key] != nil {
+			return nil, incompatible("existing column %q added to the primary key", key)
+		}
+	}
+
+	var drops []*DropColumn
+	kept := make([]string, 0, len(from.ColumnDefs))
+	for _, def := range from.ColumnDefs {
+		if toDefs[def.Name] == nil {
+			drops = append(drops, &DropColumn{Name: def.Name})
+		} else {
+			kept = append(kept, def.Name)
+		}
+	}
+	var adds []*AddColumn
+	newKeys := make(map[string]bool)
+	for _, key := range to.PrimaryKeys[len(from.PrimaryKeys):] {
+		newKeys[key] = true
+	}
+	k := 0
+	for i, def := range to.ColumnDefs {
+		if fromDefs[def.Name] != nil {
+			if kept[k] != def.Name {
+				return nil, incompatible("column %q moved", def.Name)
+			}
+			k++
+			continue
+		}
+		if !def.IsNullable && len(def.DefaultConstraint) == 0 {
+			return nil, incompatible("added column %q is neither nullable nor has a default", def.Name)
+		}
+		location := &AddColumn_Location{LocationType: AddColumn_Location_FIRST}
+		if i > 0 {
+			location = &AddColumn_Location{
+				LocationType:    AddColumn_Location_AFTER,
+				AfterCloumnName: to.ColumnDefs[i-1].Name,
+			}
+		}
+		adds = append(adds, &AddColumn{
+			ColumnDef: proto.Clone(def).(*ColumnDef),
+			IsKey:     newKeys[def.Name],
+			Location:  location,
+		})
+	}
+	// The server appends the key columns to the primary key in the order
+	// they are added, which is their column order.
+	added := to.PrimaryKeys[len(from.PrimaryKeys):]
+	for _, add := range adds {
+		if add.IsKey {
+			if added[0] != add.ColumnDef.Name {
+				return nil, incompatible("primary key columns %v not added in column order", to.PrimaryKeys[len(from.PrimaryKeys):])
+			}
+			added = added[1:]
+		}
+	}
+
+	var alters []*AlterExpr
+	name := from.TableName
+	alter := func(kind isAlterExpr_Kind) {
+		expr := &AlterExpr{
+			CatalogName:  from.CatalogName,
+			SchemaName:   from.SchemaName,
+			TableName:    name,
+			Kind:         kind,
+			TableVersion: version + uint64(len(alters)),
+		}
+		if from.TableId != nil {
+			expr.TableId = proto.Clone(from.TableId).(*TableId)
+		}
+		alters = append(alters, expr)
+	}
+	if to.TableName != from.TableName {
+		alter(&AlterExpr_RenameTable{RenameTable: &RenameTable{NewTableName: to.TableName}})
+		name = to.TableName
+	}
+	if len(drops) > 0 {
+		alter(&AlterExpr_DropColumns{DropColumns: &DropColumns{DropColumns: drops}})
+	}
+	if len(adds) > 0 {
+		alter(&AlterExpr_AddColumns{AddColumns: &AddColumns{AddColumns: adds}})
+	}
+	return alters, nil
+}
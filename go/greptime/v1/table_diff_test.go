@@ -0,0 +1,230 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// cpu returns a builder of the table "cpu" of a tag "host", a time index
+// "ts" and a field "usage".
+func cpu() *TableBuilder {
+	return NewTable("cpu").
+		Tag("host", ColumnDataType_STRING).
+		Timestamp("ts", ColumnDataType_TIMESTAMP_MILLISECOND).
+		Field("usage", ColumnDataType_FLOAT64)
+}
+
+func build(t *testing.T, b *TableBuilder) *CreateTableExpr {
+	t.Helper()
+	expr, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return expr
+}
+
+func adds(version uint64, name string, columns ...*AddColumn) *AlterExpr {
+	return &AlterExpr{
+		TableName:    name,
+		TableVersion: version,
+		Kind:         &AlterExpr_AddColumns{AddColumns: &AddColumns{AddColumns: columns}},
+	}
+}
+
+func drops(version uint64, name string, columns ...string) *AlterExpr {
+	expr := &DropColumns{}
+	for _, column := range columns {
+		expr.DropColumns = append(expr.DropColumns, &DropColumn{Name: column})
+	}
+	return &AlterExpr{TableName: name, TableVersion: version, Kind: &AlterExpr_DropColumns{DropColumns: expr}}
+}
+
+func after(column string) *AddColumn_Location {
+	return &AddColumn_Location{LocationType: AddColumn_Location_AFTER, AfterCloumnName: column}
+}
+
+func TestDiffTables(t *testing.T) {
+	def := func(name string, datatype ColumnDataType) *ColumnDef {
+		return &ColumnDef{Name: name, Datatype: datatype, IsNullable: true}
+	}
+	tests := []struct {
+		name string
+		from *TableBuilder
+		to   *TableBuilder
+		want []*AlterExpr
+	}{
+		{"same", cpu(), cpu(), nil},
+		{"same options", cpu().Option("ttl", "7d"), cpu().Option("ttl", "7d"), nil},
+		{
+			"rename",
+			cpu(),
+			NewTable("cpu2").
+				Tag("host", ColumnDataType_STRING).
+				Timestamp("ts", ColumnDataType_TIMESTAMP_MILLISECOND).
+				Field("usage", ColumnDataType_FLOAT64),
+			[]*AlterExpr{{
+				TableName:    "cpu",
+				TableVersion: 3,
+				Kind:         &AlterExpr_RenameTable{RenameTable: &RenameTable{NewTableName: "cpu2"}},
+			}},
+		},
+		{
+			"add",
+			cpu(),
+			NewTable("cpu").
+				Field("first", ColumnDataType_INT64).
+				Tag("host", ColumnDataType_STRING).
+				Timestamp("ts", ColumnDataType_TIMESTAMP_MILLISECOND).
+				Field("mid", ColumnDataType_INT64).
+				Field("usage", ColumnDataType_FLOAT64).
+				Field("last", ColumnDataType_STRING),
+			[]*AlterExpr{adds(3, "cpu",
+				&AddColumn{ColumnDef: def("first", ColumnDataType_INT64), Location: &AddColumn_Location{LocationType: AddColumn_Location_FIRST}},
+				&AddColumn{ColumnDef: def("mid", ColumnDataType_INT64), Location: after("ts")},
+				&AddColumn{ColumnDef: def("last", ColumnDataType_STRING), Location: after("usage")},
+			)},
+		},
+		{
+			"add keys",
+			cpu(),
+			cpu().Tag("idc", ColumnDataType_STRING).Tag("rack", ColumnDataType_INT32),
+			[]*AlterExpr{adds(3, "cpu",
+				&AddColumn{ColumnDef: def("idc", ColumnDataType_STRING), IsKey: true, Location: after("usage")},
+				&AddColumn{ColumnDef: def("rack", ColumnDataType_INT32), IsKey: true, Location: after("idc")},
+			)},
+		},
+		{
+			"drop",
+			cpu().Field("a", ColumnDataType_INT64).Field("b", ColumnDataType_INT64),
+			cpu(),
+			[]*AlterExpr{drops(3, "cpu", "a", "b")},
+		},
+		{
+			"rename, drop and add",
+			cpu(),
+			NewTable("mem").
+				Tag("host", ColumnDataType_STRING).
+				Timestamp("ts", ColumnDataType_TIMESTAMP_MILLISECOND).
+				Field("used", ColumnDataType_FLOAT64),
+			[]*AlterExpr{
+				{TableName: "cpu", TableVersion: 3, Kind: &AlterExpr_RenameTable{RenameTable: &RenameTable{NewTableName: "mem"}}},
+				drops(4, "mem", "usage"),
+				adds(5, "mem", &AddColumn{ColumnDef: def("used", ColumnDataType_FLOAT64), Location: after("ts")}),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DiffTables(build(t, tt.from), build(t, tt.to), 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("DiffTables() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if !proto.Equal(got[i], tt.want[i]) {
+					t.Errorf("DiffTables()[%d] = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDiffTablesQualified(t *testing.T) {
+	from := build(t, cpu().Catalog("c").Schema("s"))
+	from.TableId = &TableId{Id: 1024}
+	to := build(t, cpu().Catalog("c").Schema("s").Field("v", ColumnDataType_INT64))
+	got, err := DiffTables(from, to, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := adds(0, "cpu", &AddColumn{
+		ColumnDef: &ColumnDef{Name: "v", Datatype: ColumnDataType_INT64, IsNullable: true},
+		Location:  after("usage"),
+	})
+	want.CatalogName, want.SchemaName, want.TableId = "c", "s", &TableId{Id: 1024}
+	if len(got) != 1 || !proto.Equal(got[0], want) {
+		t.Errorf("DiffTables() = %v, want %v", got, want)
+	}
+}
+
+func TestDiffTablesErrors(t *testing.T) {
+	withDefault := func(b *TableBuilder, name string, v any) *TableBuilder {
+		constraint, err := DefaultValue(ColumnDataType_FLOAT64, v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b.Column(&ColumnDef{Name: name, Datatype: ColumnDataType_FLOAT64, DefaultConstraint: constraint})
+	}
+	tests := []struct {
+		name string
+		from *TableBuilder
+		to   *TableBuilder
+	}{
+		{"catalog", cpu(), cpu().Catalog("c")},
+		{"schema", cpu(), cpu().Schema("s")},
+		{"engine", cpu(), cpu().Engine("file")},
+		{"regions", cpu(), cpu().Options(TableOptions{Regions: 2})},
+		{"options added", cpu(), cpu().Option("ttl", "7d")},
+		{"options changed", cpu().Options(TableOptions{TTL: time.Hour}), cpu().Options(TableOptions{TTL: 2 * time.Hour})},
+		{"options removed", cpu().Option("ttl", "7d"), cpu()},
+
+		{"time index", cpu().Field("ts2", ColumnDataType_TIMESTAMP_SECOND),
+			NewTable("cpu").Tag("host", ColumnDataType_STRING).Field("ts", ColumnDataType_TIMESTAMP_MILLISECOND).
+				Field("usage", ColumnDataType_FLOAT64).Column(&ColumnDef{Name: "ts2", Datatype: ColumnDataType_TIMESTAMP_SECOND}).TimeIndex("ts2")},
+		{"retyped", cpu(), NewTable("cpu").Tag("host", ColumnDataType_STRING).
+			Timestamp("ts", ColumnDataType_TIMESTAMP_MILLISECOND).Field("usage", ColumnDataType_FLOAT32)},
+		{"nullability", cpu(), NewTable("cpu").Tag("host", ColumnDataType_STRING).
+			Timestamp("ts", ColumnDataType_TIMESTAMP_MILLISECOND).Column(&ColumnDef{Name: "usage", Datatype: ColumnDataType_FLOAT64})},
+		{"default", withDefault(cpu(), "v", 1.0), withDefault(cpu(), "v", 2.0)},
+		{"moved", cpu().Field("a", ColumnDataType_INT64), NewTable("cpu").Field("a", ColumnDataType_INT64).
+			Tag("host", ColumnDataType_STRING).Timestamp("ts", ColumnDataType_TIMESTAMP_MILLISECOND).Field("usage", ColumnDataType_FLOAT64)},
+		{"reordered", cpu().Field("a", ColumnDataType_INT64).Field("b", ColumnDataType_INT64),
+			cpu().Field("b", ColumnDataType_INT64).Field("a", ColumnDataType_INT64)},
+		{"non-null added column", cpu(), cpu().Column(&ColumnDef{Name: "v", Datatype: ColumnDataType_INT64})},
+
+		{"key removed", cpu(), NewTable("cpu").Field("host", ColumnDataType_STRING).
+			Timestamp("ts", ColumnDataType_TIMESTAMP_MILLISECOND).Field("usage", ColumnDataType_FLOAT64)},
+		{"keys reordered", cpu().Tag("idc", ColumnDataType_STRING),
+			NewTable("cpu").Tag("idc", ColumnDataType_STRING).Tag("host", ColumnDataType_STRING).
+				Timestamp("ts", ColumnDataType_TIMESTAMP_MILLISECOND).Field("usage", ColumnDataType_FLOAT64)},
+		{"existing column added to the key", cpu(), cpu().PrimaryKey("usage")},
+		{"new keys out of column order", cpu(),
+			cpu().Field("idc", ColumnDataType_STRING).Field("rack", ColumnDataType_INT32).PrimaryKey("rack", "idc")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DiffTables(build(t, tt.from), build(t, tt.to), 1)
+			if !errors.Is(err, ErrIncompatibleSchema) {
+				t.Errorf("DiffTables() = %v, %v, want ErrIncompatibleSchema", got, err)
+			}
+		})
+	}
+
+	// Invalid tables fail their check.
+	invalid := &CreateTableExpr{TableName: "cpu"}
+	if got, err := DiffTables(invalid, build(t, cpu()), 1); err == nil || errors.Is(err, ErrIncompatibleSchema) {
+		t.Errorf("DiffTables() from a table without a time index = %v, %v", got, err)
+	}
+	if got, err := DiffTables(build(t, cpu()), invalid, 1); err == nil || errors.Is(err, ErrIncompatibleSchema) {
+		t.Errorf("DiffTables() to a table without a time index = %v, %v", got, err)
+	}
+}
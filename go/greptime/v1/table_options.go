@@ -0,0 +1,349 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrUnknownTableOption is returned by ParseTableOptions for the keys it
+// doesn't know.
+var ErrUnknownTableOption = errors.New("unknown table option")
+
+// The keys of the table options.
+const (
+	OptionTTL                        = "ttl"
+	OptionWriteBufferSize            = "write_buffer_size"
+	OptionRegions                    = "regions"
+	OptionStorage                    = "storage"
+	OptionCompactionTimeWindow       = "compaction_time_window"
+	OptionCompactionType             = "compaction.type"
+	OptionTwcsTimeWindow             = "compaction.twcs.time_window"
+	OptionTwcsMaxActiveWindowFiles   = "compaction.twcs.max_active_window_files"
+	OptionTwcsMaxInactiveWindowFiles = "compaction.twcs.max_inactive_window_files"
+)
+
+// MaxRegions is the largest number of regions of a table. The region
+// numbers are allocated from the number of regions, so it is bounded.
+const MaxRegions = 4096
+
+// CompactionTwcs is the time window compaction strategy.
+const CompactionTwcs = "twcs"
+
+// CompactionOptions are the compaction options of a table.
+type CompactionOptions struct {
+	// Type is the compaction strategy, CompactionTwcs for the time window
+	// compaction strategy, which the other fields configure.
+	Type string
+	// TimeWindow is the time window of the files, inferred if zero.
+	TimeWindow time.Duration
+	// MaxActiveWindowFiles and MaxInactiveWindowFiles are the numbers of
+	// files in the active and inactive windows triggering a compaction.
+	MaxActiveWindowFiles   int
+	MaxInactiveWindowFiles int
+}
+
+// TableOptions are the typed table_options of a CreateTableExpr. Zero
+// fields are left out of the options, taking the default of the server.
+type TableOptions struct {
+	// TTL is how long rows are kept, written like "7d" or "1h 30m".
+	TTL time.Duration
+	// WriteBufferSize is the size in bytes of the memtables, written like
+	// "8MiB".
+	WriteBufferSize uint64
+	// Regions is the number of regions of the table. The server takes it
+	// as the region numbers of the table rather than as a table option:
+	// TableBuilder.Options numbers the regions from 0 to Regions-1, and
+	// CreateTableExpr.Options counts the region numbers.
+	Regions int
+	// Storage names the object store of the table, like "S3".
+	Storage string
+	// CompactionTimeWindow is the legacy compaction time window, a whole
+	// number of seconds.
+	CompactionTimeWindow time.Duration
+	Compaction           CompactionOptions
+	// Extra holds the options with other keys, verbatim.
+	Extra map[string]string
+}
+
+var tableOptionKeys = map[string]bool{
+	OptionTTL:                        true,
+	OptionWriteBufferSize:            true,
+	OptionRegions:                    true,
+	OptionStorage:                    true,
+	OptionCompactionTimeWindow:       true,
+	OptionCompactionType:             true,
+	OptionTwcsTimeWindow:             true,
+	OptionTwcsMaxActiveWindowFiles:   true,
+	OptionTwcsMaxInactiveWindowFiles: true,
+}
+
+// ParseTableOptions parses table options, failing for invalid values. The
+// options with unknown keys are kept in Extra, and reported by an error
+// wrapping ErrUnknownTableOption returned with the parsed options.
+func ParseTableOptions(options map[string]string) (*TableOptions, error) {
+	o := &TableOptions{}
+	var unknown []string
+	var err error
+	for key, value := range options {
+		switch key {
+		case OptionTTL:
+			o.TTL, err = parseHumanDuration(value)
+		case OptionWriteBufferSize:
+			o.WriteBufferSize, err = parseReadableSize(value)
+		case OptionRegions:
+			o.Regions, err = parseCount(value)
+		case OptionStorage:
+			o.Storage = value
+		case OptionCompactionTimeWindow:
+			var secs int
+			secs, err = parseCount(value)
+			o.CompactionTimeWindow = time.Duration(secs) * time.Second
+		case OptionCompactionType:
+			o.Compaction.Type = value
+		case OptionTwcsTimeWindow:
+			o.Compaction.TimeWindow, err = parseHumanDuration(value)
+		case OptionTwcsMaxActiveWindowFiles:
+			o.Compaction.MaxActiveWindowFiles, err = parseCount(value)
+		case OptionTwcsMaxInactiveWindowFiles:
+			o.Compaction.MaxInactiveWindowFiles, err = parseCount(value)
+		default:
+			if o.Extra == nil {
+				o.Extra = make(map[string]string)
+			}
+			o.Extra[key] = value
+			unknown = append(unknown, key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("table option %s: %w", key, err)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return o, fmt.Errorf("%w %s", ErrUnknownTableOption, strings.Join(unknown, ", "))
+	}
+	return o, nil
+}
+
+// Map returns the options as table_options, failing for negative values,
+// more than MaxRegions regions, a compaction time window that isn't a
+// whole number of seconds, time window compaction options for another
+// compaction type, or Extra options having a known key. Regions is left
+// out of the options.
+func (o *TableOptions) Map() (map[string]string, error) {
+	c := &o.Compaction
+	twcs := c.TimeWindow != 0 || c.MaxActiveWindowFiles != 0 || c.MaxInactiveWindowFiles != 0
+	negative := func(key string) error {
+		return fmt.Errorf("table option %s is negative", key)
+	}
+	switch {
+	case o.TTL < 0:
+		return nil, negative(OptionTTL)
+	case o.Regions < 0:
+		return nil, negative(OptionRegions)
+	case o.Regions > MaxRegions:
+		return nil, fmt.Errorf("table option %s %d exceeds %d", OptionRegions, o.Regions, MaxRegions)
+	case o.CompactionTimeWindow < 0:
+		return nil, negative(OptionCompactionTimeWindow)
+	case o.CompactionTimeWindow%time.Second != 0:
+		return nil, fmt.Errorf("table option %s is not a whole number of seconds", OptionCompactionTimeWindow)
+	case c.TimeWindow < 0:
+		return nil, negative(OptionTwcsTimeWindow)
+	case c.MaxActiveWindowFiles < 0:
+		return nil, negative(OptionTwcsMaxActiveWindowFiles)
+	case c.MaxInactiveWindowFiles < 0:
+		return nil, negative(OptionTwcsMaxInactiveWindowFiles)
+	case twcs && c.Type != "" && c.Type != CompactionTwcs:
+		return nil, fmt.Errorf("time window compaction options for compaction type %q", c.Type)
+	}
+
+	options := make(map[string]string)
+	if o.TTL > 0 {
+		options[OptionTTL] = formatHumanDuration(o.TTL)
+	}
+	if o.WriteBufferSize > 0 {
+		options[OptionWriteBufferSize] = formatReadableSize(o.WriteBufferSize)
+	}
+	if o.Storage != "" {
+		options[OptionStorage] = o.Storage
+	}
+	if o.CompactionTimeWindow > 0 {
+		options[OptionCompactionTimeWindow] = strconv.FormatInt(int64(o.CompactionTimeWindow/time.Second), 10)
+	}
+	if c.Type != "" {
+		options[OptionCompactionType] = c.Type
+	} else if twcs {
+		options[OptionCompactionType] = CompactionTwcs
+	}
+	if c.TimeWindow > 0 {
+		options[OptionTwcsTimeWindow] = formatHumanDuration(c.TimeWindow)
+	}
+	if c.MaxActiveWindowFiles > 0 {
+		options[OptionTwcsMaxActiveWindowFiles] = strconv.Itoa(c.MaxActiveWindowFiles)
+	}
+	if c.MaxInactiveWindowFiles > 0 {
+		options[OptionTwcsMaxInactiveWindowFiles] = strconv.Itoa(c.MaxInactiveWindowFiles)
+	}
+	for key, value := range o.Extra {
+		if tableOptionKeys[key] {
+			return nil, fmt.Errorf("extra table option %s has the key of a typed option", key)
+		}
+		options[key] = value
+	}
+	return options, nil
+}
+
+// Options parses the table options of the expression, see
+// ParseTableOptions. Unless the options set it, Regions is the number of
+// region numbers of the expression.
+func (x *CreateTableExpr) Options() (*TableOptions, error) {
+	o, err := ParseTableOptions(x.GetTableOptions())
+	if o != nil && o.Regions == 0 {
+		o.Regions = len(x.GetRegionNumbers())
+	}
+	return o, err
+}
+
+func parseCount(s string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid number %q", s)
+	}
+	return n, nil
+}
+
+// humanUnits are the units of the durations of the server, which are
+// those of the humantime crate.
+var humanUnits = map[string]time.Duration{
+	"nsec": time.Nanosecond, "ns": time.Nanosecond,
+	"usec": time.Microsecond, "us": time.Microsecond,
+	"msec": time.Millisecond, "ms": time.Millisecond,
+	"seconds": time.Second, "second": time.Second, "sec": time.Second, "s": time.Second,
+	"minutes": time.Minute, "minute": time.Minute, "min": time.Minute, "m": time.Minute,
+	"hours": time.Hour, "hour": time.Hour, "hr": time.Hour, "h": time.Hour,
+	"days": 24 * time.Hour, "day": 24 * time.Hour, "d": 24 * time.Hour,
+	"weeks": 7 * 24 * time.Hour, "week": 7 * 24 * time.Hour, "w": 7 * 24 * time.Hour,
+	"months": 2630016 * time.Second, "month": 2630016 * time.Second, "M": 2630016 * time.Second,
+	"years": 31557600 * time.Second, "year": 31557600 * time.Second, "y": 31557600 * time.Second,
+}
+
+// parseHumanDuration parses a duration like "7d", "1h 30m" or "2weeks", a
+// sequence of whole numbers followed by a unit.
+func parseHumanDuration(s string) (time.Duration, error) {
+	invalid := fmt.Errorf("invalid duration %q", s)
+	rest := strings.TrimSpace(s)
+	if rest == "" {
+		return 0, invalid
+	}
+	var d time.Duration
+	for rest != "" {
+		i := 0
+		for i < len(rest) && '0' <= rest[i] && rest[i] <= '9' {
+			i++
+		}
+		j := i
+		for j < len(rest) && ('a' <= rest[j] && rest[j] <= 'z' || 'A' <= rest[j] && rest[j] <= 'Z') {
+			j++
+		}
+		n, err := strconv.ParseInt(rest[:i], 10, 64)
+		unit, ok := humanUnits[rest[i:j]]
+		if err != nil || !ok || n > int64(math.MaxInt64/unit) || d > math.MaxInt64-time.Duration(n)*unit {
+			return 0, invalid
+		}
+		d += time.Duration(n) * unit
+		rest = strings.TrimLeft(rest[j:], " ")
+	}
+	return d, nil
+}
+
+// formatHumanDuration formats a duration like "7d" or "1h 30m".
+func formatHumanDuration(d time.Duration) string {
+	units := []struct {
+		name string
+		d    time.Duration
+	}{
+		{"d", 24 * time.Hour}, {"h", time.Hour}, {"m", time.Minute}, {"s", time.Second},
+		{"ms", time.Millisecond}, {"us", time.Microsecond}, {"ns", time.Nanosecond},
+	}
+	var parts []string
+	for _, unit := range units {
+		if n := d / unit.d; n > 0 {
+			parts = append(parts, strconv.FormatInt(int64(n), 10)+unit.name)
+			d -= n * unit.d
+		}
+	}
+	if len(parts) == 0 {
+		return "0s"
+	}
+	return strings.Join(parts, " ")
+}
+
+// sizeUnits are the units of sizes, all powers of 1024 like for the server.
+var sizeUnits = []struct {
+	name    string
+	aliases []string
+	size    uint64
+}{
+	{"PiB", []string{"PIB", "PB", "P"}, 1 << 50},
+	{"TiB", []string{"TIB", "TB", "T"}, 1 << 40},
+	{"GiB", []string{"GIB", "GB", "G"}, 1 << 30},
+	{"MiB", []string{"MIB", "MB", "M"}, 1 << 20},
+	{"KiB", []string{"KIB", "KB", "K"}, 1 << 10},
+	{"B", []string{"B", ""}, 1},
+}
+
+// parseReadableSize parses a size like "8MiB", "1.5GB" or "1024".
+func parseReadableSize(s string) (uint64, error) {
+	invalid := fmt.Errorf("invalid size %q", s)
+	upper := strings.ToUpper(strings.TrimSpace(s))
+	i := strings.IndexFunc(upper, func(r rune) bool { return r != '.' && (r < '0' || r > '9') })
+	if i < 0 {
+		i = len(upper)
+	}
+	n, err := strconv.ParseFloat(upper[:i], 64)
+	if err != nil {
+		return 0, invalid
+	}
+	suffix := strings.TrimSpace(upper[i:])
+	for _, unit := range sizeUnits {
+		for _, alias := range unit.aliases {
+			if suffix == alias {
+				size := n * float64(unit.size)
+				if size >= math.MaxUint64 {
+					return 0, invalid
+				}
+				return uint64(size), nil
+			}
+		}
+	}
+	return 0, invalid
+}
+
+// formatReadableSize formats a size in the largest unit dividing it, like
+// "8MiB".
+func formatReadableSize(size uint64) string {
+	for _, unit := range sizeUnits {
+		if size%unit.size == 0 {
+			return strconv.FormatUint(size/unit.size, 10) + unit.name
+		}
+	}
+	return ""
+}
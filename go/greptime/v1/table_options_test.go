@@ -0,0 +1,149 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTableOptionsMap(t *testing.T) {
+	tests := []struct {
+		name string
+		opts TableOptions
+		want map[string]string
+	}{
+		{name: "zero", want: map[string]string{}},
+		{
+			name: "all",
+			opts: TableOptions{
+				TTL:                  7*24*time.Hour + 90*time.Minute,
+				WriteBufferSize:      8 << 20,
+				Storage:              "S3",
+				CompactionTimeWindow: time.Hour,
+				Compaction:           CompactionOptions{Type: CompactionTwcs, TimeWindow: 2 * time.Hour, MaxActiveWindowFiles: 4, MaxInactiveWindowFiles: 1},
+				Extra:                map[string]string{"memtable.type": "partition_tree"},
+			},
+			want: map[string]string{
+				OptionTTL:                        "7d 1h 30m",
+				OptionWriteBufferSize:            "8MiB",
+				OptionStorage:                    "S3",
+				OptionCompactionTimeWindow:       "3600",
+				OptionCompactionType:             "twcs",
+				OptionTwcsTimeWindow:             "2h",
+				OptionTwcsMaxActiveWindowFiles:   "4",
+				OptionTwcsMaxInactiveWindowFiles: "1",
+				"memtable.type":                  "partition_tree",
+			},
+		},
+		{name: "regions", opts: TableOptions{Regions: 4}, want: map[string]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.opts.Map()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Map() = %v, want %v", got, tt.want)
+			}
+			parsed, err := ParseTableOptions(got)
+			if err != nil && !errors.Is(err, ErrUnknownTableOption) {
+				t.Fatal(err)
+			}
+			want := tt.opts
+			want.Regions = 0
+			if !reflect.DeepEqual(*parsed, want) {
+				t.Errorf("ParseTableOptions(%v) = %+v, want %+v", got, *parsed, want)
+			}
+		})
+	}
+}
+
+func TestTableOptionsMapErrors(t *testing.T) {
+	for _, opts := range []TableOptions{
+		{TTL: -time.Second},
+		{Regions: -1},
+		{Regions: MaxRegions + 1},
+		{Regions: 1 << 40},
+		{CompactionTimeWindow: 1500 * time.Millisecond},
+		{Compaction: CompactionOptions{Type: "lcs", MaxActiveWindowFiles: 1}},
+		{Extra: map[string]string{OptionRegions: "2"}},
+	} {
+		if got, err := opts.Map(); err == nil {
+			t.Errorf("Map() of %+v = %v, want an error", opts, got)
+		}
+	}
+}
+
+func TestParseTableOptionsErrors(t *testing.T) {
+	for _, options := range []map[string]string{
+		{OptionTTL: "7"},
+		{OptionTTL: "7 parsecs"},
+		{OptionWriteBufferSize: "8XB"},
+		{OptionRegions: "-1"},
+		{OptionCompactionTimeWindow: "1h"},
+	} {
+		if got, err := ParseTableOptions(options); err == nil {
+			t.Errorf("ParseTableOptions(%v) = %+v, want an error", options, got)
+		}
+	}
+	got, err := ParseTableOptions(map[string]string{"a": "1", OptionStorage: "S3"})
+	if !errors.Is(err, ErrUnknownTableOption) {
+		t.Errorf("ParseTableOptions with an unknown key: %v, want ErrUnknownTableOption", err)
+	}
+	if got == nil || got.Storage != "S3" || got.Extra["a"] != "1" {
+		t.Errorf("ParseTableOptions with an unknown key = %+v", got)
+	}
+}
+
+func TestTableBuilderRegions(t *testing.T) {
+	expr, err := NewTable("t").
+		Timestamp("ts", ColumnDataType_TIMESTAMP_MILLISECOND).
+		Options(TableOptions{Regions: 3, TTL: time.Hour}).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []uint32{0, 1, 2}; !reflect.DeepEqual(expr.RegionNumbers, want) {
+		t.Errorf("RegionNumbers = %v, want %v", expr.RegionNumbers, want)
+	}
+	if want := map[string]string{OptionTTL: "1h"}; !reflect.DeepEqual(expr.TableOptions, want) {
+		t.Errorf("TableOptions = %v, want %v", expr.TableOptions, want)
+	}
+	opts, err := expr.Options()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Regions != 3 {
+		t.Errorf("Options().Regions = %d, want 3", opts.Regions)
+	}
+
+	expr, err = NewTable("t").
+		Timestamp("ts", ColumnDataType_TIMESTAMP_MILLISECOND).
+		Options(TableOptions{Regions: MaxRegions}).
+		Build()
+	if err != nil || len(expr.RegionNumbers) != MaxRegions {
+		t.Errorf("Build() of MaxRegions regions = %v, %v", expr, err)
+	}
+	if expr, err := NewTable("t").
+		Timestamp("ts", ColumnDataType_TIMESTAMP_MILLISECOND).
+		Options(TableOptions{Regions: MaxRegions + 1}).
+		Build(); err == nil {
+		t.Errorf("Build() of MaxRegions+1 regions = %v, want an error", expr)
+	}
+}
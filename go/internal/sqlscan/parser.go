@@ -0,0 +1,135 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlscan
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Parser is a cursor over the tokens of a statement.
+type Parser struct {
+	toks []Token
+	i    int
+}
+
+// NewParser scans src and returns a cursor at its first token.
+func NewParser(src string) (*Parser, error) {
+	toks, err := Scan(src)
+	if err != nil {
+		return nil, err
+	}
+	return &Parser{toks: toks}, nil
+}
+
+// Peek returns the current token.
+func (p *Parser) Peek() Token {
+	return p.PeekN(0)
+}
+
+// PeekN returns the token n tokens after the current one.
+func (p *Parser) PeekN(n int) Token {
+	if p.i+n >= len(p.toks) {
+		return p.toks[len(p.toks)-1]
+	}
+	return p.toks[p.i+n]
+}
+
+// Next returns the current token and advances past it.
+func (p *Parser) Next() Token {
+	t := p.Peek()
+	if t.Kind != EOF {
+		p.i++
+	}
+	return t
+}
+
+// Keyword advances past the keywords kws if they are the next tokens.
+func (p *Parser) Keyword(kws ...string) bool {
+	for n, kw := range kws {
+		if !p.PeekN(n).Is(kw) {
+			return false
+		}
+	}
+	p.i += len(kws)
+	return true
+}
+
+// Symbol advances past the symbol s if it is the current token.
+func (p *Parser) Symbol(s string) bool {
+	if t := p.Peek(); t.Kind == Symbol && t.Text == s {
+		p.i++
+		return true
+	}
+	return false
+}
+
+// ExpectKeyword is like Keyword but fails if the keywords are missing.
+func (p *Parser) ExpectKeyword(kws ...string) error {
+	if !p.Keyword(kws...) {
+		return p.Errorf("expect %s", strings.ToUpper(strings.Join(kws, " ")))
+	}
+	return nil
+}
+
+// ExpectSymbol is like Symbol but fails if the symbol is missing.
+func (p *Parser) ExpectSymbol(s string) error {
+	if !p.Symbol(s) {
+		return p.Errorf("expect %q", s)
+	}
+	return nil
+}
+
+// Ident returns the current identifier, quoted or not, and advances past
+// it.
+func (p *Parser) Ident() (string, error) {
+	t := p.Peek()
+	if t.Kind != Ident && t.Kind != QuotedIdent {
+		return "", p.Errorf("expect identifier")
+	}
+	p.i++
+	return t.Text, nil
+}
+
+// ObjectName returns the identifiers of a dotted name, like
+// catalog.schema.table, and advances past them.
+func (p *Parser) ObjectName() ([]string, error) {
+	var parts []string
+	for {
+		part, err := p.Ident()
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, part)
+		if !p.Symbol(".") {
+			return parts, nil
+		}
+	}
+}
+
+// End fails unless only an optional semicolon is left.
+func (p *Parser) End() error {
+	p.Symbol(";")
+	if p.Peek().Kind != EOF {
+		return p.Errorf("unexpected trailing input")
+	}
+	return nil
+}
+
+// Errorf returns an error located at the current token.
+func (p *Parser) Errorf(format string, args ...any) error {
+	t := p.Peek()
+	return fmt.Errorf("%s at offset %d near %s", fmt.Sprintf(format, args...), t.Pos, t)
+}
@@ -0,0 +1,218 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sqlscan splits SQL text into tokens, and provides the token
+// cursor the hand-written SQL parsers of the module are built on.
+package sqlscan
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Kind is the kind of a token.
+type Kind int
+
+const (
+	// EOF ends every token list.
+	EOF Kind = iota
+	// Ident is a bare identifier or keyword, like SELECT or cpu.
+	Ident
+	// QuotedIdent is an identifier quoted with double quotes or
+	// backquotes; Text holds it unquoted.
+	QuotedIdent
+	// String is a single-quoted string literal; Text holds it unquoted.
+	String
+	// Number is an unsigned numeric literal, like 42, 0.5 or 1e3.
+	Number
+	// Symbol is an operator or punctuation, like ( , = or <=.
+	Symbol
+)
+
+func (k Kind) String() string {
+	switch k {
+	case EOF:
+		return "end of input"
+	case Ident, QuotedIdent:
+		return "identifier"
+	case String:
+		return "string"
+	case Number:
+		return "number"
+	default:
+		return "symbol"
+	}
+}
+
+// Token is a token of SQL text.
+type Token struct {
+	Kind Kind
+	Text string
+	// Pos is the byte offset of the token in the text.
+	Pos int
+}
+
+func (t Token) String() string {
+	switch t.Kind {
+	case EOF:
+		return t.Kind.String()
+	case String:
+		return "'" + strings.ReplaceAll(t.Text, "'", "''") + "'"
+	case QuotedIdent:
+		return `"` + strings.ReplaceAll(t.Text, `"`, `""`) + `"`
+	default:
+		return t.Text
+	}
+}
+
+// Is reports whether the token is the keyword kw, ignoring case. Quoted
+// identifiers are never keywords.
+func (t Token) Is(kw string) bool {
+	return t.Kind == Ident && strings.EqualFold(t.Text, kw)
+}
+
+// symbols are the multi-byte symbols, longest first.
+var symbols = []string{"<=", ">=", "<>", "!=", "::", "=>"}
+
+// Scan splits src into tokens, skipping white space and comments. The
+// last token is an EOF token.
+func Scan(src string) ([]Token, error) {
+	var toks []Token
+	i := 0
+	for {
+		for i < len(src) {
+			switch {
+			case isSpace(src[i]):
+				i++
+				continue
+			case strings.HasPrefix(src[i:], "--"):
+				if end := strings.IndexByte(src[i:], '\n'); end >= 0 {
+					i += end + 1
+				} else {
+					i = len(src)
+				}
+				continue
+			case strings.HasPrefix(src[i:], "/*"):
+				end := strings.Index(src[i+2:], "*/")
+				if end < 0 {
+					return nil, fmt.Errorf("unterminated comment at offset %d", i)
+				}
+				i += end + 4
+				continue
+			}
+			break
+		}
+		if i >= len(src) {
+			return append(toks, Token{Kind: EOF, Pos: i}), nil
+		}
+
+		start := i
+		c := src[i]
+		switch {
+		case isIdentStart(c):
+			for i < len(src) && isIdentPart(src[i]) {
+				i++
+			}
+			toks = append(toks, Token{Kind: Ident, Text: src[start:i], Pos: start})
+		case isDigit(c) || c == '.' && i+1 < len(src) && isDigit(src[i+1]):
+			i = scanNumber(src, i)
+			toks = append(toks, Token{Kind: Number, Text: src[start:i], Pos: start})
+		case c == '\'' || c == '"' || c == '`':
+			text, end, err := scanQuoted(src, i)
+			if err != nil {
+				return nil, err
+			}
+			kind := QuotedIdent
+			if c == '\'' {
+				kind = String
+			}
+			toks = append(toks, Token{Kind: kind, Text: text, Pos: start})
+			i = end
+		default:
+			text := src[i : i+1]
+			for _, s := range symbols {
+				if strings.HasPrefix(src[i:], s) {
+					text = s
+					break
+				}
+			}
+			if !strings.ContainsAny(text[:1], "()[],;.*=<>!+-/%:|&^~") {
+				return nil, fmt.Errorf("unexpected character %q at offset %d", c, i)
+			}
+			i += len(text)
+			toks = append(toks, Token{Kind: Symbol, Text: text, Pos: start})
+		}
+	}
+}
+
+func scanNumber(src string, i int) int {
+	for i < len(src) && isDigit(src[i]) {
+		i++
+	}
+	if i < len(src) && src[i] == '.' {
+		i++
+		for i < len(src) && isDigit(src[i]) {
+			i++
+		}
+	}
+	if i < len(src) && (src[i] == 'e' || src[i] == 'E') {
+		j := i + 1
+		if j < len(src) && (src[j] == '+' || src[j] == '-') {
+			j++
+		}
+		if j < len(src) && isDigit(src[j]) {
+			i = j
+			for i < len(src) && isDigit(src[i]) {
+				i++
+			}
+		}
+	}
+	return i
+}
+
+// scanQuoted scans the text quoted at src[i], a doubled quote standing for
+// itself, and returns it with the offset past the closing quote.
+func scanQuoted(src string, i int) (string, int, error) {
+	quote := src[i]
+	var b strings.Builder
+	for j := i + 1; j < len(src); j++ {
+		if src[j] != quote {
+			b.WriteByte(src[j])
+			continue
+		}
+		if j+1 < len(src) && src[j+1] == quote {
+			b.WriteByte(quote)
+			j++
+			continue
+		}
+		return b.String(), j + 1, nil
+	}
+	return "", 0, fmt.Errorf("unterminated %c quote at offset %d", quote, i)
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isIdentStart(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c == '_' || c >= 0x80
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || isDigit(c)
+}
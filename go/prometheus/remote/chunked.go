@@ -0,0 +1,174 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// maxFrameBytes bounds the chunk data of a streamed frame, as the
+	// Prometheus server does.
+	maxFrameBytes = 1 << 20
+	// DefaultMaxFrameSize is the size of the largest frame a
+	// ChunkedResponseReader accepts by default, that of Prometheus.
+	DefaultMaxFrameSize = 50e6
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// frameWriter writes the frames of a STREAMED_XOR_CHUNKS response: the
+// uvarint size of the message, its big-endian CRC32 Castagnoli checksum
+// and the message.
+type frameWriter struct {
+	w     io.Writer
+	flush func()
+	// written is set once a frame has been written.
+	written bool
+}
+
+func (w *frameWriter) write(resp *ChunkedReadResponse) error {
+	data, err := proto.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	header := make([]byte, binary.MaxVarintLen64+4)
+	n := binary.PutUvarint(header, uint64(len(data)))
+	binary.BigEndian.PutUint32(header[n:], crc32.Checksum(data, castagnoli))
+	w.written = true
+	if _, err := w.w.Write(header[:n+4]); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(data); err != nil {
+		return err
+	}
+	if w.flush != nil {
+		w.flush()
+	}
+	return nil
+}
+
+// ChunkedResponseReader reads the frames of a STREAMED_XOR_CHUNKS remote
+// read response.
+type ChunkedResponseReader struct {
+	r       *bufio.Reader
+	maxSize uint64
+}
+
+// NewChunkedResponseReader returns a reader of the frames of r, accepting
+// frames of up to maxSize bytes, DefaultMaxFrameSize if zero.
+func NewChunkedResponseReader(r io.Reader, maxSize int) *ChunkedResponseReader {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxFrameSize
+	}
+	return &ChunkedResponseReader{r: bufio.NewReader(r), maxSize: uint64(maxSize)}
+}
+
+// Next returns the next frame, io.EOF once the response is over.
+func (r *ChunkedResponseReader) Next() (*ChunkedReadResponse, error) {
+	size, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return nil, err
+	}
+	if size > r.maxSize {
+		return nil, fmt.Errorf("frame of %d bytes exceeds the limit of %d", size, r.maxSize)
+	}
+	buf := make([]byte, 4+size)
+	if _, err := io.ReadFull(r.r, buf); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	checksum, data := binary.BigEndian.Uint32(buf), buf[4:]
+	if crc32.Checksum(data, castagnoli) != checksum {
+		return nil, fmt.Errorf("frame checksum mismatch: got %08x, want %08x",
+			crc32.Checksum(data, castagnoli), checksum)
+	}
+	resp := &ChunkedReadResponse{}
+	if err := proto.Unmarshal(data, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// chunkSeries encodes the samples of series as XOR chunks, skipping series
+// without samples. A series is split in parts of up to maxFrameBytes of
+// chunk data, to be streamed a frame each. Labels and series are sorted as
+// the TSDB does.
+func chunkSeries(series []*TimeSeries) []*ChunkedSeries {
+	sorted := make([]*TimeSeries, len(series))
+	labels := make(map[*TimeSeries][]*Label, len(series))
+	for i, s := range series {
+		sorted[i] = s
+		labels[s] = sortLabels(s.GetLabels())
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return CompareLabels(labels[sorted[i]], labels[sorted[j]]) < 0
+	})
+
+	parts := make([]*ChunkedSeries, 0, len(sorted))
+	for _, s := range sorted {
+		samples := s.GetSamples()
+		if len(samples) == 0 {
+			continue
+		}
+		current := &ChunkedSeries{Labels: labels[s]}
+		size := 0
+		for _, chunk := range EncodeXORChunks(samples) {
+			if size > 0 && size+len(chunk.Data) > maxFrameBytes {
+				parts = append(parts, current)
+				current, size = &ChunkedSeries{Labels: current.Labels}, 0
+			}
+			current.Chunks = append(current.Chunks, chunk)
+			size += len(chunk.Data)
+		}
+		parts = append(parts, current)
+	}
+	return parts
+}
+
+// sortLabels returns labels sorted by name.
+func sortLabels(labels []*Label) []*Label {
+	sorted := append([]*Label(nil), labels...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].GetName() < sorted[j].GetName()
+	})
+	return sorted
+}
+
+// CompareLabels orders label sets sorted by name the way the TSDB orders
+// series. It returns a negative number if a sorts first, a positive one if
+// b does and 0 if they are equal.
+func CompareLabels(a, b []*Label) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if c := strings.Compare(a[i].GetName(), b[i].GetName()); c != 0 {
+			return c
+		}
+		if c := strings.Compare(a[i].GetValue(), b[i].GetValue()); c != 0 {
+			return c
+		}
+	}
+	return len(a) - len(b)
+}
@@ -0,0 +1,284 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/proto"
+)
+
+// The headers and versions of the remote storage protocols.
+const (
+	WriteVersionHeader = "X-Prometheus-Remote-Write-Version"
+	ReadVersionHeader  = "X-Prometheus-Remote-Read-Version"
+	WriteVersion       = "0.1.0"
+	ReadVersion        = "0.1.0"
+
+	// ProtobufContentType is the content type of snappy compressed
+	// WriteRequests, ReadRequests and ReadResponses.
+	ProtobufContentType = "application/x-protobuf"
+	// StreamedContentType is the content type of STREAMED_XOR_CHUNKS read
+	// responses, not compressed.
+	StreamedContentType = "application/x-streamed-protobuf; proto=prometheus.ChunkedReadResponse"
+)
+
+// MaxRequestSize bounds the decompressed size of the requests the handlers
+// accept.
+const MaxRequestSize = 32 << 20
+
+// ErrInvalidRequest is wrapped by the errors of the requests the handlers
+// reject as malformed. Writers and Readers wrap it for the requests they
+// cannot serve, which the handlers then answer with 400 Bad Request rather
+// than 500 Internal Server Error, telling senders not to retry them.
+var ErrInvalidRequest = errors.New("invalid remote storage request")
+
+var errMethodNotAllowed = errors.New("method not allowed")
+
+// Writer stores the series of remote write requests.
+type Writer interface {
+	Write(ctx context.Context, req *WriteRequest) error
+}
+
+// WriterFunc adapts a function to a Writer.
+type WriterFunc func(ctx context.Context, req *WriteRequest) error
+
+// Write calls f.
+func (f WriterFunc) Write(ctx context.Context, req *WriteRequest) error {
+	return f(ctx, req)
+}
+
+// Reader answers the queries of remote read requests with the matching
+// series and their samples in the query range.
+type Reader interface {
+	Read(ctx context.Context, query *Query) (*QueryResult, error)
+}
+
+// ReaderFunc adapts a function to a Reader.
+type ReaderFunc func(ctx context.Context, query *Query) (*QueryResult, error)
+
+// Read calls f.
+func (f ReaderFunc) Read(ctx context.Context, query *Query) (*QueryResult, error) {
+	return f(ctx, query)
+}
+
+// ChunkReader is implemented by the Readers able to answer queries with
+// encoded chunks. It sends the series one after the other, sorted, a
+// series possibly split across several sends.
+//
+// The read handler uses it for STREAMED_XOR_CHUNKS responses, and encodes
+// the samples of Read otherwise.
+type ChunkReader interface {
+	ReadChunks(ctx context.Context, query *Query, send func(*ChunkedSeries) error) error
+}
+
+// NewWriteHandler returns the handler of the remote write endpoint, which
+// passes the snappy compressed WriteRequests POSTed to it to w and answers
+// 204 No Content once written.
+func NewWriteHandler(w Writer) http.Handler {
+	return &writeHandler{writer: w}
+}
+
+type writeHandler struct {
+	writer Writer
+}
+
+func (h *writeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req := &WriteRequest{}
+	if err := decodeRequest(r, WriteVersionHeader, "prometheus.WriteRequest", req); err != nil {
+		httpError(w, err)
+		return
+	}
+	if err := h.writer.Write(r.Context(), req); err != nil {
+		httpError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// NewReadHandler returns the handler of the remote read endpoint, which
+// answers the snappy compressed ReadRequests POSTed to it with r.
+//
+// The response type is the first of the accepted ones the handler
+// supports, SAMPLES if none is given. STREAMED_XOR_CHUNKS responses encode
+// the samples as XOR chunks unless r is a ChunkReader.
+func NewReadHandler(r Reader) http.Handler {
+	return &readHandler{reader: r}
+}
+
+type readHandler struct {
+	reader Reader
+}
+
+func (h *readHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req := &ReadRequest{}
+	if err := decodeRequest(r, ReadVersionHeader, "prometheus.ReadRequest", req); err != nil {
+		httpError(w, err)
+		return
+	}
+	responseType, err := negotiate(req.GetAcceptedResponseTypes())
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	switch responseType {
+	case ReadRequest_SAMPLES:
+		h.serveSamples(r.Context(), w, req)
+	case ReadRequest_STREAMED_XOR_CHUNKS:
+		h.serveChunks(r.Context(), w, req)
+	}
+}
+
+// negotiate returns the first response type of accepted the handler
+// supports.
+func negotiate(accepted []ReadRequest_ResponseType) (ReadRequest_ResponseType, error) {
+	if len(accepted) == 0 {
+		return ReadRequest_SAMPLES, nil
+	}
+	for _, t := range accepted {
+		switch t {
+		case ReadRequest_SAMPLES, ReadRequest_STREAMED_XOR_CHUNKS:
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: none of the response types %v is supported", ErrInvalidRequest, accepted)
+}
+
+func (h *readHandler) serveSamples(ctx context.Context, w http.ResponseWriter, req *ReadRequest) {
+	resp := &ReadResponse{Results: make([]*QueryResult, len(req.GetQueries()))}
+	for i, query := range req.GetQueries() {
+		result, err := h.reader.Read(ctx, query)
+		if err != nil {
+			httpError(w, err)
+			return
+		}
+		if result == nil {
+			result = &QueryResult{}
+		}
+		resp.Results[i] = result
+	}
+	data, err := proto.Marshal(resp)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", ProtobufContentType)
+	w.Header().Set("Content-Encoding", "snappy")
+	_, _ = w.Write(snappy.Encode(nil, data))
+}
+
+func (h *readHandler) serveChunks(ctx context.Context, w http.ResponseWriter, req *ReadRequest) {
+	w.Header().Set("Content-Type", StreamedContentType)
+	frames := &frameWriter{w: w}
+	if f, ok := w.(http.Flusher); ok {
+		frames.flush = f.Flush
+	}
+	for i, query := range req.GetQueries() {
+		send := func(series *ChunkedSeries) error {
+			return frames.write(&ChunkedReadResponse{ChunkedSeries: []*ChunkedSeries{series}, QueryIndex: int64(i)})
+		}
+		var err error
+		if chunks, ok := h.reader.(ChunkReader); ok {
+			err = chunks.ReadChunks(ctx, query, send)
+		} else {
+			err = readChunks(ctx, h.reader, query, send)
+		}
+		if err == nil {
+			continue
+		}
+		if !frames.written {
+			w.Header().Del("Content-Type")
+			httpError(w, err)
+			return
+		}
+		// The status is sent: abort the response, for the client not to
+		// take it as complete.
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// readChunks answers query with the samples of r encoded as XOR chunks.
+func readChunks(ctx context.Context, r Reader, query *Query, send func(*ChunkedSeries) error) error {
+	result, err := r.Read(ctx, query)
+	if err != nil {
+		return err
+	}
+	for _, series := range chunkSeries(result.GetTimeseries()) {
+		if err := send(series); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeRequest reads the snappy compressed protobuf message POSTed in r.
+func decodeRequest(r *http.Request, versionHeader, messageName string, m proto.Message) error {
+	if r.Method != http.MethodPost {
+		return errMethodNotAllowed
+	}
+	if version := r.Header.Get(versionHeader); version != "" && !strings.HasPrefix(version, "0.") {
+		return fmt.Errorf("%w: unsupported %s %q", ErrInvalidRequest, versionHeader, version)
+	}
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		mediaType, params, err := mime.ParseMediaType(contentType)
+		if err != nil || mediaType != ProtobufContentType || params["proto"] != "" && params["proto"] != messageName {
+			return fmt.Errorf("%w: unsupported content type %q", ErrInvalidRequest, contentType)
+		}
+	}
+	if encoding := r.Header.Get("Content-Encoding"); encoding != "" && encoding != "snappy" {
+		return fmt.Errorf("%w: unsupported content encoding %q", ErrInvalidRequest, encoding)
+	}
+
+	compressed, err := io.ReadAll(io.LimitReader(r.Body, int64(snappy.MaxEncodedLen(MaxRequestSize))+1))
+	if err != nil {
+		return err
+	}
+	size, err := snappy.DecodedLen(compressed)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+	}
+	if size > MaxRequestSize {
+		return fmt.Errorf("%w: request of %d bytes exceeds the limit of %d", ErrInvalidRequest, size, MaxRequestSize)
+	}
+	data, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+	}
+	if err := proto.Unmarshal(data, m); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+	}
+	return nil
+}
+
+// httpError answers err, with 400 Bad Request if it wraps
+// ErrInvalidRequest.
+func httpError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrInvalidRequest):
+		code = http.StatusBadRequest
+	case err == errMethodNotAllowed:
+		w.Header().Set("Allow", http.MethodPost)
+		code = http.StatusMethodNotAllowed
+	}
+	http.Error(w, err.Error(), code)
+}
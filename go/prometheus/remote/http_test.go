@@ -0,0 +1,234 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/proto"
+)
+
+// post serves a POST of body to h, with the headers of alternating names
+// and values.
+func post(h http.Handler, body []byte, header ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	for i := 0; i < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func encode(t *testing.T, m proto.Message) []byte {
+	t.Helper()
+	data, err := proto.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return snappy.Encode(nil, data)
+}
+
+func series(name string, samples ...*Sample) *TimeSeries {
+	return &TimeSeries{
+		Labels:  []*Label{{Name: "job", Value: "j"}, {Name: "__name__", Value: name}},
+		Samples: samples,
+	}
+}
+
+func TestWriteHandler(t *testing.T) {
+	req := &WriteRequest{Timeseries: []*TimeSeries{series("up", &Sample{Value: 1, Timestamp: 1})}}
+	body := encode(t, req)
+	tests := []struct {
+		name   string
+		method string
+		body   []byte
+		header []string
+		err    error
+		want   int
+	}{
+		{
+			name:   "written",
+			body:   body,
+			header: []string{"Content-Type", ProtobufContentType, "Content-Encoding", "snappy", WriteVersionHeader, WriteVersion},
+			want:   http.StatusNoContent,
+		},
+		{name: "no headers", body: body, want: http.StatusNoContent},
+		{name: "content type proto", body: body, header: []string{"Content-Type", ProtobufContentType + ";proto=prometheus.WriteRequest"}, want: http.StatusNoContent},
+		{name: "get", method: http.MethodGet, want: http.StatusMethodNotAllowed},
+		{name: "version", body: body, header: []string{WriteVersionHeader, "2.0.0"}, want: http.StatusBadRequest},
+		{name: "content type", body: body, header: []string{"Content-Type", "application/json"}, want: http.StatusBadRequest},
+		{name: "other message", body: body, header: []string{"Content-Type", ProtobufContentType + ";proto=io.prometheus.write.v2.Request"}, want: http.StatusBadRequest},
+		{name: "encoding", body: body, header: []string{"Content-Encoding", "gzip"}, want: http.StatusBadRequest},
+		{name: "not snappy", body: []byte("\xff\xff\xff\xff\xff"), want: http.StatusBadRequest},
+		{name: "not protobuf", body: snappy.Encode(nil, []byte{0xff}), want: http.StatusBadRequest},
+		{name: "rejected", body: body, err: fmt.Errorf("%w: out of order", ErrInvalidRequest), want: http.StatusBadRequest},
+		{name: "failed", body: body, err: errors.New("unavailable"), want: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *WriteRequest
+			h := NewWriteHandler(WriterFunc(func(_ context.Context, req *WriteRequest) error {
+				got = req
+				return tt.err
+			}))
+			var w *httptest.ResponseRecorder
+			if tt.method == http.MethodGet {
+				w = httptest.NewRecorder()
+				h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+				if allow := w.Header().Get("Allow"); allow != http.MethodPost {
+					t.Errorf("Allow = %q, want POST", allow)
+				}
+			} else {
+				w = post(h, tt.body, tt.header...)
+			}
+			if w.Code != tt.want {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if tt.want == http.StatusNoContent && !proto.Equal(got, req) {
+				t.Errorf("wrote %v, want %v", got, req)
+			}
+		})
+	}
+}
+
+// staticReader answers every query with its series, or fails with err.
+type staticReader struct {
+	series []*TimeSeries
+	err    error
+}
+
+func (r *staticReader) Read(context.Context, *Query) (*QueryResult, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	return &QueryResult{Timeseries: r.series}, nil
+}
+
+func TestReadHandlerSamples(t *testing.T) {
+	reader := &staticReader{series: []*TimeSeries{series("up", &Sample{Value: 1, Timestamp: 1})}}
+	req := &ReadRequest{Queries: []*Query{{StartTimestampMs: 0, EndTimestampMs: 10}, {StartTimestampMs: 10, EndTimestampMs: 20}}}
+	w := post(NewReadHandler(reader), encode(t, req), ReadVersionHeader, ReadVersion)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if got := w.Header().Get("Content-Type"); got != ProtobufContentType {
+		t.Errorf("Content-Type = %q, want %q", got, ProtobufContentType)
+	}
+	if got := w.Header().Get("Content-Encoding"); got != "snappy" {
+		t.Errorf("Content-Encoding = %q, want snappy", got)
+	}
+	data, err := snappy.Decode(nil, w.Body.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := &ReadResponse{}
+	if err := proto.Unmarshal(data, got); err != nil {
+		t.Fatal(err)
+	}
+	result := &QueryResult{Timeseries: reader.series}
+	if want := (&ReadResponse{Results: []*QueryResult{result, result}}); !proto.Equal(got, want) {
+		t.Errorf("response %v, want %v", got, want)
+	}
+}
+
+func TestReadHandlerChunks(t *testing.T) {
+	reader := &staticReader{series: []*TimeSeries{
+		series("up", &Sample{Value: 1, Timestamp: 1}, &Sample{Value: 0, Timestamp: 2}),
+		series("down"),
+		series("cpu", &Sample{Value: 0.5, Timestamp: 1}),
+	}}
+	req := &ReadRequest{
+		Queries:               []*Query{{EndTimestampMs: 10}, {EndTimestampMs: 20}},
+		AcceptedResponseTypes: []ReadRequest_ResponseType{ReadRequest_STREAMED_XOR_CHUNKS, ReadRequest_SAMPLES},
+	}
+	w := post(NewReadHandler(reader), encode(t, req))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if got := w.Header().Get("Content-Type"); got != StreamedContentType {
+		t.Errorf("Content-Type = %q, want %q", got, StreamedContentType)
+	}
+
+	type frame struct {
+		query  int64
+		series *TimeSeries
+	}
+	var got []frame
+	r := NewChunkedResponseReader(w.Body, 0)
+	for {
+		resp, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, chunked := range resp.ChunkedSeries {
+			s, err := chunked.TimeSeries()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, frame{resp.QueryIndex, s})
+		}
+	}
+	// Series are sorted by their sorted labels, those without samples
+	// left out.
+	sorted := func(s *TimeSeries) *TimeSeries {
+		return &TimeSeries{Labels: sortLabels(s.Labels), Samples: s.Samples}
+	}
+	cpu, up := sorted(reader.series[2]), sorted(reader.series[0])
+	want := []frame{{0, cpu}, {0, up}, {1, cpu}, {1, up}}
+	if len(got) != len(want) {
+		t.Fatalf("%d series, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].query != want[i].query || !proto.Equal(got[i].series, want[i].series) {
+			t.Errorf("series %d = query %d %v, want query %d %v", i, got[i].query, got[i].series, want[i].query, want[i].series)
+		}
+	}
+}
+
+func TestReadHandlerErrors(t *testing.T) {
+	query := []*Query{{EndTimestampMs: 10}}
+	tests := []struct {
+		name     string
+		accepted []ReadRequest_ResponseType
+		err      error
+		want     int
+	}{
+		{name: "response type", accepted: []ReadRequest_ResponseType{7}, want: http.StatusBadRequest},
+		{name: "samples rejected", err: fmt.Errorf("%w: too many series", ErrInvalidRequest), want: http.StatusBadRequest},
+		{name: "samples failed", err: errors.New("unavailable"), want: http.StatusInternalServerError},
+		{name: "chunks failed", accepted: []ReadRequest_ResponseType{ReadRequest_STREAMED_XOR_CHUNKS}, err: errors.New("unavailable"), want: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &ReadRequest{Queries: query, AcceptedResponseTypes: tt.accepted}
+			w := post(NewReadHandler(&staticReader{err: tt.err}), encode(t, req))
+			if w.Code != tt.want {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,524 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrClosed is returned for appends to a closed QueueManager.
+var ErrClosed = errors.New("queue manager is closed")
+
+// QueueOptions configures a QueueManager. Zero fields take their default.
+type QueueOptions struct {
+	// Client sends the requests, http.DefaultClient by default.
+	Client *http.Client
+	// Header is added to every request, to authenticate for instance.
+	Header http.Header
+	// Timeout bounds every request, 30 seconds by default.
+	Timeout time.Duration
+	// Capacity is the number of series every shard queues, 2500 by
+	// default. Appends block while the shard of a series is full.
+	Capacity int
+	// MaxSamplesPerSend sends the batch of a shard once it holds that many
+	// samples, 2000 by default.
+	MaxSamplesPerSend int
+	// BatchSendDeadline sends the batch of a shard that long after its
+	// first series, 5 seconds by default.
+	BatchSendDeadline time.Duration
+	// MinShards and MaxShards bound the number of shards, 1 and 50 by
+	// default. The queue starts with MinShards.
+	MinShards int
+	MaxShards int
+	// ScaleInterval is the period the number of shards is adjusted at, 10
+	// seconds by default.
+	ScaleInterval time.Duration
+	// MaxAttempts is the number of attempts to send a batch failing with a
+	// 5xx or 429 status or without response, 0 to retry until the queue is
+	// closed. Batches rejected with other statuses are given up at once.
+	MaxAttempts int
+	// InitialBackoff is the wait before the second attempt, 30 milliseconds
+	// by default, doubled after every attempt up to MaxBackoff, 5 seconds by
+	// default. A Retry-After header replaces the backoff of 429 responses.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// OnError is called with the errors of the batches given up.
+	OnError func(err error)
+}
+
+func (o *QueueOptions) withDefaults() QueueOptions {
+	opts := *o
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 30 * time.Second
+	}
+	if opts.Capacity <= 0 {
+		opts.Capacity = 2500
+	}
+	if opts.MaxSamplesPerSend <= 0 {
+		opts.MaxSamplesPerSend = 2000
+	}
+	if opts.BatchSendDeadline <= 0 {
+		opts.BatchSendDeadline = 5 * time.Second
+	}
+	if opts.MinShards <= 0 {
+		opts.MinShards = 1
+	}
+	if opts.MaxShards < opts.MinShards {
+		opts.MaxShards = 50
+		if opts.MaxShards < opts.MinShards {
+			opts.MaxShards = opts.MinShards
+		}
+	}
+	if opts.ScaleInterval <= 0 {
+		opts.ScaleInterval = 10 * time.Second
+	}
+	if opts.InitialBackoff <= 0 {
+		opts.InitialBackoff = 30 * time.Millisecond
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 5 * time.Second
+	}
+	return opts
+}
+
+// QueueStats are the counters of a QueueManager.
+type QueueStats struct {
+	Shards int
+	// PendingSamples are the samples appended and neither sent nor given up
+	// yet.
+	PendingSamples int64
+	SentSamples    int64
+	FailedSamples  int64
+	// RetriedSamples counts the samples of every failed attempt followed by
+	// another.
+	RetriedSamples int64
+}
+
+// QueueManager sends series to a remote write endpoint, like the queue
+// manager of Prometheus. Series are queued to shards by label set, which
+// keeps the samples of a series in order, and every shard sends its
+// batches one after the other. The number of shards follows the rate of
+// appends and the latency of sends. It is safe for concurrent use.
+type QueueManager struct {
+	url  string
+	opts QueueOptions
+
+	// ctx is canceled when Close gives up on the pending samples.
+	ctx       context.Context
+	cancel    context.CancelFunc
+	quit      chan struct{}
+	scaled    chan struct{}
+	closeOnce sync.Once
+
+	// mu guards the shards. It is only held for writing to replace them,
+	// appends holding it for reading to queue series without blocking.
+	mu     sync.RWMutex
+	shards []*shard
+	closed bool
+
+	pending int64
+	sent    int64
+	failed  int64
+	retried int64
+	// in, out and busy are the samples appended, the samples done with and
+	// the time spent sending since the last scaling.
+	in   int64
+	out  int64
+	busy int64
+}
+
+type shard struct {
+	queue chan *TimeSeries
+	done  chan struct{}
+	// start is closed once the series of the shards replaced by this one
+	// are sent, nil if there were none.
+	start <-chan struct{}
+}
+
+// NewQueueManager returns a queue manager sending to the remote write
+// endpoint at url.
+func NewQueueManager(url string, opts QueueOptions) *QueueManager {
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &QueueManager{
+		url:    url,
+		opts:   opts.withDefaults(),
+		ctx:    ctx,
+		cancel: cancel,
+		quit:   make(chan struct{}),
+		scaled: make(chan struct{}),
+	}
+	m.shards = m.startShards(m.opts.MinShards, nil)
+	go m.scale()
+	return m
+}
+
+// Append queues series, waiting while the queue of one is full until ctx
+// is done.
+func (m *QueueManager) Append(ctx context.Context, series ...*TimeSeries) error {
+	for _, s := range series {
+		hash := labelsHash(s.GetLabels())
+		backoff := time.Millisecond
+		for {
+			queued, err := m.enqueue(s, hash)
+			if err != nil {
+				return err
+			}
+			if queued {
+				break
+			}
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			if backoff *= 2; backoff > 100*time.Millisecond {
+				backoff = 100 * time.Millisecond
+			}
+		}
+	}
+	return nil
+}
+
+// enqueue queues s to its shard unless the queue is full.
+func (m *QueueManager) enqueue(s *TimeSeries, hash uint64) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return false, ErrClosed
+	}
+	select {
+	case m.shards[hash%uint64(len(m.shards))].queue <- s:
+		n := int64(len(s.GetSamples()))
+		atomic.AddInt64(&m.pending, n)
+		atomic.AddInt64(&m.in, n)
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// Stats returns the current counters.
+func (m *QueueManager) Stats() QueueStats {
+	m.mu.RLock()
+	shards := len(m.shards)
+	m.mu.RUnlock()
+	return QueueStats{
+		Shards:         shards,
+		PendingSamples: atomic.LoadInt64(&m.pending),
+		SentSamples:    atomic.LoadInt64(&m.sent),
+		FailedSamples:  atomic.LoadInt64(&m.failed),
+		RetriedSamples: atomic.LoadInt64(&m.retried),
+	}
+}
+
+// Close sends the queued series and waits until they are sent or given
+// up. Once ctx is done, the remaining ones are given up. Later appends
+// fail with ErrClosed.
+func (m *QueueManager) Close(ctx context.Context) error {
+	var err error
+	m.closeOnce.Do(func() {
+		// Stop scaling first: a reshard waits for the shards to be sent.
+		close(m.quit)
+		select {
+		case <-m.scaled:
+		case <-ctx.Done():
+			m.cancel()
+			<-m.scaled
+		}
+
+		m.mu.Lock()
+		m.closed = true
+		shards := m.shards
+		m.mu.Unlock()
+		err = m.stopShards(ctx, shards)
+		m.cancel()
+	})
+	return err
+}
+
+// startShards starts n shards, which start sending once start is closed
+// unless it is nil.
+func (m *QueueManager) startShards(n int, start <-chan struct{}) []*shard {
+	shards := make([]*shard, n)
+	for i := range shards {
+		shards[i] = &shard{queue: make(chan *TimeSeries, m.opts.Capacity), done: make(chan struct{}), start: start}
+		go m.run(shards[i])
+	}
+	return shards
+}
+
+// stopShards closes the queues of shards and waits for them to be sent.
+// Once ctx is done, the ongoing sends are canceled.
+func (m *QueueManager) stopShards(ctx context.Context, shards []*shard) error {
+	for _, s := range shards {
+		close(s.queue)
+	}
+	for _, s := range shards {
+		select {
+		case <-s.done:
+		case <-ctx.Done():
+			m.cancel()
+			for _, s := range shards {
+				<-s.done
+			}
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// run batches the series queued to s until its queue is closed.
+func (m *QueueManager) run(s *shard) {
+	defer close(s.done)
+	if s.start != nil {
+		select {
+		case <-s.start:
+		case <-m.ctx.Done():
+		}
+	}
+	var batch []*TimeSeries
+	var samples int
+	var deadline <-chan time.Time
+	send := func() {
+		m.send(batch, samples)
+		batch, samples, deadline = nil, 0, nil
+	}
+	for {
+		select {
+		case series, ok := <-s.queue:
+			if !ok {
+				if len(batch) > 0 {
+					send()
+				}
+				return
+			}
+			if len(batch) == 0 {
+				deadline = time.After(m.opts.BatchSendDeadline)
+			}
+			batch = append(batch, series)
+			if samples += len(series.GetSamples()); samples >= m.opts.MaxSamplesPerSend {
+				send()
+			}
+		case <-deadline:
+			send()
+		}
+	}
+}
+
+// send sends a batch with the retry policy of the queue.
+func (m *QueueManager) send(batch []*TimeSeries, samples int) {
+	n := int64(samples)
+	defer func() {
+		atomic.AddInt64(&m.pending, -n)
+		atomic.AddInt64(&m.out, n)
+	}()
+	data, err := proto.Marshal(&WriteRequest{Timeseries: batch})
+	if err != nil {
+		m.fail(err, n)
+		return
+	}
+	body := snappy.Encode(nil, data)
+
+	backoff := m.opts.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+		err := m.post(body)
+		atomic.AddInt64(&m.busy, int64(time.Since(start)))
+		if err == nil {
+			atomic.AddInt64(&m.sent, n)
+			return
+		}
+		var recoverable *recoverableError
+		if !errors.As(err, &recoverable) || m.opts.MaxAttempts > 0 && attempt >= m.opts.MaxAttempts || m.ctx.Err() != nil {
+			m.fail(err, n)
+			return
+		}
+		atomic.AddInt64(&m.retried, n)
+		wait := backoff
+		if recoverable.retryAfter > 0 {
+			wait = recoverable.retryAfter
+		}
+		select {
+		case <-time.After(wait):
+		case <-m.ctx.Done():
+			m.fail(err, n)
+			return
+		}
+		if backoff *= 2; backoff > m.opts.MaxBackoff {
+			backoff = m.opts.MaxBackoff
+		}
+	}
+}
+
+func (m *QueueManager) fail(err error, samples int64) {
+	atomic.AddInt64(&m.failed, samples)
+	if m.opts.OnError != nil {
+		m.opts.OnError(err)
+	}
+}
+
+// recoverableError is the error of an attempt worth retrying.
+type recoverableError struct {
+	err        error
+	retryAfter time.Duration
+}
+
+func (e *recoverableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *recoverableError) Unwrap() error {
+	return e.err
+}
+
+// post sends a compressed WriteRequest.
+func (m *QueueManager) post(body []byte) error {
+	ctx, cancel := context.WithTimeout(m.ctx, m.opts.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, values := range m.opts.Header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", ProtobufContentType)
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set(WriteVersionHeader, WriteVersion)
+
+	resp, err := m.opts.Client.Do(req)
+	if err != nil {
+		return &recoverableError{err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("remote write to %s: %s: %s", m.url, resp.Status, bytes.TrimSpace(msg))
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return &recoverableError{err: err, retryAfter: retryAfter(resp.Header.Get("Retry-After"))}
+	case resp.StatusCode/100 == 5:
+		return &recoverableError{err: err}
+	}
+	return err
+}
+
+// retryAfter parses a Retry-After header, in seconds or as an HTTP date.
+func retryAfter(header string) time.Duration {
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(header); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// scale adjusts the number of shards every ScaleInterval until Close.
+func (m *QueueManager) scale() {
+	defer close(m.scaled)
+	ticker := time.NewTicker(m.opts.ScaleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.quit:
+			return
+		case <-ticker.C:
+		}
+		m.mu.RLock()
+		current := len(m.shards)
+		m.mu.RUnlock()
+		if desired := m.desiredShards(current); desired != current {
+			m.reshard(desired)
+		}
+	}
+}
+
+// desiredShards returns the number of shards needed to send, within an
+// interval, the samples appended during the last one and those pending,
+// given the time a sample took to send. Changes of less than 30% are
+// ignored, to avoid flapping.
+func (m *QueueManager) desiredShards(current int) int {
+	in := atomic.SwapInt64(&m.in, 0)
+	out := atomic.SwapInt64(&m.out, 0)
+	busy := atomic.SwapInt64(&m.busy, 0)
+	if out == 0 {
+		return current
+	}
+	perSample := float64(busy) / float64(out)
+	work := perSample * float64(in+atomic.LoadInt64(&m.pending))
+	desired := int(math.Ceil(work / float64(m.opts.ScaleInterval)))
+	if desired < m.opts.MinShards {
+		desired = m.opts.MinShards
+	}
+	if desired > m.opts.MaxShards {
+		desired = m.opts.MaxShards
+	}
+	if low, high := float64(current)*0.7, float64(current)*1.3; float64(desired) > low && float64(desired) < high {
+		return current
+	}
+	return desired
+}
+
+// reshard replaces the shards by n new ones. The new shards queue the
+// appended series at once but only send them once the series queued to
+// the old ones are sent, so that the samples of a series stay in order.
+// The old shards are drained without holding mu, as sends may be retried
+// until Close.
+func (m *QueueManager) reshard(n int) {
+	start := make(chan struct{})
+	m.mu.Lock()
+	old := m.shards
+	m.shards = m.startShards(n, start)
+	m.mu.Unlock()
+	_ = m.stopShards(context.Background(), old)
+	close(start)
+}
+
+// labelsHash hashes a label set, regardless of the order of the labels.
+func labelsHash(labels []*Label) uint64 {
+	if !sort.SliceIsSorted(labels, func(i, j int) bool { return labels[i].GetName() < labels[j].GetName() }) {
+		labels = sortLabels(labels)
+	}
+	h := fnv.New64a()
+	for _, label := range labels {
+		_, _ = io.WriteString(h, label.GetName())
+		_, _ = h.Write([]byte{0xff})
+		_, _ = io.WriteString(h, label.GetValue())
+		_, _ = h.Write([]byte{0xff})
+	}
+	return h.Sum64()
+}
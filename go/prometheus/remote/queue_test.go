@@ -0,0 +1,397 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// receiver is a remote write endpoint recording the timestamps of the
+// samples of every series by name. It answers the first requests with
+// statuses, in turn.
+type receiver struct {
+	mu         sync.Mutex
+	statuses   []int
+	requests   int
+	header     http.Header
+	timestamps map[string][]int64
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	r.requests++
+	r.header = req.Header.Clone()
+	if len(r.statuses) > 0 {
+		code := r.statuses[0]
+		r.statuses = r.statuses[1:]
+		r.mu.Unlock()
+		http.Error(w, http.StatusText(code), code)
+		return
+	}
+	r.mu.Unlock()
+	NewWriteHandler(WriterFunc(func(_ context.Context, wr *WriteRequest) error {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		for _, ts := range wr.GetTimeseries() {
+			var name string
+			for _, label := range ts.GetLabels() {
+				if label.GetName() == "__name__" {
+					name = label.GetValue()
+				}
+			}
+			for _, sample := range ts.GetSamples() {
+				r.timestamps[name] = append(r.timestamps[name], sample.GetTimestamp())
+			}
+		}
+		return nil
+	})).ServeHTTP(w, req)
+}
+
+// newReceiver starts a receiver answering statuses first.
+func newReceiver(t *testing.T, statuses ...int) (*receiver, string) {
+	r := &receiver{statuses: statuses, timestamps: make(map[string][]int64)}
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return r, srv.URL
+}
+
+// checkReceived checks every one of the series s0 to s<series-1> was
+// received with the timestamps 0 to samples-1, in order.
+func (r *receiver) checkReceived(t *testing.T, series, samples int) {
+	t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.timestamps) != series {
+		t.Errorf("received %d series, want %d", len(r.timestamps), series)
+	}
+	for i := 0; i < series; i++ {
+		name := fmt.Sprintf("s%d", i)
+		got := r.timestamps[name]
+		if len(got) != samples {
+			t.Errorf("series %s: received %d samples, want %d", name, len(got), samples)
+			continue
+		}
+		for j, ts := range got {
+			if ts != int64(j) {
+				t.Errorf("series %s: sample %d has timestamp %d, out of order", name, j, ts)
+				break
+			}
+		}
+	}
+}
+
+// appendSamples appends samples samples to each of the series s0 to
+// s<series-1>, one sample per series at a time.
+func appendSamples(ctx context.Context, m *QueueManager, series, samples int) error {
+	for j := 0; j < samples; j++ {
+		batch := make([]*TimeSeries, series)
+		for i := range batch {
+			batch[i] = seriesAt(i, j)
+		}
+		if err := m.Append(ctx, batch...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// seriesAt returns the series s<i> of a sample at ts.
+func seriesAt(i, ts int) *TimeSeries {
+	return series(fmt.Sprintf("s%d", i), &Sample{Value: float64(ts), Timestamp: int64(ts)})
+}
+
+// fastOptions are queue options retrying at once and never rescaling.
+func fastOptions() QueueOptions {
+	return QueueOptions{
+		MaxSamplesPerSend: 7,
+		BatchSendDeadline: 5 * time.Millisecond,
+		ScaleInterval:     time.Hour,
+		InitialBackoff:    time.Millisecond,
+		MaxBackoff:        5 * time.Millisecond,
+	}
+}
+
+func closeQueue(t *testing.T, m *QueueManager) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := m.Close(ctx); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+}
+
+func TestQueueManagerSharding(t *testing.T) {
+	r, url := newReceiver(t)
+	opts := fastOptions()
+	opts.MinShards, opts.MaxShards = 4, 4
+	opts.Header = http.Header{"Authorization": {"Bearer token"}}
+	m := NewQueueManager(url, opts)
+	if err := appendSamples(context.Background(), m, 20, 30); err != nil {
+		t.Fatal(err)
+	}
+	closeQueue(t, m)
+	r.checkReceived(t, 20, 30)
+
+	want := QueueStats{Shards: 4, SentSamples: 600}
+	if got := m.Stats(); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name, value := range map[string]string{
+		"Authorization":    "Bearer token",
+		"Content-Type":     ProtobufContentType,
+		"Content-Encoding": "snappy",
+	} {
+		if got := r.header.Get(name); got != value {
+			t.Errorf("header %s = %q, want %q", name, got, value)
+		}
+	}
+	if err := m.Append(context.Background(), seriesAt(0, 30)); err != ErrClosed {
+		t.Errorf("Append() after Close = %v, want ErrClosed", err)
+	}
+}
+
+func TestQueueManagerRetry(t *testing.T) {
+	tests := []struct {
+		name        string
+		statuses    []int
+		maxAttempts int
+		want        QueueStats
+		errors      int
+	}{
+		{"recovered", []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}, 0,
+			QueueStats{Shards: 1, SentSamples: 5, RetriedSamples: 10}, 0},
+		{"attempts exhausted", []int{http.StatusInternalServerError, http.StatusInternalServerError}, 2,
+			QueueStats{Shards: 1, FailedSamples: 5, RetriedSamples: 5}, 1},
+		{"rejected", []int{http.StatusBadRequest}, 0,
+			QueueStats{Shards: 1, FailedSamples: 5}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, url := newReceiver(t, tt.statuses...)
+			opts := fastOptions()
+			// Close sends the samples as one batch.
+			opts.BatchSendDeadline = time.Hour
+			opts.MaxAttempts = tt.maxAttempts
+			var mu sync.Mutex
+			var errs []error
+			opts.OnError = func(err error) {
+				mu.Lock()
+				defer mu.Unlock()
+				errs = append(errs, err)
+			}
+			m := NewQueueManager(url, opts)
+			if err := appendSamples(context.Background(), m, 5, 1); err != nil {
+				t.Fatal(err)
+			}
+			closeQueue(t, m)
+			if got := m.Stats(); got != tt.want {
+				t.Errorf("Stats() = %+v, want %+v", got, tt.want)
+			}
+			if len(errs) != tt.errors {
+				t.Errorf("OnError called with %v, want %d errors", errs, tt.errors)
+			}
+		})
+	}
+}
+
+func TestQueueManagerClose(t *testing.T) {
+	r, url := newReceiver(t)
+	opts := fastOptions()
+	// Only Close sends the batch.
+	opts.BatchSendDeadline = time.Hour
+	m := NewQueueManager(url, opts)
+	if err := appendSamples(context.Background(), m, 3, 2); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.Stats().PendingSamples; got != 6 {
+		t.Errorf("PendingSamples = %d, want 6", got)
+	}
+	closeQueue(t, m)
+	r.checkReceived(t, 3, 2)
+	if err := m.Close(context.Background()); err != nil {
+		t.Errorf("second Close() = %v", err)
+	}
+}
+
+func TestQueueManagerCloseGivesUp(t *testing.T) {
+	// The endpoint is down, and sends are retried until Close gives up.
+	_, url := newReceiver(t, repeat(http.StatusServiceUnavailable, 1<<20)...)
+	m := NewQueueManager(url, fastOptions())
+	if err := appendSamples(context.Background(), m, 3, 2); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := m.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Close() = %v, want DeadlineExceeded", err)
+	}
+	if got := m.Stats(); got.PendingSamples != 0 || got.FailedSamples != 6 {
+		t.Errorf("Stats() = %+v, want 6 failed samples", got)
+	}
+}
+
+func repeat(status, n int) []int {
+	statuses := make([]int, n)
+	for i := range statuses {
+		statuses[i] = status
+	}
+	return statuses
+}
+
+// TestQueueManagerReshard checks the samples of a series stay in order
+// while the shards are replaced.
+func TestQueueManagerReshard(t *testing.T) {
+	r, url := newReceiver(t)
+	opts := fastOptions()
+	opts.Capacity = 10
+	m := NewQueueManager(url, opts)
+	done := make(chan error, 1)
+	go func() {
+		done <- appendSamples(context.Background(), m, 10, 200)
+	}()
+	for n := 1; ; n = n%8 + 1 {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+			closeQueue(t, m)
+			r.checkReceived(t, 10, 200)
+			if got := m.Stats(); got.SentSamples != 2000 || got.PendingSamples != 0 {
+				t.Errorf("Stats() = %+v, want 2000 sent samples", got)
+			}
+			return
+		default:
+		}
+		m.reshard(n)
+		if got := m.Stats().Shards; got != n {
+			t.Fatalf("Shards = %d after resharding to %d", got, n)
+		}
+	}
+}
+
+// TestQueueManagerReshardDown checks appends and stats go on while the old
+// shards can't be sent, and that Close ends resharding.
+func TestQueueManagerReshardDown(t *testing.T) {
+	_, url := newReceiver(t, repeat(http.StatusServiceUnavailable, 1<<20)...)
+	opts := fastOptions()
+	opts.Capacity = 1
+	m := NewQueueManager(url, opts)
+	if err := m.Append(context.Background(), seriesAt(0, 0)); err != nil {
+		t.Fatal(err)
+	}
+	resharded := make(chan struct{})
+	go func() {
+		defer close(resharded)
+		m.reshard(2)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for m.Stats().Shards != 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("the shards were not replaced")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// The new shards queue one series each, and wait for the old one to be
+	// sent.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var queued int
+	for i := 0; queued < 2; i++ {
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		err := m.Append(ctx, seriesAt(i, 1))
+		cancel()
+		switch {
+		case err == nil:
+			queued++
+		case !errors.Is(err, context.DeadlineExceeded):
+			t.Fatalf("Append() = %v", err)
+		}
+	}
+	short, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := appendSamples(short, m, 10, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Append() to full shards = %v, want DeadlineExceeded", err)
+	}
+	select {
+	case <-resharded:
+		t.Fatal("the old shard was drained with the endpoint down")
+	default:
+	}
+
+	closeCtx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := m.Close(closeCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Close() = %v, want DeadlineExceeded", err)
+	}
+	<-resharded
+	if got := m.Stats(); got.PendingSamples != 0 || got.FailedSamples != 3 {
+		t.Errorf("Stats() = %+v, want 3 failed samples", got)
+	}
+}
+
+func TestDesiredShards(t *testing.T) {
+	tests := []struct {
+		name             string
+		current          int
+		minShards        int
+		in, out, pending int64
+		// busy is the time spent sending out.
+		busy time.Duration
+		want int
+	}{
+		{"nothing sent", 4, 1, 100, 0, 100, 0, 4},
+		{"scale up", 1, 1, 1000, 1000, 0, 30 * time.Second, 3},
+		{"pending", 1, 1, 0, 1000, 1000, 30 * time.Second, 3},
+		{"scale down", 8, 1, 100, 100, 0, 10 * time.Second, 1},
+		{"within 30%", 4, 1, 1000, 1000, 0, 45 * time.Second, 4},
+		{"max", 1, 1, 1000, 1, 0, time.Hour, 5},
+		{"min", 4, 2, 0, 1000, 0, time.Second, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &QueueManager{opts: QueueOptions{MinShards: tt.minShards, MaxShards: 5, ScaleInterval: 10 * time.Second}}
+			m.in, m.out, m.busy, m.pending = tt.in, tt.out, int64(tt.busy), tt.pending
+			if got := m.desiredShards(tt.current); got != tt.want {
+				t.Errorf("desiredShards(%d) = %d, want %d", tt.current, got, tt.want)
+			}
+			if m.in != 0 || m.out != 0 || m.busy != 0 {
+				t.Errorf("desiredShards() kept the counters %d, %d, %d", m.in, m.out, m.busy)
+			}
+		})
+	}
+}
+
+func TestLabelsHash(t *testing.T) {
+	a := []*Label{{Name: "__name__", Value: "up"}, {Name: "job", Value: "j"}}
+	b := []*Label{{Name: "job", Value: "j"}, {Name: "__name__", Value: "up"}}
+	if labelsHash(a) != labelsHash(b) {
+		t.Error("labelsHash() depends on the order of the labels")
+	}
+	c := []*Label{{Name: "__name__", Value: "upj"}, {Name: "ob", Value: ""}}
+	if labelsHash(a) == labelsHash(c) {
+		t.Error("labelsHash() of different label sets is the same")
+	}
+}
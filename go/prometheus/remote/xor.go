@@ -0,0 +1,435 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+)
+
+// bitWriter appends bits to a byte slice, most significant bit first.
+type bitWriter struct {
+	b []byte
+	// free is the number of bits left in the last byte.
+	free uint8
+}
+
+func (w *bitWriter) writeBit(bit bool) {
+	if w.free == 0 {
+		w.b = append(w.b, 0)
+		w.free = 8
+	}
+	w.free--
+	if bit {
+		w.b[len(w.b)-1] |= 1 << w.free
+	}
+}
+
+func (w *bitWriter) writeByte(b byte) {
+	if w.free == 0 {
+		w.b = append(w.b, b)
+		return
+	}
+	w.b[len(w.b)-1] |= b >> (8 - w.free)
+	w.b = append(w.b, b<<w.free)
+}
+
+// writeBits writes the n lowest bits of u.
+func (w *bitWriter) writeBits(u uint64, n int) {
+	u <<= 64 - uint(n)
+	for ; n >= 8; n -= 8 {
+		w.writeByte(byte(u >> 56))
+		u <<= 8
+	}
+	for ; n > 0; n-- {
+		w.writeBit(u>>63 == 1)
+		u <<= 1
+	}
+}
+
+// samplesPerChunk is the number of samples of the chunks the TSDB cuts.
+const samplesPerChunk = 120
+
+// ErrChunkFull is returned for samples appended to a chunk holding
+// math.MaxUint16 samples, the most the format can count.
+var ErrChunkFull = errors.New("chunk is full")
+
+// XOREncoder encodes samples in the XOR chunk format of the Prometheus
+// TSDB, the Chunk_XOR encoding: the number of samples on two bytes, the
+// first timestamp and value in full, then delta-of-delta timestamps and
+// values XORed with their predecessor.
+type XOREncoder struct {
+	w bitWriter
+
+	num      uint16
+	minTime  int64
+	t        int64
+	v        float64
+	tDelta   uint64
+	leading  uint8
+	trailing uint8
+}
+
+// NewXOREncoder returns an encoder of an empty chunk.
+func NewXOREncoder() *XOREncoder {
+	return &XOREncoder{w: bitWriter{b: make([]byte, 2)}, leading: 0xff}
+}
+
+// Append adds a sample to the chunk. Timestamps are expected in order.
+func (e *XOREncoder) Append(t int64, v float64) error {
+	if e.num == math.MaxUint16 {
+		return ErrChunkFull
+	}
+	var tDelta uint64
+	switch e.num {
+	case 0:
+		var buf [binary.MaxVarintLen64]byte
+		for _, b := range buf[:binary.PutVarint(buf[:], t)] {
+			e.w.writeByte(b)
+		}
+		e.w.writeBits(math.Float64bits(v), 64)
+		e.minTime = t
+	case 1:
+		tDelta = uint64(t - e.t)
+		var buf [binary.MaxVarintLen64]byte
+		for _, b := range buf[:binary.PutUvarint(buf[:], tDelta)] {
+			e.w.writeByte(b)
+		}
+		e.writeValue(v)
+	default:
+		tDelta = uint64(t - e.t)
+		dod := int64(tDelta - e.tDelta)
+		switch {
+		case dod == 0:
+			e.w.writeBit(false)
+		case bitRange(dod, 14):
+			e.w.writeBits(0b10, 2)
+			e.w.writeBits(uint64(dod), 14)
+		case bitRange(dod, 17):
+			e.w.writeBits(0b110, 3)
+			e.w.writeBits(uint64(dod), 17)
+		case bitRange(dod, 20):
+			e.w.writeBits(0b1110, 4)
+			e.w.writeBits(uint64(dod), 20)
+		default:
+			e.w.writeBits(0b1111, 4)
+			e.w.writeBits(uint64(dod), 64)
+		}
+		e.writeValue(v)
+	}
+	e.t, e.v, e.tDelta = t, v, tDelta
+	e.num++
+	binary.BigEndian.PutUint16(e.w.b, e.num)
+	return nil
+}
+
+// bitRange reports whether x fits the signed range of n bits the format
+// uses, [-2^(n-1)+1, 2^(n-1)].
+func bitRange(x int64, n uint8) bool {
+	return -((1<<(n-1))-1) <= x && x <= 1<<(n-1)
+}
+
+func (e *XOREncoder) writeValue(v float64) {
+	delta := math.Float64bits(v) ^ math.Float64bits(e.v)
+	if delta == 0 {
+		e.w.writeBit(false)
+		return
+	}
+	e.w.writeBit(true)
+
+	leading := uint8(bits.LeadingZeros64(delta))
+	trailing := uint8(bits.TrailingZeros64(delta))
+	// The number of leading zeros is written on 5 bits.
+	if leading >= 32 {
+		leading = 31
+	}
+	if e.leading != 0xff && leading >= e.leading && trailing >= e.trailing {
+		// The meaningful bits fit the window of the previous value.
+		e.w.writeBit(false)
+		e.w.writeBits(delta>>e.trailing, 64-int(e.leading)-int(e.trailing))
+		return
+	}
+	e.leading, e.trailing = leading, trailing
+	e.w.writeBit(true)
+	e.w.writeBits(uint64(leading), 5)
+	// 64 meaningful bits overflow the 6 bits of the length and are written
+	// as 0.
+	significant := 64 - leading - trailing
+	e.w.writeBits(uint64(significant), 6)
+	e.w.writeBits(delta>>trailing, int(significant))
+}
+
+// Len returns the number of samples of the chunk.
+func (e *XOREncoder) Len() int {
+	return int(e.num)
+}
+
+// Bytes returns the chunk encoded so far. It is modified by later appends.
+func (e *XOREncoder) Bytes() []byte {
+	return e.w.b
+}
+
+// Chunk returns the chunk encoded so far.
+func (e *XOREncoder) Chunk() *Chunk {
+	return &Chunk{
+		MinTimeMs: e.minTime,
+		MaxTimeMs: e.t,
+		Type:      Chunk_XOR,
+		Data:      append([]byte(nil), e.w.b...),
+	}
+}
+
+// EncodeXORChunks encodes samples, sorted by timestamp, in XOR chunks of
+// up to 120 samples, the size of the chunks the TSDB cuts.
+func EncodeXORChunks(samples []*Sample) []*Chunk {
+	chunks := make([]*Chunk, 0, (len(samples)+samplesPerChunk-1)/samplesPerChunk)
+	for start := 0; start < len(samples); start += samplesPerChunk {
+		end := start + samplesPerChunk
+		if end > len(samples) {
+			end = len(samples)
+		}
+		e := NewXOREncoder()
+		for _, sample := range samples[start:end] {
+			_ = e.Append(sample.GetTimestamp(), sample.GetValue())
+		}
+		chunks = append(chunks, &Chunk{
+			MinTimeMs: e.minTime,
+			MaxTimeMs: e.t,
+			Type:      Chunk_XOR,
+			Data:      e.w.b,
+		})
+	}
+	return chunks
+}
+
+// bitReader reads bits from a byte slice, most significant bit first.
+type bitReader struct {
+	b []byte
+	// pos is the index of the next bit.
+	pos int
+}
+
+func (r *bitReader) readBit() (bool, error) {
+	if r.pos >= len(r.b)*8 {
+		return false, io.ErrUnexpectedEOF
+	}
+	bit := r.b[r.pos/8]&(0x80>>(r.pos%8)) != 0
+	r.pos++
+	return bit, nil
+}
+
+func (r *bitReader) readBits(n int) (uint64, error) {
+	if r.pos+n > len(r.b)*8 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	var u uint64
+	for ; n > 0 && r.pos%8 != 0; n-- {
+		bit, _ := r.readBit()
+		u <<= 1
+		if bit {
+			u |= 1
+		}
+	}
+	for ; n >= 8; n -= 8 {
+		u = u<<8 | uint64(r.b[r.pos/8])
+		r.pos += 8
+	}
+	for ; n > 0; n-- {
+		bit, _ := r.readBit()
+		u <<= 1
+		if bit {
+			u |= 1
+		}
+	}
+	return u, nil
+}
+
+// ReadByte makes the reader an io.ByteReader, for varints.
+func (r *bitReader) ReadByte() (byte, error) {
+	b, err := r.readBits(8)
+	return byte(b), err
+}
+
+// XORIterator iterates over the samples of an XOR chunk.
+type XORIterator struct {
+	r   bitReader
+	num uint16
+	i   uint16
+	err error
+
+	t        int64
+	v        float64
+	tDelta   uint64
+	leading  uint8
+	trailing uint8
+}
+
+// NewXORIterator returns an iterator over the samples of the XOR chunk
+// data.
+func NewXORIterator(data []byte) *XORIterator {
+	it := &XORIterator{r: bitReader{b: data, pos: 16}}
+	if len(data) < 2 {
+		it.err = fmt.Errorf("XOR chunk of %d bytes: %w", len(data), io.ErrUnexpectedEOF)
+		return it
+	}
+	it.num = binary.BigEndian.Uint16(data)
+	return it
+}
+
+// Next advances to the next sample, returning false after the last one or
+// on error.
+func (it *XORIterator) Next() bool {
+	if it.err != nil || it.i >= it.num {
+		return false
+	}
+	if err := it.next(); err != nil {
+		it.err = fmt.Errorf("XOR chunk sample %d: %w", it.i, err)
+		return false
+	}
+	it.i++
+	return true
+}
+
+func (it *XORIterator) next() error {
+	switch it.i {
+	case 0:
+		t, err := binary.ReadVarint(&it.r)
+		if err != nil {
+			return err
+		}
+		v, err := it.r.readBits(64)
+		if err != nil {
+			return err
+		}
+		it.t, it.v = t, math.Float64frombits(v)
+		return nil
+	case 1:
+		tDelta, err := binary.ReadUvarint(&it.r)
+		if err != nil {
+			return err
+		}
+		it.tDelta = tDelta
+		it.t += int64(tDelta)
+		return it.readValue()
+	}
+
+	// The delta of delta is prefixed by 0, 10, 110, 1110 or 1111 for 0, 14,
+	// 17, 20 or 64 bits.
+	var size int
+	for _, n := range []int{14, 17, 20, 64} {
+		bit, err := it.r.readBit()
+		if err != nil {
+			return err
+		}
+		if !bit {
+			break
+		}
+		size = n
+	}
+	var dod int64
+	if size > 0 {
+		u, err := it.r.readBits(size)
+		if err != nil {
+			return err
+		}
+		if size < 64 && u > 1<<(size-1) {
+			// Sign extend.
+			u -= 1 << size
+		}
+		dod = int64(u)
+	}
+	it.tDelta = uint64(int64(it.tDelta) + dod)
+	it.t += int64(it.tDelta)
+	return it.readValue()
+}
+
+func (it *XORIterator) readValue() error {
+	changed, err := it.r.readBit()
+	if err != nil || !changed {
+		return err
+	}
+	newWindow, err := it.r.readBit()
+	if err != nil {
+		return err
+	}
+	if newWindow {
+		leading, err := it.r.readBits(5)
+		if err != nil {
+			return err
+		}
+		significant, err := it.r.readBits(6)
+		if err != nil {
+			return err
+		}
+		if significant == 0 {
+			significant = 64
+		}
+		it.leading, it.trailing = uint8(leading), uint8(64-leading-significant)
+	}
+	significant := 64 - int(it.leading) - int(it.trailing)
+	if significant <= 0 {
+		return errors.New("invalid value window")
+	}
+	delta, err := it.r.readBits(significant)
+	if err != nil {
+		return err
+	}
+	it.v = math.Float64frombits(math.Float64bits(it.v) ^ delta<<it.trailing)
+	return nil
+}
+
+// At returns the current sample.
+func (it *XORIterator) At() (int64, float64) {
+	return it.t, it.v
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *XORIterator) Err() error {
+	return it.err
+}
+
+// Samples decodes the samples of the chunk.
+func (x *Chunk) Samples() ([]*Sample, error) {
+	if x.GetType() != Chunk_XOR {
+		return nil, fmt.Errorf("unsupported chunk encoding %s", x.GetType())
+	}
+	it := NewXORIterator(x.GetData())
+	samples := make([]*Sample, 0, it.num)
+	for it.Next() {
+		t, v := it.At()
+		samples = append(samples, &Sample{Timestamp: t, Value: v})
+	}
+	if it.Err() != nil {
+		return nil, it.Err()
+	}
+	return samples, nil
+}
+
+// TimeSeries decodes the chunks of the series.
+func (x *ChunkedSeries) TimeSeries() (*TimeSeries, error) {
+	series := &TimeSeries{Labels: x.GetLabels()}
+	for _, chunk := range x.GetChunks() {
+		samples, err := chunk.Samples()
+		if err != nil {
+			return nil, err
+		}
+		series.Samples = append(series.Samples, samples...)
+	}
+	return series, nil
+}
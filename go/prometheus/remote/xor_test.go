@@ -0,0 +1,175 @@
+// Copyright 2023 Greptime Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// prometheusChunk is the XOR chunk of the Prometheus TSDB holding
+// prometheusSamples.
+var prometheusChunk = []byte{
+	0x00, 0x03, // 3 samples
+	0xd0, 0x0f, // varint 1000
+	0x3f, 0xf0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // 1.0
+	0xe8, 0x07, // uvarint delta 1000
+	// 0: same value; 0: delta of delta 0; 1, 1, 00001, 001011,
+	// 11111111111: value XOR of 1 leading and 11 significant bits.
+	0x30, 0x97, 0xff, 0xc0,
+}
+
+var prometheusSamples = []*Sample{{Timestamp: 1000, Value: 1}, {Timestamp: 2000, Value: 1}, {Timestamp: 3000, Value: 2}}
+
+func TestXORPrometheusChunk(t *testing.T) {
+	chunks := EncodeXORChunks(prometheusSamples)
+	if len(chunks) != 1 || !bytes.Equal(chunks[0].Data, prometheusChunk) {
+		t.Errorf("EncodeXORChunks() = %x, want %x", chunks[0].Data, prometheusChunk)
+	}
+	got, err := (&Chunk{Type: Chunk_XOR, Data: prometheusChunk}).Samples()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSamples(t, got, prometheusSamples)
+}
+
+// checkSamples compares samples, values bit for bit.
+func checkSamples(t *testing.T, got, want []*Sample) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%d samples, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].GetTimestamp() != want[i].GetTimestamp() ||
+			math.Float64bits(got[i].GetValue()) != math.Float64bits(want[i].GetValue()) {
+			t.Fatalf("sample %d = %d %v, want %d %v", i,
+				got[i].GetTimestamp(), got[i].GetValue(), want[i].GetTimestamp(), want[i].GetValue())
+		}
+	}
+}
+
+// xorSamples reads the samples of fuzz data, a timestamp and the bits of a
+// value per 16 bytes.
+func xorSamples(data []byte) []*Sample {
+	samples := make([]*Sample, 0, len(data)/16)
+	for ; len(data) >= 16; data = data[16:] {
+		samples = append(samples, &Sample{
+			Timestamp: int64(binary.BigEndian.Uint64(data)),
+			Value:     math.Float64frombits(binary.BigEndian.Uint64(data[8:])),
+		})
+	}
+	return samples
+}
+
+// xorData is the inverse of xorSamples.
+func xorData(samples ...*Sample) []byte {
+	data := make([]byte, 16*len(samples))
+	for i, s := range samples {
+		binary.BigEndian.PutUint64(data[16*i:], uint64(s.GetTimestamp()))
+		binary.BigEndian.PutUint64(data[16*i+8:], math.Float64bits(s.GetValue()))
+	}
+	return data
+}
+
+func FuzzXORRoundTrip(f *testing.F) {
+	f.Add(xorData(prometheusSamples...))
+	f.Add(xorData(
+		&Sample{Timestamp: -5000, Value: math.NaN()},
+		&Sample{Timestamp: -1, Value: math.Float64frombits(0x7ff8000000000001)},
+		&Sample{Timestamp: 0, Value: math.Copysign(0, -1)},
+		&Sample{Timestamp: 1, Value: math.Inf(1)},
+	))
+	f.Add(xorData(
+		&Sample{Timestamp: math.MinInt64, Value: -math.MaxFloat64},
+		&Sample{Timestamp: math.MaxInt64, Value: math.SmallestNonzeroFloat64},
+		&Sample{Timestamp: math.MinInt64, Value: math.MaxFloat64},
+		&Sample{Timestamp: 0, Value: 1},
+	))
+	// Deltas of delta at the edges of the 14, 17 and 20 bit ranges.
+	var edges []*Sample
+	var ts, delta int64
+	for _, dod := range []int64{0, 1 << 13, -(1 << 13) + 1, 1<<13 + 1, 1 << 16, 1<<16 + 1, 1 << 19, -(1 << 19), 1<<19 + 1, 1 << 40} {
+		delta += dod
+		ts += delta
+		edges = append(edges, &Sample{Timestamp: ts, Value: float64(dod)})
+	}
+	f.Add(xorData(edges...))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		samples := xorSamples(data)
+		var got []*Sample
+		for _, chunk := range EncodeXORChunks(samples) {
+			it := NewXORIterator(chunk.Data)
+			for it.Next() {
+				ts, v := it.At()
+				got = append(got, &Sample{Timestamp: ts, Value: v})
+			}
+			if err := it.Err(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		checkSamples(t, got, samples)
+	})
+}
+
+func TestEncodeXORChunks(t *testing.T) {
+	samples := make([]*Sample, 2*samplesPerChunk+1)
+	for i := range samples {
+		samples[i] = &Sample{Timestamp: int64(i) * 15000, Value: float64(i % 7)}
+	}
+	chunks := EncodeXORChunks(samples)
+	if len(chunks) != 3 {
+		t.Fatalf("%d chunks, want 3", len(chunks))
+	}
+	var got []*Sample
+	for i, chunk := range chunks {
+		part := samples[i*samplesPerChunk:]
+		if len(part) > samplesPerChunk {
+			part = part[:samplesPerChunk]
+		}
+		if chunk.MinTimeMs != part[0].Timestamp || chunk.MaxTimeMs != part[len(part)-1].Timestamp {
+			t.Errorf("chunk %d covers [%d, %d], want [%d, %d]", i,
+				chunk.MinTimeMs, chunk.MaxTimeMs, part[0].Timestamp, part[len(part)-1].Timestamp)
+		}
+		s, err := chunk.Samples()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, s...)
+	}
+	checkSamples(t, got, samples)
+	if chunks := EncodeXORChunks(nil); len(chunks) != 0 {
+		t.Errorf("EncodeXORChunks(nil) = %v, want none", chunks)
+	}
+}
+
+func TestXORIteratorErrors(t *testing.T) {
+	for _, data := range [][]byte{
+		nil,
+		{0x00},
+		prometheusChunk[:len(prometheusChunk)-1],
+		// More samples than the padding bits can hold.
+		append([]byte{0x00, 0x10}, prometheusChunk[2:]...),
+	} {
+		it := NewXORIterator(data)
+		for it.Next() {
+		}
+		if it.Err() == nil {
+			t.Errorf("XOR chunk %x decoded without error", data)
+		}
+	}
+}